@@ -0,0 +1,167 @@
+package herd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Checkpoints are pruned when a run starts, keeping only the most recent ones.
+// While running, they are saved at most once per interval.
+const (
+	checkpointKeep     = 100
+	checkpointMaxAge   = 30 * 24 * time.Hour
+	checkpointInterval = time.Second
+)
+
+// A checkpoint records the progress of a run while it is executing, so it can
+// be resumed on the hosts that did not finish successfully when herd was
+// interrupted.
+type Checkpoint struct {
+	Id        string
+	Command   string
+	Hosts     []string
+	Settings  checkpointSettings
+	Results   map[string]*Result
+	StartTime time.Time
+	Finished  bool
+}
+
+type checkpointSettings struct {
+	Sort        []string
+	Parallel    int
+	ParallelPer map[string]int
+	Splay       time.Duration
+	Timeout     time.Duration
+	HostTimeout time.Duration
+	SignalGrace time.Duration
+	NoTemplate  bool
+}
+
+func newRunId(t time.Time) string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return t.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+func checkpointPath(dir, id string) string {
+	return filepath.Join(dir, fmt.Sprintf("checkpoint-%s.json", id))
+}
+
+func LoadCheckpoint(dir, id string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(checkpointPath(dir, id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("No checkpoint found for run %s", id)
+		}
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("Unable to parse checkpoint for run %s: %s", id, err)
+	}
+	return cp, nil
+}
+
+// All checkpoints in a directory, newest first. Checkpoints that can't be read
+// are skipped with a warning.
+func ListCheckpoints(dir string) ([]*Checkpoint, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Checkpoint, 0, len(files))
+	for _, f := range files {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "checkpoint-"), ".json")
+		cp, err := LoadCheckpoint(dir, id)
+		if err != nil {
+			logrus.Warnf("Skipping checkpoint %s: %s", f, err)
+			continue
+		}
+		ret = append(ret, cp)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].StartTime.After(ret[j].StartTime) })
+	return ret, nil
+}
+
+// Remove all but the most recent checkpoints, and checkpoints that are too old
+// to be worth resuming. File modification times are used, so unreadable
+// checkpoints are pruned too.
+func PruneCheckpoints(dir string, keep int, maxAge time.Duration) error {
+	files, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	if err != nil {
+		return err
+	}
+	mtimes := make(map[string]time.Time)
+	for _, f := range files {
+		if st, err := os.Stat(f); err == nil {
+			mtimes[f] = st.ModTime()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return mtimes[files[i]].After(mtimes[files[j]]) })
+	errs := &MultiError{Subject: "Unable to prune checkpoints"}
+	for i, f := range files {
+		if i < keep && time.Since(mtimes[f]) < maxAge {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs.Add(err)
+		}
+	}
+	if errs.HasErrors() {
+		return errs
+	}
+	return nil
+}
+
+// The hosts that have not yet successfully run the command.
+func (c *Checkpoint) Pending() []string {
+	ret := make([]string, 0)
+	for _, name := range c.Hosts {
+		if !c.succeeded(name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+func (c *Checkpoint) succeeded(name string) bool {
+	r, ok := c.Results[name]
+	return ok && r.ExitStatus == 0 && r.Err == nil
+}
+
+// Checkpoints are written to a temporary file that is moved in place, so an
+// interruption while writing never leaves a corrupt checkpoint behind.
+func (c *Checkpoint) save(dir string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), checkpointPath(dir, c.Id))
+}
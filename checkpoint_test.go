@@ -0,0 +1,178 @@
+package herd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	hosts := Hosts{
+		NewHost("host-1.example.com", "", HostAttributes{}),
+		NewHost("host-2.example.com", "", HostAttributes{}),
+		NewHost("host-3.example.com", "", HostAttributes{}),
+	}
+	e := &fakeExecutor{fail: map[string]bool{"host-2.example.com": true}}
+	r := NewRunner(e)
+	r.SetCheckpointDir(dir)
+	r.SetParallel(2)
+	r.AddHosts(hosts)
+	hi, err := r.Run("uptime", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	cp, err := LoadCheckpoint(dir, hi.Id)
+	if err != nil {
+		t.Fatalf("Unable to load checkpoint: %s", err)
+	}
+	if !cp.Finished || cp.Command != "uptime" || cp.Settings.Parallel != 2 || len(cp.Results) != 3 {
+		t.Errorf("Checkpoint does not match the run: %v", cp)
+	}
+	if pending := cp.Pending(); len(pending) != 1 || pending[0] != "host-2.example.com" {
+		t.Errorf("Expected only host-2 to be pending, got %v", pending)
+	}
+	if cps, err := ListCheckpoints(dir); err != nil || len(cps) != 1 || cps[0].Id != hi.Id {
+		t.Errorf("Checkpoint was not listed: %v (%v)", cps, err)
+	}
+
+	e = &fakeExecutor{}
+	r = NewRunner(e)
+	r.SetCheckpointDir(dir)
+	r.AddHosts(hosts)
+	r.Resume(cp)
+	hi2, err := r.Run(cp.Command, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(e.ran) != 1 || e.ran[0] != "host-2.example.com" {
+		t.Errorf("Expected only host-2 to run again, ran on %v", e.ran)
+	}
+	if hi2.Id != hi.Id || r.parallel != 2 {
+		t.Errorf("Resumed run should use the original id and settings")
+	}
+	if hi2.Summary.Ok != 3 || len(hi2.Results) != 3 || hi2.Results["host-1.example.com"].Host != hosts[0] {
+		t.Errorf("Previous results were not merged: %v", hi2.Results)
+	}
+	cp, err = LoadCheckpoint(dir, hi.Id)
+	if err != nil || len(cp.Pending()) != 0 {
+		t.Errorf("Checkpoint was not updated after resuming: %v", err)
+	}
+}
+
+// An executor that only finishes on slow hosts when told to
+type slowExecutor struct {
+	fakeExecutor
+	slow    map[string]bool
+	release chan struct{}
+}
+
+func (e *slowExecutor) Run(ctx context.Context, host *Host, command string, oc chan OutputLine) *Result {
+	if e.slow[host.Name] {
+		<-e.release
+	}
+	return e.fakeExecutor.Run(ctx, host, command, oc)
+}
+
+func TestCheckpointPendingSave(t *testing.T) {
+	dir := t.TempDir()
+	e := &slowExecutor{slow: map[string]bool{"host-3.example.com": true}, release: make(chan struct{})}
+	r := NewRunner(e)
+	r.SetCheckpointDir(dir)
+	r.AddHosts(Hosts{
+		NewHost("host-1.example.com", "", HostAttributes{}),
+		NewHost("host-2.example.com", "", HostAttributes{}),
+		NewHost("host-3.example.com", "", HostAttributes{}),
+	})
+	done := make(chan struct{})
+	go func() {
+		r.Run("uptime", nil, nil)
+		close(done)
+	}()
+	defer func() {
+		close(e.release)
+		<-done
+	}()
+
+	// The first two results come in right after the run was saved, and must
+	// be saved while host-3 is still running
+	time.Sleep(checkpointInterval + 500*time.Millisecond)
+	cps, err := ListCheckpoints(dir)
+	if err != nil || len(cps) != 1 {
+		t.Fatalf("Expected one checkpoint, got %v (%v)", cps, err)
+	}
+	if cps[0].Finished || len(cps[0].Results) != 2 {
+		t.Errorf("Expected the results of two hosts to be saved, got %v", cps[0].Results)
+	}
+}
+
+func TestNoCheckpointForInternalCommands(t *testing.T) {
+	dir := t.TempDir()
+	e := &fakeExecutor{fail: map[string]bool{"host-1.example.com": true}}
+	r := NewRunner(e)
+	r.SetCheckpointDir(dir)
+	r.AddHosts(Hosts{NewHost("host-1.example.com", "", HostAttributes{})})
+	if _, err := r.Run("herd:tunnel", nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("Internal command left a checkpoint behind: %v (%v)", files, err)
+	}
+}
+
+func TestCheckpointResumeSort(t *testing.T) {
+	hosts := Hosts{
+		NewHost("host-1.example.com", "", HostAttributes{"rack": "b"}),
+		NewHost("host-2.example.com", "", HostAttributes{"rack": "a"}),
+	}
+	r := NewRunner(&fakeExecutor{})
+	r.AddHosts(hosts)
+	r.Resume(&Checkpoint{Id: "test", Settings: checkpointSettings{Sort: []string{"rack"}}})
+	if got := r.GetHosts(); got[0] != hosts[1] || got[1] != hosts[0] {
+		t.Errorf("Hosts were not sorted by the checkpoint's sort order: %v", got)
+	}
+}
+
+func TestListCheckpointsSkipsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	cp := &Checkpoint{Id: "20220101-000000-abcd", Command: "uptime", StartTime: time.Now()}
+	if err := cp.save(dir); err != nil {
+		t.Fatalf("Unable to save checkpoint: %s", err)
+	}
+	if err := ioutil.WriteFile(checkpointPath(dir, "20220101-000000-dead"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cps, err := ListCheckpoints(dir)
+	if err != nil || len(cps) != 1 || cps[0].Id != cp.Id {
+		t.Errorf("Corrupt checkpoints should be skipped, got %v (%v)", cps, err)
+	}
+}
+
+func TestPruneCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		path := checkpointPath(dir, fmt.Sprintf("run-%d", i))
+		if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		if i == 1 {
+			mtime = now.Add(-48 * time.Hour)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	if err := PruneCheckpoints(dir, 3, 24*time.Hour); err != nil {
+		t.Fatalf("Unable to prune checkpoints: %s", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	expected := []string{checkpointPath(dir, "run-0"), checkpointPath(dir, "run-2"), checkpointPath(dir, "run-3")}
+	if fmt.Sprint(files) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v to be kept, got %v", expected, files)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
-	// Import the provider you wish to serve over grpc
+	// Import the provider you wish to serve over grpc. Providers that
+	// implement server.StreamingProvider, like the example provider, send
+	// their hosts to herd in batches while they are loading.
 	_ "github.com/seveas/herd/provider/example"
 
 	// And the helper library to serve it
@@ -8,13 +8,19 @@ import (
 	_ "github.com/seveas/herd/provider/putty"
 
 	// Simple file based providers
+	_ "github.com/seveas/herd/provider/ansible"
 	_ "github.com/seveas/herd/provider/json"
 	_ "github.com/seveas/herd/provider/plain"
+	_ "github.com/seveas/herd/provider/terraform"
 
 	// Network based ones
 	_ "github.com/seveas/herd/provider/cache"
 	_ "github.com/seveas/herd/provider/consul"
 	_ "github.com/seveas/herd/provider/http"
+	_ "github.com/seveas/herd/provider/kubernetes"
+	_ "github.com/seveas/herd/provider/ldap"
+	_ "github.com/seveas/herd/provider/netbox"
+	_ "github.com/seveas/herd/provider/nomad"
 	_ "github.com/seveas/herd/provider/prometheus"
 	_ "github.com/seveas/herd/provider/tailscale"
 
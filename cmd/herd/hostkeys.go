@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/ssh"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var hostKeysCmd = &cobra.Command{
+	Use:   "hostkeys",
+	Short: "Verify and maintain ssh host keys",
+}
+
+var hostKeysVerifyCmd = &cobra.Command{
+	Use:                   "verify [options] glob [filters] [<+|-> glob [filters]...]",
+	Short:                 "Compare scanned host keys with the keys providers and known_hosts files know about",
+	Example:               "  herd hostkeys verify *.site2.example.com",
+	DisableFlagsInUseLine: true,
+	RunE:                  runHostKeysVerify,
+	PreRun:                hostKeysPreRun,
+}
+
+var hostKeysUpdateCmd = &cobra.Command{
+	Use:                   "update [options] glob [filters] [<+|-> glob [filters]...]",
+	Short:                 "Scan host keys and write them to a known_hosts file, replacing older entries",
+	Example:               "  herd hostkeys update --hash --file ~/.ssh/known_hosts *.site2.example.com",
+	DisableFlagsInUseLine: true,
+	RunE:                  runHostKeysUpdate,
+	PreRun:                hostKeysPreRun,
+}
+
+var hostKeysSshfpCmd = &cobra.Command{
+	Use:                   "sshfp [options] glob [filters] [<+|-> glob [filters]...]",
+	Short:                 "Generate SSHFP DNS records for hosts",
+	Example:               "  herd hostkeys sshfp *.site2.example.com",
+	DisableFlagsInUseLine: true,
+	RunE:                  runHostKeysSshfp,
+	PreRun:                hostKeysPreRun,
+}
+
+var hostKeysPendingCmd = &cobra.Command{
+	Use:   "pending",
+	Short: "Show host key changes that have not been accepted yet",
+	Args:  cobra.NoArgs,
+	RunE:  runHostKeysPending,
+}
+
+var hostKeysAcceptCmd = &cobra.Command{
+	Use:     "accept glob [glob...]",
+	Short:   "Accept pending host key changes for all hosts matching the globs",
+	Example: "  herd hostkeys accept '*.site2.example.com'",
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    runHostKeysAccept,
+}
+
+func init() {
+	hostKeysCmd.AddCommand(hostKeysPendingCmd, hostKeysAcceptCmd)
+	for _, cmd := range []*cobra.Command{hostKeysVerifyCmd, hostKeysUpdateCmd, hostKeysSshfpCmd} {
+		cmd.Flags().StringSlice("type", []string{"ssh-rsa", "ecdsa-sha2-nistp256", "ssh-ed25519"}, "Which key algorithm(s) to scan for")
+		hostKeysCmd.AddCommand(cmd)
+	}
+	hostKeysUpdateCmd.Flags().String("file", "", "The known_hosts file to update (default: known_hosts in herd's data directory)")
+	hostKeysUpdateCmd.Flags().Bool("hash", false, "Hash hostnames, like ssh-keygen -H does. Note that herd itself ignores hashed entries")
+	rootCmd.AddCommand(hostKeysCmd)
+}
+
+func hostKeysPreRun(cmd *cobra.Command, args []string) {
+	if !rootCmd.PersistentFlags().Lookup("loglevel").Changed {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+	// These flags are shared with the keyscan command, so we can only bind
+	// them once we know which command runs
+	viper.BindPFlag("KeyType", cmd.Flags().Lookup("type"))
+	if f := cmd.Flags().Lookup("file"); f != nil {
+		viper.BindPFlag("KnownHostsFile", f)
+		viper.BindPFlag("HashKnownHosts", cmd.Flags().Lookup("hash"))
+	}
+}
+
+func runHostKeysVerify(cmd *cobra.Command, args []string) error {
+	splitAt := cmd.ArgsLenAtDash()
+	if splitAt != -1 {
+		return fmt.Errorf("Command provided, but hostkeys verify doesn't support that")
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	engine, executor, err := scanKeys(args, splitAt, true)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	keyTypes := []string{}
+	for _, t := range viper.GetStringSlice("KeyType") {
+		keyTypes = append(keyTypes, knownKeyTypes[t])
+	}
+	problems := 0
+	for _, host := range engine.Runner.GetHosts() {
+		scanned := executor.ScannedKeys(host)
+		if len(scanned) == 0 {
+			logrus.Warnf("Unable to scan host keys of %s", host.Name)
+			continue
+		}
+		for _, p := range ssh.VerifyHostKeys(host.PublicKeys(), scanned, keyTypes) {
+			fmt.Printf("%s: %s\n", host.Name, p)
+			problems++
+		}
+	}
+	if problems > 0 {
+		err = fmt.Errorf("%d host key problems found", problems)
+		logrus.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func runHostKeysUpdate(cmd *cobra.Command, args []string) error {
+	splitAt := cmd.ArgsLenAtDash()
+	if splitAt != -1 {
+		return fmt.Errorf("Command provided, but hostkeys update doesn't support that")
+	}
+	file := viper.GetString("KnownHostsFile")
+	if file == "" {
+		file = filepath.Join(currentUser.dataDir, "known_hosts")
+	}
+	// The keys herd trusts are only changed by herd itself
+	if abs, err := filepath.Abs(file); err == nil && abs == ssh.NewKeyStore(currentUser.dataDir).Path() {
+		return fmt.Errorf("%s records the keys herd trusts, use herd hostkeys accept to change it", file)
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	engine, executor, err := scanKeys(args, splitAt, true)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	hosts := herd.Hosts{}
+	for _, host := range engine.Runner.GetHosts() {
+		if len(executor.ScannedKeys(host)) == 0 {
+			logrus.Warnf("Unable to scan host keys of %s, keeping existing entries", host.Name)
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	if err = ssh.UpdateKnownHosts(file, hosts, executor.ScannedKeys, viper.GetBool("HashKnownHosts")); err != nil {
+		logrus.Errorf("Unable to update %s: %s", file, err)
+		return err
+	}
+	fmt.Printf("Updated the keys of %d hosts in %s\n", len(hosts), file)
+	return nil
+}
+
+func runHostKeysSshfp(cmd *cobra.Command, args []string) error {
+	splitAt := cmd.ArgsLenAtDash()
+	if splitAt != -1 {
+		return fmt.Errorf("Command provided, but hostkeys sshfp doesn't support that")
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	engine, _, err := scanKeys(args, splitAt, false)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	for _, host := range engine.Runner.GetHosts() {
+		for _, record := range ssh.SSHFPRecords(host, host.PublicKeys()) {
+			fmt.Println(record)
+		}
+	}
+	return nil
+}
+
+func runHostKeysPending(cmd *cobra.Command, args []string) error {
+	changes, err := ssh.NewKeyStore(currentUser.dataDir).Pending()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Printf("%s: %s\n", strings.Join(c.Names, ","), c)
+	}
+	return nil
+}
+
+func runHostKeysAccept(cmd *cobra.Command, args []string) error {
+	store := ssh.NewKeyStore(currentUser.dataDir)
+	changes, err := store.Pending()
+	if err != nil {
+		return err
+	}
+	accepted := []ssh.KeyChange{}
+	for _, c := range changes {
+		if matchesAny(args, c.Names) {
+			accepted = append(accepted, c)
+		}
+	}
+	if len(accepted) == 0 {
+		return fmt.Errorf("No pending changes for %s", strings.Join(args, ", "))
+	}
+	if err = store.Accept(accepted); err != nil {
+		return err
+	}
+	for _, c := range accepted {
+		fmt.Printf("Accepted %s: %s\n", strings.Join(c.Names, ","), c)
+	}
+	return nil
+}
+
+// Names in known_hosts files can include a port, globs only need to match
+// the host part
+func matchesAny(globs, names []string) bool {
+	for _, n := range names {
+		if h, _, err := net.SplitHostPort(n); err == nil {
+			n = strings.Trim(h, "[]")
+		}
+		for _, g := range globs {
+			if ok, _ := filepath.Match(g, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -7,11 +7,9 @@ import (
 	"time"
 
 	"github.com/seveas/herd/scripting"
-	"github.com/seveas/herd/ssh"
 	"github.com/seveas/readline"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var interactiveCmd = &cobra.Command{
@@ -36,7 +34,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetDuration("SshAgentTimeout"), *currentUser.user)
+	executor, err := newExecutor()
 	if err != nil {
 		return err
 	}
@@ -108,8 +106,11 @@ func (l *interactiveLoop) autoComplete() readline.AutoCompleter {
 		p("set",
 			p("Timeout"),
 			p("HostTimeout"),
+			p("SignalGrace"),
 			p("ConnectTimeout"),
 			p("Parallel"),
+			p("ParallelPer"),
+			p("NoTemplate"),
 			p("Output"),
 			p("LogLevel"),
 		),
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/seveas/herd"
+	"github.com/seveas/herd/scripting"
 	"github.com/seveas/herd/ssh"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,40 +38,60 @@ func runKeyScan(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	knownTypes := map[string]string{
-		"dsa":                 "ssh-dss",
-		"dss":                 "ssh-dss",
-		"ssh-dss":             "ssh-dss",
-		"rsa":                 "ssh-rsa",
-		"ssh-rsa":             "ssh-rsa",
-		"ecdsa":               "ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521",
-		"ecdsa-sha2-nistp256": "ecdsa-sha2-nistp256",
-		"ecdsa-sha2-nistp384": "ecdsa-sha2-nistp384",
-		"ecdsa-sha2-nistp521": "ecdsa-sha2-nistp521",
-		"ed25519":             "ssh-ed25519",
-		"ssh-ed25519":         "ssh-ed25519",
+	engine, _, err := scanKeys(args, splitAt, false)
+	if err != nil {
+		return err
 	}
+	defer engine.End()
+	template := `{{ $host := . }}{{ range $key := .PublicKeys -}}
+{{ $host.Name }}{{ if $host.Address }},{{ $host.Address }}{{ end }} {{ sshkey $key }}
+{{ end -}}
+`
+	engine.Ui.PrintHostList(engine.Runner.GetHosts(), herd.HostListOptions{Template: template})
+	return nil
+}
+
+var knownKeyTypes = map[string]string{
+	"dsa":                 "ssh-dss",
+	"dss":                 "ssh-dss",
+	"ssh-dss":             "ssh-dss",
+	"rsa":                 "ssh-rsa",
+	"ssh-rsa":             "ssh-rsa",
+	"ecdsa":               "ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521",
+	"ecdsa-sha2-nistp256": "ecdsa-sha2-nistp256",
+	"ecdsa-sha2-nistp384": "ecdsa-sha2-nistp384",
+	"ecdsa-sha2-nistp521": "ecdsa-sha2-nistp521",
+	"ed25519":             "ssh-ed25519",
+	"ssh-ed25519":         "ssh-ed25519",
+}
+
+// Scan the keys of all hosts selected on the command line, or all hosts if
+// none are selected. The caller must end the returned engine.
+func scanKeys(args []string, splitAt int, verify bool) (*scripting.ScriptEngine, *ssh.KeyScanExecutor, error) {
 	keyTypes := make([]string, 0)
 	for _, keyType := range viper.GetStringSlice("KeyType") {
-		if expandedKeyType, ok := knownTypes[keyType]; ok {
+		if expandedKeyType, ok := knownKeyTypes[keyType]; ok {
 			keyTypes = append(keyTypes, expandedKeyType)
 		} else {
-			return fmt.Errorf("Unknown public key type: %s", keyType)
+			return nil, nil, fmt.Errorf("Unknown public key type: %s", keyType)
 		}
 	}
 
 	executor, err := ssh.NewKeyScanExecutor(keyTypes, *currentUser.user)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if verify {
+		executor.EnableVerification()
 	}
 	engine, err := setupScriptEngine(executor)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer engine.End()
 	if err = engine.ParseCommandLine(args, splitAt); err != nil {
+		engine.End()
 		logrus.Error(err.Error())
-		return err
+		return nil, nil, err
 	}
 	engine.Execute()
 	if len(args) == 0 {
@@ -78,10 +99,5 @@ func runKeyScan(cmd *cobra.Command, args []string) error {
 		engine.Runner.AddHosts(hosts)
 	}
 	engine.Runner.Run("herd:keyscan", nil, nil)
-	template := `{{ $host := . }}{{ range $key := .PublicKeys -}}
-{{ $host.Name }}{{ if $host.Address }},{{ $host.Address }}{{ end }} {{ sshkey $key }}
-{{ end -}}
-`
-	engine.Ui.PrintHostList(engine.Runner.GetHosts(), herd.HostListOptions{Template: template})
-	return nil
+	return engine, executor, nil
 }
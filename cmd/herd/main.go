@@ -8,12 +8,17 @@ import (
 	"path/filepath"
 	"runtime/pprof"
 	"runtime/trace"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mgutz/ansi"
 	"github.com/seveas/herd"
+	"github.com/seveas/herd/local"
+	"github.com/seveas/herd/provider/plugin"
 	"github.com/seveas/herd/scripting"
+	"github.com/seveas/herd/ssh"
+	"github.com/seveas/herd/winrm"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -116,10 +121,13 @@ Providers: %s
 	rootCmd.PersistentFlags().DurationP("timeout", "t", 60*time.Second, "Global timeout for commands")
 	rootCmd.PersistentFlags().Duration("load-timeout", 30*time.Second, "Timeout for loading host data from providers")
 	rootCmd.PersistentFlags().Duration("host-timeout", 10*time.Second, "Per-host timeout for commands")
+	rootCmd.PersistentFlags().Duration("signal-grace", 5*time.Second, "How long interrupted commands get to exit before they are killed")
 	rootCmd.PersistentFlags().Duration("connect-timeout", 3*time.Second, "Per-host ssh connect timeout")
 	rootCmd.PersistentFlags().Duration("ssh-agent-timeout", defaultAgentTimeout, "SSH agent timeout when checking functionality")
+	rootCmd.PersistentFlags().Bool("ssh-forwards", false, "Forward the ssh agent and ports as configured in the ssh config or in host attributes")
 	rootCmd.PersistentFlags().IntP("parallel", "p", 0, "Maximum number of hosts to run on in parallel")
-	rootCmd.PersistentFlags().StringP("output", "o", "all", "When to print command output (all at once, per host or per line)")
+	rootCmd.PersistentFlags().StringSlice("parallel-per", []string{}, "Maximum number of hosts to run on in parallel per attribute value, e.g. site=5,rack=1")
+	rootCmd.PersistentFlags().StringP("output", "o", "all", "When to print command output (all at once, per host, per line or in a live dashboard)")
 	rootCmd.PersistentFlags().Bool("no-pager", false, "Disable the use of the pager")
 	rootCmd.PersistentFlags().Bool("no-color", false, "Disable the use of the colors in the output")
 	rootCmd.PersistentFlags().StringP("loglevel", "l", "INFO", "Log level")
@@ -127,13 +135,18 @@ Providers: %s
 	rootCmd.PersistentFlags().Bool("timestamp", false, "In tail mode, prefix each line with the current time")
 	rootCmd.PersistentFlags().String("profile", "", "Write profiling and tracing data to files starting with this name")
 	rootCmd.PersistentFlags().Bool("refresh", false, "Force caches to be refreshed")
+	rootCmd.PersistentFlags().Bool("no-template", false, "Do not treat commands as templates, for commands that contain literal {{ and }}")
+	rootCmd.PersistentFlags().String("transport", "ssh", "How to run commands on hosts without a herd_transport attribute (ssh, winrm, local, docker, podman, kubectl)")
 	viper.BindPFlag("Splay", rootCmd.PersistentFlags().Lookup("splay"))
 	viper.BindPFlag("Timeout", rootCmd.PersistentFlags().Lookup("timeout"))
 	viper.BindPFlag("LoadTimeout", rootCmd.PersistentFlags().Lookup("load-timeout"))
 	viper.BindPFlag("HostTimeout", rootCmd.PersistentFlags().Lookup("host-timeout"))
+	viper.BindPFlag("SignalGrace", rootCmd.PersistentFlags().Lookup("signal-grace"))
 	viper.BindPFlag("ConnectTimeout", rootCmd.PersistentFlags().Lookup("connect-timeout"))
 	viper.BindPFlag("SshAgentTimeout", rootCmd.PersistentFlags().Lookup("ssh-agent-timeout"))
+	viper.BindPFlag("SshForwards", rootCmd.PersistentFlags().Lookup("ssh-forwards"))
 	viper.BindPFlag("Parallel", rootCmd.PersistentFlags().Lookup("parallel"))
+	viper.BindPFlag("ParallelPer", rootCmd.PersistentFlags().Lookup("parallel-per"))
 	viper.BindPFlag("Output", rootCmd.PersistentFlags().Lookup("output"))
 	viper.BindPFlag("LogLevel", rootCmd.PersistentFlags().Lookup("loglevel"))
 	viper.BindPFlag("Sort", rootCmd.PersistentFlags().Lookup("sort"))
@@ -142,6 +155,8 @@ Providers: %s
 	viper.BindPFlag("Timestamp", rootCmd.PersistentFlags().Lookup("timestamp"))
 	viper.BindPFlag("Profile", rootCmd.PersistentFlags().Lookup("profile"))
 	viper.BindPFlag("Refresh", rootCmd.PersistentFlags().Lookup("refresh"))
+	viper.BindPFlag("NoTemplate", rootCmd.PersistentFlags().Lookup("no-template"))
+	viper.BindPFlag("Transport", rootCmd.PersistentFlags().Lookup("transport"))
 }
 
 func initConfig() {
@@ -169,14 +184,15 @@ func initConfig() {
 		ansi.DisableColors(true)
 	}
 	outputModes := map[string]herd.OutputMode{
-		"all":      herd.OutputAll,
-		"inline":   herd.OutputInline,
-		"per-host": herd.OutputPerhost,
-		"tail":     herd.OutputTail,
+		"all":       herd.OutputAll,
+		"inline":    herd.OutputInline,
+		"per-host":  herd.OutputPerhost,
+		"tail":      herd.OutputTail,
+		"dashboard": herd.OutputDashboard,
 	}
 	om, ok := outputModes[viper.GetString("Output")]
 	if !ok {
-		bail("Unknown output mode: %s. Known modes: all, inline, per-host, tail", viper.GetString("Output"))
+		bail("Unknown output mode: %s. Known modes: all, inline, per-host, tail, dashboard", viper.GetString("Output"))
 	}
 	viper.Set("Output", om)
 }
@@ -186,26 +202,183 @@ func bail(format string, args ...interface{}) {
 	os.Exit(1)
 }
 
-func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error) {
-	ui := herd.NewSimpleUI()
-	ui.SetOutputMode(viper.Get("Output").(herd.OutputMode))
-	ui.SetOutputTimestamp(viper.GetBool("Timestamp"))
-	ui.SetPagerEnabled(!viper.GetBool("NoPager"))
-	ui.BindLogrus()
+// Set up an executor that can use all transports we know about. The ssh
+// transport is only mandatory when it is the default, as it needs a working
+// ssh agent.
+func newExecutor() (herd.Executor, error) {
+	transport := viper.GetString("Transport")
+	executor := herd.NewMultiExecutor("herd_transport", transport)
+	sshExecutor, err := ssh.NewExecutor(viper.GetDuration("SshAgentTimeout"), *currentUser.user)
+	if err == nil {
+		sshExecutor.SetKeyStore(ssh.NewKeyStore(currentUser.dataDir))
+		sshExecutor.SetForwards(viper.GetBool("SshForwards"))
+		executor.AddExecutor("ssh", sshExecutor)
+	} else if transport == "ssh" {
+		return nil, err
+	} else {
+		logrus.Debugf("ssh transport not available: %s", err)
+	}
+	executor.AddExecutor("local", local.NewExecutor())
+	executor.AddExecutor("docker", local.NewDockerExecutor())
+	executor.AddExecutor("podman", local.NewPodmanExecutor())
+	executor.AddExecutor("kubectl", local.NewKubectlExecutor())
+	winrmExecutor := winrm.NewExecutor()
+	if conf := viper.Sub("Executors.winrm"); conf != nil {
+		conf, _, err := herd.ResolveSecrets(conf)
+		if err == nil {
+			err = winrmExecutor.ParseViper(conf)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to configure executor winrm: %s", err)
+		}
+	}
+	executor.AddExecutor("winrm", winrmExecutor)
+	if err := addPluginExecutors(executor); err != nil {
+		return nil, err
+	}
+	// Rules only pick a transport when none was chosen explicitly
+	var rules []herd.TransportRule
+	if err := viper.UnmarshalKey("TransportRules", &rules); err != nil {
+		return nil, fmt.Errorf("Unable to parse transport rules: %s", err)
+	}
+	if len(rules) > 0 && viper.IsSet("Transport") {
+		logrus.Debugf("Ignoring transport rules, the %s transport was chosen explicitly", transport)
+		rules = nil
+	}
+	for _, rule := range rules {
+		executor.AddRule(rule)
+	}
+	if transport != "ssh" {
+		if !exists(executor.Executors(), transport) {
+			return nil, fmt.Errorf("Unknown transport: %s", transport)
+		}
+	}
+	return executor, nil
+}
+
+// Executor plugins found in $PATH are available as transports, as are the ones
+// configured in the Executors section of the configuration.
+func addPluginExecutors(executor *herd.MultiExecutor) error {
+	names := plugin.Discover("executor")
+	conf := viper.Sub("Executors")
+	if conf != nil {
+		for name := range conf.AllSettings() {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if exists(executor.Executors(), name) {
+			logrus.Debugf("Not replacing the %s transport with a plugin", name)
+			continue
+		}
+		e := plugin.NewExecutor(name)
+		if conf != nil && conf.Sub(name) != nil {
+			sub, _, err := herd.ResolveSecrets(conf.Sub(name))
+			if err == nil {
+				err = e.ParseViper(sub)
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to configure executor %s: %s", name, err)
+			}
+		}
+		executor.AddExecutor(name, e)
+	}
+	return nil
+}
+
+func exists(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Sinks are only used when configured, as they get to see all output
+func addSinks(engine *scripting.ScriptEngine) error {
+	conf := viper.Sub("Sinks")
+	if conf == nil {
+		return nil
+	}
+	names := []string{}
+	for name := range conf.AllSettings() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := plugin.NewSink(name)
+		if sub := conf.Sub(name); sub != nil {
+			sub, _, err := herd.ResolveSecrets(sub)
+			if err == nil {
+				err = s.ParseViper(sub)
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to configure sink %s: %s", name, err)
+			}
+		}
+		engine.AddSink(name, s)
+	}
+	return nil
+}
 
+func setupRegistry() (*herd.Registry, error) {
 	registry := herd.NewRegistry(currentUser.dataDir, currentUser.cacheDir)
 	conf := viper.Sub("Providers")
 	if conf != nil {
 		if err := registry.LoadProviders(conf); err != nil {
 			logrus.Error(err.Error())
-			ui.End()
 			return nil, err
 		}
 	}
 	registry.LoadMagicProviders()
+	var rules []herd.AttributeRule
+	if err := viper.UnmarshalKey("AttributeRules", &rules); err != nil {
+		logrus.Errorf("Unable to parse attribute rules: %s", err)
+		return nil, err
+	}
+	if err := registry.SetAttributeRules(rules); err != nil {
+		logrus.Error(err.Error())
+		return nil, err
+	}
+	registry.SetIdentityKeys(viper.GetStringSlice("IdentityKeys"))
 	if viper.GetBool("Refresh") {
 		registry.InvalidateCache()
 	}
+	return registry, nil
+}
+
+// Concurrency limits per attribute can be given as attribute=limit strings on
+// the command line, or as a map of attributes to limits in the configuration.
+func parallelPerLimits() (map[string]int, error) {
+	if m, ok := viper.Get("ParallelPer").(map[string]interface{}); ok {
+		specs := make([]string, 0, len(m))
+		for attr, limit := range m {
+			specs = append(specs, fmt.Sprintf("%s=%v", attr, limit))
+		}
+		return herd.ParseParallelPer(specs)
+	}
+	return herd.ParseParallelPer(viper.GetStringSlice("ParallelPer"))
+}
+
+func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error) {
+	ui := herd.NewSimpleUI()
+	ui.SetOutputMode(viper.Get("Output").(herd.OutputMode))
+	ui.SetOutputTimestamp(viper.GetBool("Timestamp"))
+	ui.SetPagerEnabled(!viper.GetBool("NoPager"))
+	ui.BindLogrus()
+
+	parallelPer, err := parallelPerLimits()
+	if err != nil {
+		logrus.Error(err.Error())
+		ui.End()
+		return nil, err
+	}
+	registry, err := setupRegistry()
+	if err != nil {
+		ui.End()
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("LoadTimeout"))
 	defer cancel()
 	if err := registry.LoadHosts(ctx, ui.LoadingMessage); err != nil {
@@ -218,8 +391,18 @@ func setupScriptEngine(executor herd.Executor) (*scripting.ScriptEngine, error)
 	runner.SetSortFields(viper.GetStringSlice("Sort"))
 	runner.SetSplay(viper.GetDuration("Splay"))
 	runner.SetParallel(viper.GetInt("Parallel"))
+	runner.SetParallelPer(parallelPer)
 	runner.SetTimeout(viper.GetDuration("Timeout"))
 	runner.SetHostTimeout(viper.GetDuration("HostTimeout"))
+	runner.SetSignalGrace(viper.GetDuration("SignalGrace"))
+	runner.SetNoTemplate(viper.GetBool("NoTemplate"))
 	runner.SetConnectTimeout(viper.GetDuration("ConnectTimeout"))
-	return scripting.NewScriptEngine(ui, registry, runner), nil
+	runner.SetCheckpointDir(currentUser.historyDir)
+	engine := scripting.NewScriptEngine(ui, registry, runner)
+	if err := addSinks(engine); err != nil {
+		logrus.Error(err.Error())
+		engine.End()
+		return nil, err
+	}
+	return engine, nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "Show all providers and how they fared when loading hosts",
+	Long: `Show all providers and how they fared when loading hosts
+
+All configured and automatically detected providers are loaded, after which
+their type, host count, load duration, cache age and errors are shown.
+Plugins that describe their configuration also have that shown.`,
+	Args:                  cobra.NoArgs,
+	RunE:                  runProviders,
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	rootCmd.AddCommand(providersCmd)
+}
+
+func runProviders(cmd *cobra.Command, args []string) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	ui := herd.NewSimpleUI()
+	ui.BindLogrus()
+	registry, err := setupRegistry()
+	if err != nil {
+		ui.End()
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("LoadTimeout"))
+	defer cancel()
+	// Errors are logged while loading, and shown per provider below
+	registry.LoadHosts(ctx, ui.LoadingMessage)
+	ui.Sync()
+	registry.End()
+	ui.End()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "name\ttype\tflags\thosts\tload time\tcache age\terror")
+	for _, s := range registry.ProviderStatus() {
+		flags := []string{}
+		if s.Magic {
+			flags = append(flags, "magic")
+		}
+		if s.Optional {
+			flags = append(flags, "optional")
+		}
+		if s.Cached {
+			flags = append(flags, "cached")
+		}
+		age := "-"
+		if s.Cached {
+			age = s.CacheAge.Truncate(time.Second).String()
+		}
+		errmsg := ""
+		if s.Error != nil {
+			errmsg = s.Error.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", s.Name, s.Type, strings.Join(flags, ","), s.Hosts, s.Duration.Round(time.Millisecond), age, errmsg)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, s := range registry.ProviderStatus() {
+		if s.Documentation != "" {
+			fmt.Printf("\n%s (%s)\n%s", s.Name, s.Type, s.Documentation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [run-id]",
+	Short: "Resume an interrupted run on the hosts that did not finish successfully",
+	Long: `Resume an interrupted run on the hosts that did not finish successfully
+
+The command is run with the same settings as the original run, on all hosts
+that did not successfully run the command. Without a run id, all runs that can
+be resumed are listed.`,
+	Args:                  cobra.MaximumNArgs(1),
+	RunE:                  runResume,
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
+
+func runResume(cmd *cobra.Command, args []string) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	if len(args) == 0 {
+		return listCheckpoints()
+	}
+	cp, err := herd.LoadCheckpoint(currentUser.historyDir, args[0])
+	if err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	if len(cp.Pending()) == 0 {
+		logrus.Infof("All hosts in run %s finished successfully, nothing to resume", cp.Id)
+		return nil
+	}
+
+	executor, err := newExecutor()
+	if err != nil {
+		return err
+	}
+	engine, err := setupScriptEngine(executor)
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	fn := filepath.Join(currentUser.historyDir, time.Now().Format("2006-01-02_150405.json"))
+	engine.Resume(cp)
+	engine.Execute()
+	return engine.History.Save(fn)
+}
+
+func listCheckpoints() error {
+	checkpoints, err := herd.ListCheckpoints(currentUser.historyDir)
+	if err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	found := false
+	for _, cp := range checkpoints {
+		pending := len(cp.Pending())
+		if pending == 0 {
+			continue
+		}
+		state := "interrupted"
+		if cp.Finished {
+			state = "finished"
+		}
+		fmt.Printf("%s  %s  %-11s  %d/%d hosts pending  %s\n", cp.Id, cp.StartTime.Format("2006-01-02 15:04:05"), state, pending, len(cp.Hosts), cp.Command)
+		found = true
+	}
+	if !found {
+		logrus.Info("No runs to resume")
+	}
+	return nil
+}
@@ -3,12 +3,11 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/seveas/herd/ssh"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var runCmd = &cobra.Command{
@@ -31,7 +30,7 @@ func runCommand(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetDuration("SshAgentTimeout"), *currentUser.user)
+	executor, err := newExecutor()
 	if err != nil {
 		return err
 	}
@@ -46,5 +45,10 @@ func runCommand(cmd *cobra.Command, args []string) error {
 	}
 	fn := filepath.Join(currentUser.historyDir, time.Now().Format("2006-01-02_150405.json"))
 	engine.Execute()
+	for _, hi := range engine.History {
+		if hi.Summary.Fail+hi.Summary.Err > 0 && !strings.HasPrefix(hi.Command, "herd:") {
+			logrus.Infof("To retry the hosts that did not succeed, use: herd resume %s", hi.Id)
+		}
+	}
 	return engine.History.Save(fn)
 }
@@ -5,10 +5,8 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/seveas/herd/ssh"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var runScriptCmd = &cobra.Command{
@@ -45,7 +43,7 @@ func runScript(cmd *cobra.Command, args []string) error {
 	cmd.SilenceErrors = true
 	cmd.SilenceUsage = true
 
-	executor, err := ssh.NewExecutor(viper.GetDuration("SshAgentTimeout"), *currentUser.user)
+	executor, err := newExecutor()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/ssh"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel [options] glob [filters] [<+|-> glob [filters]...]",
+	Short: "Open a local port for every host, forwarded to a port on that host",
+	Long: `Open a local port for every host, forwarded to a port on that host or to an
+address reachable from it. The local addresses are listed when all tunnels are
+set up and the tunnels stay open until herd is interrupted.`,
+	Example:               "  herd tunnel --port 9100 *.site2.example.com os=Debian",
+	DisableFlagsInUseLine: true,
+	RunE:                  runTunnel,
+}
+
+func init() {
+	tunnelCmd.Flags().String("port", "", "The port to forward to, or a host:port combination reachable from the selected hosts")
+	rootCmd.AddCommand(tunnelCmd)
+}
+
+func runTunnel(cmd *cobra.Command, args []string) error {
+	splitAt := cmd.ArgsLenAtDash()
+	if splitAt != -1 {
+		return fmt.Errorf("Command provided, but tunnel mode doesn't support that")
+	}
+	target, _ := cmd.Flags().GetString("port")
+	if target == "" {
+		return fmt.Errorf("No port to forward to specified")
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	sshExecutor, err := ssh.NewExecutor(viper.GetDuration("SshAgentTimeout"), *currentUser.user)
+	if err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	sshExecutor.SetKeyStore(ssh.NewKeyStore(currentUser.dataDir))
+	sshExecutor.SetForwards(viper.GetBool("SshForwards"))
+	engine, err := setupScriptEngine(ssh.NewTunnelExecutor(sshExecutor, target))
+	if err != nil {
+		return err
+	}
+	defer engine.End()
+	if err = engine.ParseCommandLine(args, splitAt); err != nil {
+		logrus.Error(err.Error())
+		return err
+	}
+	engine.Execute()
+	engine.Runner.Run("herd:tunnel", nil, nil)
+
+	hosts := herd.Hosts{}
+	for _, host := range engine.Runner.GetHosts() {
+		if _, ok := host.Attributes["herd_tunnel"]; ok {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		err = fmt.Errorf("Unable to open any tunnels")
+		logrus.Error(err.Error())
+		return err
+	}
+	engine.Ui.PrintHostList(hosts, herd.HostListOptions{Attributes: []string{"herd_tunnel"}, Align: true, Header: true})
+	engine.Ui.Sync()
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sc)
+	<-sc
+	logrus.Info("Closing tunnels")
+	return nil
+}
@@ -0,0 +1,482 @@
+package herd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgutz/ansi"
+	"github.com/seveas/readline"
+	"github.com/sirupsen/logrus"
+)
+
+// The dashboard is a full-screen terminal interface that shows the state of
+// all hosts in a run, and lets the user look at the output of a single host
+// and cancel hosts while the run is in progress.
+type dashboard struct {
+	ui           *SimpleUI
+	runner       *Runner
+	hosts        []*dashboardHost
+	byName       map[string]*dashboardHost
+	hlen         int
+	lock         sync.Mutex
+	start        time.Time
+	selected     int
+	offset       int
+	detail       *dashboardHost
+	detailOffset int
+	logs         []string
+	tty          *os.File
+	state        *readline.State
+	stopped      bool
+	redraw       chan bool
+	stop         chan bool
+	done         chan bool
+}
+
+type dashboardHost struct {
+	host     *Host
+	state    ProgressState
+	started  time.Time
+	result   *Result
+	canceled bool
+	output   []dashboardLine
+}
+
+type dashboardLine struct {
+	stderr bool
+	text   string
+}
+
+var controlSequence = regexp.MustCompile("\033\\[[0-9;?]*[a-zA-Z]")
+
+func newDashboard(ui *SimpleUI, r *Runner) (*dashboard, error) {
+	tty, err := openTTY()
+	if err != nil {
+		return nil, err
+	}
+	state, err := makeRaw(tty)
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+	d := &dashboard{
+		ui:     ui,
+		runner: r,
+		hosts:  make([]*dashboardHost, len(r.hosts)),
+		byName: make(map[string]*dashboardHost),
+		hlen:   r.hosts.maxLen(),
+		start:  time.Now(),
+		tty:    tty,
+		state:  state,
+		redraw: make(chan bool, 1),
+		stop:   make(chan bool),
+		done:   make(chan bool),
+	}
+	for i, host := range r.hosts {
+		d.hosts[i] = &dashboardHost{host: host, state: Queued}
+		d.byName[host.Name] = d.hosts[i]
+	}
+	// Switch to the alternate screen and hide the cursor
+	ui.output.WriteString("\033[?1049h\033[?25l")
+	go d.readKeys()
+	go d.drawLoop()
+	return d, nil
+}
+
+func (d *dashboard) progress(msg ProgressMessage) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	h, ok := d.byName[msg.Host.Name]
+	if !ok {
+		return
+	}
+	h.state = msg.State
+	switch msg.State {
+	case Running:
+		h.started = time.Now()
+	case Finished:
+		h.result = msg.Result
+	}
+	d.requestRedraw()
+}
+
+func (d *dashboard) output(msg OutputLine) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	h, ok := d.byName[msg.Host.Name]
+	if !ok {
+		return
+	}
+	line := bytes.TrimRight(msg.Data, "\r\n")
+	if idx := bytes.LastIndex(line, []byte("\r")); idx != -1 {
+		line = line[idx+1:]
+	}
+	line = controlSequence.ReplaceAll(line, []byte{})
+	h.output = append(h.output, dashboardLine{stderr: msg.Stderr, text: strings.ReplaceAll(string(line), "\t", "    ")})
+	d.requestRedraw()
+}
+
+func (d *dashboard) log(msg string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.logs = append(d.logs, strings.TrimRight(msg, "\n"))
+	d.requestRedraw()
+}
+
+func (d *dashboard) requestRedraw() {
+	select {
+	case d.redraw <- true:
+	default:
+	}
+}
+
+func (d *dashboard) end() {
+	close(d.stop)
+	d.lock.Lock()
+	d.stopped = true
+	d.tty.SetReadDeadline(time.Now())
+	restoreTerminal(d.tty, d.state)
+	d.tty.Close()
+	d.ui.output.WriteString("\033[?25h\033[?1049l")
+	d.lock.Unlock()
+	d.ui.dashboardLock.Lock()
+	d.ui.dashboard = nil
+	d.ui.dashboardLock.Unlock()
+	// Now that we're back on the normal screen, show what was logged
+	for _, msg := range d.logs {
+		d.ui.pchan <- msg + "\n"
+	}
+	close(d.done)
+}
+
+func (d *dashboard) drawLoop() {
+	ticker := time.NewTicker(time.Second / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.redraw:
+		}
+		d.draw()
+	}
+}
+
+func (d *dashboard) draw() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.stopped {
+		return
+	}
+	width, height := d.ui.width, d.ui.height
+	if height < 5 {
+		height = 5
+	}
+	var lines []string
+	if d.detail != nil {
+		lines = d.detailView(width, height)
+	} else {
+		lines = d.listView(width, height)
+	}
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line + "\033[0m\033[K")
+	}
+	b.WriteString("\033[J")
+	d.ui.output.WriteString(b.String())
+}
+
+func (d *dashboard) summary() string {
+	queued, waiting, running, ok, fail, errors := 0, 0, 0, 0, 0, 0
+	for _, h := range d.hosts {
+		switch h.state {
+		case Queued:
+			queued++
+		case Waiting:
+			waiting++
+		case Running:
+			running++
+		case Finished:
+			switch h.result.ExitStatus {
+			case -1:
+				errors++
+			case 0:
+				ok++
+			default:
+				fail++
+			}
+		}
+	}
+	since := time.Since(d.start).Truncate(time.Second)
+	return fmt.Sprintf("%s/%s  %d/%d done, %d queued, %d waiting, %d running, %d ok, %d fail, %d error",
+		since, d.runner.timeout, ok+fail+errors, len(d.hosts), queued, waiting, running, ok, fail, errors)
+}
+
+func (h *dashboardHost) status() (string, string) {
+	switch h.state {
+	case Queued:
+		if h.canceled {
+			return "canceling", "yellow"
+		}
+		return "queued", "black+h"
+	case Waiting:
+		if h.canceled {
+			return "canceling", "yellow"
+		}
+		return "waiting", "black+h"
+	case Running:
+		if h.canceled {
+			return "canceling", "yellow"
+		}
+		return "running", "cyan"
+	}
+	if h.canceled {
+		return "canceled", "yellow"
+	}
+	if h.result.Err != nil {
+		return "finished", "red"
+	}
+	return "finished", "green"
+}
+
+func (h *dashboardHost) elapsed() time.Duration {
+	switch h.state {
+	case Running:
+		return time.Since(h.started).Truncate(time.Second)
+	case Finished:
+		return h.result.EndTime.Sub(h.result.StartTime).Truncate(time.Second)
+	}
+	return 0
+}
+
+func (h *dashboardHost) exitStatus() string {
+	if h.state != Finished {
+		return ""
+	}
+	if h.result.Err != nil && h.result.ExitStatus == -1 {
+		return "err"
+	}
+	return fmt.Sprintf("%d", h.result.ExitStatus)
+}
+
+func (h *dashboardHost) lastLine() string {
+	if h.state == Finished && h.result.Err != nil && h.result.ExitStatus == -1 {
+		return h.result.Err.Error()
+	}
+	if len(h.output) == 0 {
+		return ""
+	}
+	return h.output[len(h.output)-1].text
+}
+
+func (d *dashboard) listView(width, height int) []string {
+	lines := []string{
+		ansi.Color(truncate(" herd  "+d.summary(), width, true), "white+b:blue"),
+		ansi.Color(truncate(fmt.Sprintf("%-*s  %-9s  %8s  %4s  %s", d.hlen, "HOST", "STATE", "ELAPSED", "EXIT", "OUTPUT"), width, false), "+b"),
+	}
+	rows := height - 3
+	if d.selected >= len(d.hosts) {
+		d.selected = len(d.hosts) - 1
+	}
+	if d.selected < d.offset {
+		d.offset = d.selected
+	}
+	if d.selected >= d.offset+rows {
+		d.offset = d.selected - rows + 1
+	}
+	for i := d.offset; i < len(d.hosts) && i < d.offset+rows; i++ {
+		h := d.hosts[i]
+		state, color := h.status()
+		elapsed := ""
+		if e := h.elapsed(); h.state == Running || h.state == Finished {
+			elapsed = e.String()
+		}
+		row := truncate(fmt.Sprintf("%-*s  %-9s  %8s  %4s  %s", d.hlen, h.host.Name, state, elapsed, h.exitStatus(), h.lastLine()), width, i == d.selected)
+		if i == d.selected {
+			color += "+r"
+		}
+		lines = append(lines, ansi.Color(row, color))
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	return append(lines, d.footer(width, "↑/↓ select  enter show output  c cancel host  ^C interrupt run"))
+}
+
+func (d *dashboard) detailView(width, height int) []string {
+	h := d.detail
+	state, _ := h.status()
+	header := fmt.Sprintf(" %s  %s", h.host.Name, state)
+	if e := h.elapsed(); h.state == Running || h.state == Finished {
+		header += "  " + e.String()
+	}
+	if es := h.exitStatus(); es != "" {
+		header += "  exit " + es
+	}
+	lines := []string{ansi.Color(truncate(header, width, true), "white+b:blue")}
+	rows := height - 2
+	output := h.output
+	if h.state == Finished && h.result.Err != nil && h.result.ExitStatus == -1 {
+		output = append(output[:len(output):len(output)], dashboardLine{stderr: true, text: h.result.Err.Error()})
+	}
+	maxOffset := len(output) - rows
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	if d.detailOffset > maxOffset {
+		d.detailOffset = maxOffset
+	}
+	end := len(output) - d.detailOffset
+	start := end - rows
+	if start < 0 {
+		start = 0
+	}
+	for _, line := range output[start:end] {
+		if line.stderr {
+			lines = append(lines, ansi.Color(truncate(line.text, width, false), "red"))
+		} else {
+			lines = append(lines, truncate(line.text, width, false))
+		}
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	help := "↑/↓ scroll  f follow  c cancel host  esc back  ^C interrupt run"
+	if d.detailOffset == 0 {
+		help = "↑/↓ scroll  c cancel host  esc back  ^C interrupt run  [following]"
+	}
+	return append(lines, d.footer(width, help))
+}
+
+func (d *dashboard) footer(width int, help string) string {
+	if len(d.logs) > 0 {
+		return ansi.Color(truncate(d.logs[len(d.logs)-1], width, false), "yellow")
+	}
+	return ansi.Color(truncate(help, width, false), "black+h")
+}
+
+// Cut a string to the terminal width, optionally padding it so inverse video
+// covers the whole line.
+func truncate(s string, width int, pad bool) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	if pad {
+		return s + strings.Repeat(" ", width-len(r))
+	}
+	return s
+}
+
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := d.tty.Read(buf)
+		if err != nil {
+			select {
+			case <-d.stop:
+			default:
+				logrus.Debugf("Unable to read from terminal: %s", err)
+			}
+			return
+		}
+		d.handleKey(string(buf[:n]))
+	}
+}
+
+const (
+	keyUp       = "\033[A"
+	keyDown     = "\033[B"
+	keyRight    = "\033[C"
+	keyLeft     = "\033[D"
+	keyHome     = "\033[H"
+	keyEnd      = "\033[F"
+	keyPageUp   = "\033[5~"
+	keyPageDown = "\033[6~"
+	keyEscape   = "\033"
+	keyCtrlC    = "\003"
+)
+
+func (d *dashboard) handleKey(key string) {
+	if key == keyCtrlC {
+		interruptSelf()
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	defer d.requestRedraw()
+	if len(d.hosts) == 0 {
+		return
+	}
+	page := d.ui.height - 3
+	if d.detail != nil {
+		switch key {
+		case keyEscape, keyLeft, "q", "h":
+			d.detail = nil
+		case keyUp, "k":
+			d.detailOffset++
+		case keyDown, "j":
+			if d.detailOffset > 0 {
+				d.detailOffset--
+			}
+		case keyPageUp:
+			d.detailOffset += page
+		case keyPageDown:
+			d.detailOffset -= page
+			if d.detailOffset < 0 {
+				d.detailOffset = 0
+			}
+		case keyHome, "g":
+			d.detailOffset = len(d.detail.output)
+		case keyEnd, "f", "G":
+			d.detailOffset = 0
+		case "c":
+			d.cancel(d.detail)
+		}
+		return
+	}
+	switch key {
+	case keyUp, "k":
+		d.selected--
+	case keyDown, "j":
+		d.selected++
+	case keyPageUp:
+		d.selected -= page
+	case keyPageDown:
+		d.selected += page
+	case keyHome, "g":
+		d.selected = 0
+	case keyEnd, "G":
+		d.selected = len(d.hosts) - 1
+	case "\r", "\n", keyRight, "l":
+		d.detail = d.hosts[d.selected]
+		d.detailOffset = 0
+	case "c":
+		d.cancel(d.hosts[d.selected])
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+	if d.selected >= len(d.hosts) {
+		d.selected = len(d.hosts) - 1
+	}
+}
+
+func (d *dashboard) cancel(h *dashboardHost) {
+	if h.state == Finished || h.canceled {
+		return
+	}
+	if d.runner.CancelHost(h.host.Name) {
+		h.canceled = true
+	}
+}
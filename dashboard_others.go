@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package herd
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/seveas/readline"
+)
+
+// We read keys from the terminal directly instead of from stdin, so we can
+// stop reading when the dashboard is closed without stealing input from
+// whatever comes next.
+func openTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// Using Fd() would put the file in blocking mode, which means we can no longer
+// interrupt reads, so we use the raw connection instead.
+func makeRaw(tty *os.File) (state *readline.State, err error) {
+	rc, err := tty.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	cerr := rc.Control(func(fd uintptr) {
+		state, err = readline.MakeRaw(int(fd))
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	return state, err
+}
+
+func restoreTerminal(tty *os.File, state *readline.State) {
+	if rc, err := tty.SyscallConn(); err == nil {
+		rc.Control(func(fd uintptr) {
+			readline.Restore(int(fd), state)
+		})
+	}
+}
+
+// In raw mode, ^C does not generate a signal, so we do that ourselves
+func interruptSelf() {
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+}
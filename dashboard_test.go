@@ -0,0 +1,83 @@
+package herd
+
+import (
+	"testing"
+)
+
+func testDashboard() *dashboard {
+	hosts := Hosts{
+		NewHost("host-1.example.com", "", HostAttributes{}),
+		NewHost("host-2.example.com", "", HostAttributes{}),
+	}
+	d := &dashboard{
+		ui:     &SimpleUI{width: 80, height: 10},
+		runner: NewRunner(&fakeExecutor{}),
+		byName: make(map[string]*dashboardHost),
+		redraw: make(chan bool, 1),
+	}
+	for _, host := range hosts {
+		h := &dashboardHost{host: host, state: Queued}
+		d.hosts = append(d.hosts, h)
+		d.byName[host.Name] = h
+	}
+	return d
+}
+
+func TestDashboardOutput(t *testing.T) {
+	d := testDashboard()
+	host := d.hosts[0].host
+	d.output(OutputLine{Host: host, Data: []byte("\033[1;31mred\033[0m\tcolumn\r\n")})
+	d.output(OutputLine{Host: host, Data: []byte("10%\r50%\r100%\n"), Stderr: true})
+	out := d.hosts[0].output
+	if len(out) != 2 {
+		t.Fatalf("Expected 2 lines of output, got %d", len(out))
+	}
+	if out[0].text != "red    column" || out[0].stderr {
+		t.Errorf("Control sequences were not stripped: %q", out[0].text)
+	}
+	if out[1].text != "100%" || !out[1].stderr {
+		t.Errorf("Carriage returns were not handled: %q", out[1].text)
+	}
+	if d.hosts[1].lastLine() != "" {
+		t.Errorf("Output ended up with the wrong host")
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	d := testDashboard()
+	d.handleKey(keyUp)
+	if d.selected != 0 {
+		t.Errorf("Selection moved above the first host")
+	}
+	d.handleKey(keyDown)
+	d.handleKey(keyDown)
+	if d.selected != 1 {
+		t.Errorf("Selection moved below the last host")
+	}
+	d.handleKey("\r")
+	if d.detail != d.hosts[1] {
+		t.Errorf("Enter did not show the selected host")
+	}
+	d.handleKey(keyEscape)
+	if d.detail != nil {
+		t.Errorf("Escape did not go back to the host list")
+	}
+	d.handleKey("c")
+	if d.hosts[1].canceled {
+		t.Errorf("A host that isn't part of a run should not be canceled")
+	}
+}
+
+func TestDashboardFallback(t *testing.T) {
+	ui := &SimpleUI{width: 80, height: 10}
+	ui.SetOutputMode(OutputDashboard)
+	if oc := ui.OutputChannel(NewRunner(&fakeExecutor{})); oc != nil {
+		t.Fatalf("Expected no output channel without a terminal")
+	}
+	if ui.runMode != OutputPerhost {
+		t.Errorf("Expected per-host output for this run, got %s", outputModeString[ui.runMode])
+	}
+	if ui.outputMode != OutputDashboard {
+		t.Errorf("Falling back should not change the output mode, got %s", outputModeString[ui.outputMode])
+	}
+}
@@ -0,0 +1,22 @@
+package herd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/seveas/readline"
+)
+
+func openTTY() (*os.File, error) {
+	return nil, errors.New("the dashboard is not supported on windows")
+}
+
+func makeRaw(tty *os.File) (*readline.State, error) {
+	return nil, errors.New("the dashboard is not supported on windows")
+}
+
+func restoreTerminal(tty *os.File, state *readline.State) {
+}
+
+func interruptSelf() {
+}
@@ -0,0 +1,109 @@
+package herd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A MultiExecutor picks an executor for each host based on the value of a
+// host attribute, falling back to a default executor for hosts that do not
+// have the attribute. This lets a single run target ssh servers, containers
+// and anything else there is an executor for.
+type MultiExecutor struct {
+	attribute       string
+	defaultExecutor string
+	executors       map[string]Executor
+	rules           []TransportRule
+	connectTimeout  time.Duration
+}
+
+// Hosts that don't specify a transport themselves can still get a transport
+// other than the default based on another attribute, e.g. os=windows. The
+// first matching rule wins, values are compared case-insensitively.
+type TransportRule struct {
+	Attribute string
+	Value     string
+	Transport string
+}
+
+func NewMultiExecutor(attribute, defaultExecutor string) *MultiExecutor {
+	return &MultiExecutor{
+		attribute:       attribute,
+		defaultExecutor: defaultExecutor,
+		executors:       make(map[string]Executor),
+	}
+}
+
+func (e *MultiExecutor) AddExecutor(name string, executor Executor) {
+	executor.SetConnectTimeout(e.connectTimeout)
+	e.executors[name] = executor
+}
+
+func (e *MultiExecutor) AddRule(rule TransportRule) {
+	e.rules = append(e.rules, rule)
+}
+
+func (e *MultiExecutor) Executors() []string {
+	ret := make([]string, 0, len(e.executors))
+	for k := range e.executors {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (e *MultiExecutor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+	for _, executor := range e.executors {
+		executor.SetConnectTimeout(t)
+	}
+}
+
+func (e *MultiExecutor) executorFor(host *Host) (Executor, error) {
+	name := ""
+	if v, ok := host.Attributes[e.attribute]; ok {
+		if s, ok := v.(string); ok && s != "" {
+			name = s
+		}
+	}
+	for _, rule := range e.rules {
+		if name != "" {
+			break
+		}
+		if v, ok := host.Attributes[rule.Attribute]; ok && strings.EqualFold(fmt.Sprintf("%v", v), rule.Value) {
+			name = rule.Transport
+		}
+	}
+	if name == "" {
+		name = e.defaultExecutor
+	}
+	executor, ok := e.executors[name]
+	if !ok {
+		return nil, fmt.Errorf("No such transport: %s", name)
+	}
+	return executor, nil
+}
+
+func (e *MultiExecutor) Run(ctx context.Context, host *Host, command string, oc chan OutputLine) *Result {
+	executor, err := e.executorFor(host)
+	if err != nil {
+		now := time.Now()
+		return &Result{Host: host, ExitStatus: -1, Err: err, StartTime: now, EndTime: now}
+	}
+	return executor.Run(ctx, host, command, oc)
+}
+
+// Executors that hold on to resources, such as plugin processes, release them
+// when they are ended.
+func (e *MultiExecutor) End() {
+	for _, executor := range e.executors {
+		if ender, ok := executor.(interface{ End() }); ok {
+			ender.End()
+		}
+	}
+}
+
+var _ Executor = &MultiExecutor{}
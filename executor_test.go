@@ -0,0 +1,85 @@
+package herd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeExecutor struct {
+	name     string
+	ran      []string
+	commands map[string]string
+	fail     map[string]bool
+	lock     sync.Mutex
+}
+
+func (e *fakeExecutor) SetConnectTimeout(t time.Duration) {
+}
+
+func (e *fakeExecutor) Run(ctx context.Context, host *Host, command string, oc chan OutputLine) *Result {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.ran = append(e.ran, host.Name)
+	if e.commands == nil {
+		e.commands = make(map[string]string)
+	}
+	e.commands[host.Name] = command
+	if e.fail[host.Name] {
+		return &Result{Host: host, ExitStatus: 1, Err: errors.New("Process exited with status 1")}
+	}
+	return &Result{Host: host, Stdout: []byte(e.name)}
+}
+
+func TestMultiExecutor(t *testing.T) {
+	ssh := &fakeExecutor{name: "ssh"}
+	docker := &fakeExecutor{name: "docker"}
+	e := NewMultiExecutor("herd_transport", "ssh")
+	e.AddExecutor("ssh", ssh)
+	e.AddExecutor("docker", docker)
+
+	hosts := Hosts{
+		NewHost("host-1", "", HostAttributes{}),
+		NewHost("container-1", "", HostAttributes{"herd_transport": "docker"}),
+		NewHost("other-1", "", HostAttributes{"herd_transport": "telnet"}),
+	}
+	for _, host := range hosts {
+		e.Run(context.Background(), host, "true", nil)
+	}
+	if len(ssh.ran) != 1 || ssh.ran[0] != "host-1" {
+		t.Errorf("Default executor was not used correctly: %v", ssh.ran)
+	}
+	if len(docker.ran) != 1 || docker.ran[0] != "container-1" {
+		t.Errorf("Executor was not selected by attribute: %v", docker.ran)
+	}
+	r := e.Run(context.Background(), hosts[2], "true", nil)
+	if r.Err == nil || r.ExitStatus != -1 {
+		t.Errorf("Unknown transports should result in an error")
+	}
+}
+
+func TestMultiExecutorRules(t *testing.T) {
+	ssh := &fakeExecutor{name: "ssh"}
+	winrm := &fakeExecutor{name: "winrm"}
+	e := NewMultiExecutor("herd_transport", "ssh")
+	e.AddExecutor("ssh", ssh)
+	e.AddExecutor("winrm", winrm)
+	e.AddRule(TransportRule{Attribute: "os", Value: "windows", Transport: "winrm"})
+
+	hosts := Hosts{
+		NewHost("linux-1", "", HostAttributes{"os": "linux"}),
+		NewHost("windows-1", "", HostAttributes{"os": "Windows"}),
+		NewHost("windows-2", "", HostAttributes{"os": "windows", "herd_transport": "ssh"}),
+	}
+	for _, host := range hosts {
+		e.Run(context.Background(), host, "true", nil)
+	}
+	if len(winrm.ran) != 1 || winrm.ran[0] != "windows-1" {
+		t.Errorf("Executor was not selected by rule: %v", winrm.ran)
+	}
+	if len(ssh.ran) != 2 || ssh.ran[0] != "linux-1" || ssh.ran[1] != "windows-2" {
+		t.Errorf("Rules should not override the transport attribute: %v", ssh.ran)
+	}
+}
@@ -2,6 +2,7 @@ package herd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -14,6 +15,7 @@ import (
 type History []*HistoryItem
 
 type HistoryItem struct {
+	Id      string
 	Hosts   Hosts
 	Command string
 	Results map[string]*Result
@@ -27,8 +29,15 @@ type HistoryItem struct {
 	ElapsedTime float64
 }
 
+// A sink receives every history item once a command has finished running on
+// all hosts, to store or forward the results.
+type Sink interface {
+	Record(*HistoryItem) error
+}
+
 type Result struct {
 	Host        *Host
+	Command     string
 	ExitStatus  int
 	Stdout      []byte
 	Stderr      []byte
@@ -39,11 +48,13 @@ type Result struct {
 }
 
 func newHistoryItem(command string, hosts Hosts) *HistoryItem {
+	now := time.Now()
 	return &HistoryItem{
+		Id:        newRunId(now),
 		Hosts:     hosts,
 		Command:   command,
 		Results:   make(map[string]*Result),
-		StartTime: time.Now(),
+		StartTime: now,
 	}
 }
 
@@ -53,9 +64,11 @@ func (h *HistoryItem) MarshalJSON() ([]byte, error) {
 		hosts[i] = h_.Name
 	}
 	r := map[string]interface{}{
+		"Id":          h.Id,
 		"Hosts":       hosts,
 		"Command":     h.Command,
 		"Results":     h.Results,
+		"Summary":     h.Summary,
 		"StartTime":   h.StartTime,
 		"EndTime":     h.EndTime,
 		"ElapsedTime": h.ElapsedTime,
@@ -63,6 +76,44 @@ func (h *HistoryItem) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r)
 }
 
+// Like results, history items refer to hosts by name only when read back.
+func (h *HistoryItem) UnmarshalJSON(data []byte) error {
+	var h_ struct {
+		Id          string
+		Hosts       []string
+		Command     string
+		Results     map[string]*Result
+		Summary     struct{ Ok, Fail, Err int }
+		StartTime   time.Time
+		EndTime     time.Time
+		ElapsedTime float64
+	}
+	if err := json.Unmarshal(data, &h_); err != nil {
+		return err
+	}
+	*h = HistoryItem{
+		Id:          h_.Id,
+		Hosts:       make(Hosts, len(h_.Hosts)),
+		Command:     h_.Command,
+		Results:     h_.Results,
+		StartTime:   h_.StartTime,
+		EndTime:     h_.EndTime,
+		ElapsedTime: h_.ElapsedTime,
+	}
+	h.Summary.Ok, h.Summary.Fail, h.Summary.Err = h_.Summary.Ok, h_.Summary.Fail, h_.Summary.Err
+	if h.Results == nil {
+		h.Results = make(map[string]*Result)
+	}
+	for i, name := range h_.Hosts {
+		if r, ok := h.Results[name]; ok {
+			h.Hosts[i] = r.Host
+		} else {
+			h.Hosts[i] = NewHost(name, "", HostAttributes{})
+		}
+	}
+	return nil
+}
+
 func (h *HistoryItem) end() {
 	h.EndTime = time.Now()
 	h.ElapsedTime = h.EndTime.Sub(h.StartTime).Seconds()
@@ -71,6 +122,7 @@ func (h *HistoryItem) end() {
 func (r Result) MarshalJSON() ([]byte, error) {
 	r_ := map[string]interface{}{
 		"Host":        r.Host.Name,
+		"Command":     r.Command,
 		"ExitStatus":  r.ExitStatus,
 		"Stdout":      string(r.Stdout),
 		"Stderr":      string(r.Stderr),
@@ -86,6 +138,39 @@ func (r Result) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r_)
 }
 
+// Results read back from a checkpoint refer to hosts by name only, and errors
+// only survive as their message.
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var r_ struct {
+		Host        string
+		Command     string
+		ExitStatus  int
+		Stdout      string
+		Stderr      string
+		ErrString   string
+		StartTime   time.Time
+		EndTime     time.Time
+		ElapsedTime float64
+	}
+	if err := json.Unmarshal(data, &r_); err != nil {
+		return err
+	}
+	*r = Result{
+		Host:        NewHost(r_.Host, "", HostAttributes{}),
+		Command:     r_.Command,
+		ExitStatus:  r_.ExitStatus,
+		Stdout:      []byte(r_.Stdout),
+		Stderr:      []byte(r_.Stderr),
+		StartTime:   r_.StartTime,
+		EndTime:     r_.EndTime,
+		ElapsedTime: r_.ElapsedTime,
+	}
+	if r_.ErrString != "" {
+		r.Err = errors.New(r_.ErrString)
+	}
+	return nil
+}
+
 func (r Result) String() string {
 	return fmt.Sprintf("[%s] (Err: %s)]\n%s\n---\n%s\n", r.Host, r.Err, string(r.Stdout), string(r.Stderr))
 }
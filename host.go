@@ -19,10 +19,16 @@ import (
 // booleans, numbers, nil and slices of these values.
 type HostAttributes map[string]interface{}
 
+// Attributes starting with herd_ tell herd how to connect to a host, and are
+// not prefixed so providers with a prefix can still set them.
 func (h HostAttributes) prefix(prefix string) HostAttributes {
 	ret := make(map[string]interface{})
 	for k, v := range h {
-		ret[prefix+k] = v
+		if strings.HasPrefix(k, "herd_") {
+			ret[k] = v
+		} else {
+			ret[prefix+k] = v
+		}
 	}
 	return ret
 }
@@ -116,8 +122,18 @@ var _stringType = reflect.TypeOf("")
 func (h *Host) Match(hostnameGlob string, attributes MatchAttributes) bool {
 
 	if hostnameGlob != "" {
-		ok, err := filepath.Match(hostnameGlob, h.Name)
-		if !ok || err != nil {
+		matched := false
+		for _, name := range h.Names() {
+			ok, err := filepath.Match(hostnameGlob, name)
+			if err != nil {
+				return false
+			}
+			if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
 			return false
 		}
 	}
@@ -164,14 +180,41 @@ func (h *Host) GetAttribute(key string) (interface{}, bool) {
 }
 
 func (h *Host) Amend(h2 *Host) {
+	h.amend(h2, nil)
+}
+
+// Attributes set by both hosts are resolved according to the conflict
+// policies, the default is to let the last one win.
+func (h *Host) amend(h2 *Host, conflicts map[string]string) {
 	if h.Address == "" {
 		h.Address = h2.Address
 	}
-	h.Attributes["herd_provider"] = append(h.Attributes["herd_provider"].([]string), h2.Attributes["herd_provider"].([]string)[0])
+	// Hosts that were not loaded by the registry have no providers
+	providers, _ := h.Attributes["herd_provider"].([]string)
+	providers2, _ := h2.Attributes["herd_provider"].([]string)
+	h.Attributes["herd_provider"] = append(providers, providers2...)
 	for attr, value := range h2.Attributes {
 		if attr == "herd_provider" {
 			continue
 		}
+		// These are derived from the name, and the name of the merged host wins
+		if h.Name != h2.Name && (attr == "hostname" || attr == "domainname") {
+			continue
+		}
+		if attr == "herd_aliases" {
+			for _, a := range h2.aliases() {
+				h.addAlias(a)
+			}
+			continue
+		}
+		if existing, ok := h.Attributes[attr]; ok {
+			switch conflicts[attr] {
+			case ConflictFirst:
+				continue
+			case ConflictMerge:
+				value = mergeValues(existing, value)
+			}
+		}
 		h.Attributes[attr] = value
 	}
 	for _, k := range h2.publicKeys {
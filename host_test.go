@@ -3,6 +3,8 @@ package herd
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/go-test/deep"
 )
 
 func TestHostDeserialization(t *testing.T) {
@@ -37,6 +39,13 @@ func TestHostDeserialization(t *testing.T) {
 	}
 }
 
+func TestAttributePrefix(t *testing.T) {
+	attrs := HostAttributes{"foo": "bar", "herd_port": 2222}.prefix("fake:")
+	if diff := deep.Equal(attrs, HostAttributes{"fake:foo": "bar", "herd_port": 2222}); diff != nil {
+		t.Errorf("Attributes not prefixed correctly: %v", diff)
+	}
+}
+
 func TestHostSorting(t *testing.T) {
 	h1 := NewHost("host-a.example.com", "", HostAttributes{"site": "site1", "role": "db"})
 	h2 := NewHost("host-b.example.com", "", HostAttributes{"site": "site2", "role": "db"})
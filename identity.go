@@ -0,0 +1,131 @@
+package herd
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// Hosts returned by different providers are merged into one host when they
+// have the same name. With identity keys, they are also merged when the
+// address or any of the named attributes of one host matches the name,
+// address or identity attributes of another. The name given by the first
+// provider becomes the name of the host, all other names are kept in the
+// herd_aliases attribute.
+func (r *Registry) SetIdentityKeys(keys []string) {
+	r.identityKeys = keys
+}
+
+// All values a host can be identified by
+func (r *Registry) identities(h *Host) []string {
+	ret := append([]string{h.Name}, h.aliases()...)
+	for _, key := range r.identityKeys {
+		var value interface{}
+		if key == "address" {
+			value = h.Address
+		} else {
+			value = h.Attributes[key]
+		}
+		values := []interface{}{value}
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+			values = make([]interface{}, rv.Len())
+			for i := range values {
+				values[i] = rv.Index(i).Interface()
+			}
+		}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			if s := fmt.Sprintf("%v", v); s != "" {
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret
+}
+
+func (r *Registry) mergeHosts(loaded []Hosts) Hosts {
+	seen := make(map[string]int)
+	allHosts := make(Hosts, 0)
+
+	for _, hosts := range loaded {
+		for _, host := range hosts {
+			idx := -1
+			if i, ok := seen[host.Name]; ok {
+				idx = i
+			} else {
+				for _, id := range r.identities(host) {
+					// Different hosts from the same provider can share an
+					// address or attribute, but they are not the same host.
+					if i, ok := seen[id]; ok && !allHosts[i].hasProvider(host) {
+						idx = i
+						break
+					}
+				}
+			}
+			if idx == -1 {
+				idx = len(allHosts)
+				allHosts = append(allHosts, host)
+			} else {
+				existing := allHosts[idx]
+				if existing.Name != host.Name {
+					logrus.Debugf("Merging %s into %s", host.Name, existing.Name)
+					existing.addAlias(host.Name)
+				}
+				existing.amend(host, r.conflicts)
+			}
+			for _, id := range r.identities(allHosts[idx]) {
+				if _, ok := seen[id]; !ok {
+					seen[id] = idx
+				}
+			}
+		}
+	}
+	return allHosts
+}
+
+func (h *Host) hasProvider(h2 *Host) bool {
+	providers, _ := h.Attributes["herd_provider"].([]string)
+	providers2, _ := h2.Attributes["herd_provider"].([]string)
+	for _, p := range providers2 {
+		for _, p2 := range providers {
+			if p == p2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Aliases are a []string when set by herd, but hosts decoded from JSON, such
+// as those from caches and plugins, have a []interface{}.
+func (h *Host) aliases() []string {
+	value, ok := h.Attributes["herd_aliases"]
+	if !ok {
+		return nil
+	}
+	aliases, err := cast.ToStringSliceE(value)
+	if err != nil {
+		logrus.Warnf("Ignoring invalid herd_aliases on %s: %s", h.Name, err)
+		return nil
+	}
+	return aliases
+}
+
+func (h *Host) addAlias(name string) {
+	aliases := h.aliases()
+	for _, a := range aliases {
+		if a == name {
+			return
+		}
+	}
+	h.Attributes["herd_aliases"] = append(aliases, name)
+}
+
+// The names a host is known by, starting with its canonical name
+func (h *Host) Names() []string {
+	return append([]string{h.Name}, h.aliases()...)
+}
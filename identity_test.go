@@ -0,0 +1,130 @@
+package herd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/viper"
+)
+
+type hostsProvider struct {
+	name  string
+	hosts Hosts
+}
+
+func (p *hostsProvider) Name() string {
+	return p.name
+}
+
+func (p *hostsProvider) Prefix() string {
+	return ""
+}
+
+func (p *hostsProvider) Equivalent(o HostProvider) bool {
+	return false
+}
+
+func (p *hostsProvider) Load(ctx context.Context, lm LoadingMessage) (Hosts, error) {
+	return p.hosts, nil
+}
+
+func (p *hostsProvider) ParseViper(v *viper.Viper) error {
+	return nil
+}
+
+func TestIdentityKeys(t *testing.T) {
+	r := NewRegistry("/tmp", "/tmp")
+	r.AddProvider(&hostsProvider{name: "aws", hosts: Hosts{
+		NewHost("ip-10-1-2-3.ec2.internal", "10.1.2.3", HostAttributes{"instance_id": "i-0123"}),
+		NewHost("ip-10-1-2-4.ec2.internal", "10.1.2.4", HostAttributes{"instance_id": "i-0124"}),
+	}})
+	r.AddProvider(&hostsProvider{name: "consul", hosts: Hosts{
+		NewHost("web-12", "10.1.2.3", HostAttributes{"service": "web"}),
+		// Same address, same provider, different host
+		NewHost("web-13", "10.1.2.3", HostAttributes{"service": "web"}),
+	}})
+	r.AddProvider(&hostsProvider{name: "known_hosts", hosts: Hosts{
+		NewHost("web-12.example.com", "", HostAttributes{"ec2_instance": "i-0123"}),
+	}})
+	r.SetIdentityKeys([]string{"address", "instance_id", "ec2_instance"})
+	if err := r.LoadHosts(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	names := []string{}
+	for _, h := range r.hosts {
+		names = append(names, h.Name)
+	}
+	if diff := deep.Equal(names, []string{"ip-10-1-2-3.ec2.internal", "ip-10-1-2-4.ec2.internal", "web-13"}); diff != nil {
+		t.Fatalf("Hosts not merged correctly: %v", diff)
+	}
+	h := r.hosts[0]
+	if diff := deep.Equal(h.Attributes["herd_aliases"], []string{"web-12", "web-12.example.com"}); diff != nil {
+		t.Errorf("Incorrect aliases: %v", diff)
+	}
+	if diff := deep.Equal(h.Attributes["herd_provider"], []string{"aws", "consul", "known_hosts"}); diff != nil {
+		t.Errorf("Incorrect providers: %v", diff)
+	}
+	if h.Attributes["hostname"] != "ip-10-1-2-3" || h.Attributes["service"] != "web" {
+		t.Errorf("Incorrect attributes: %v", h.Attributes)
+	}
+
+	for _, glob := range []string{"web-12", "web-12.*", "ip-10-1-2-3*"} {
+		hosts := r.GetHosts(glob, MatchAttributes{}, nil, 0)
+		if len(hosts) != 1 || hosts[0] != h {
+			t.Errorf("%s did not match exactly the merged host: %v", glob, hosts)
+		}
+	}
+	hosts := r.GetHosts("", MatchAttributes{{Name: "herd_aliases", Value: "web-12.example.com"}}, nil, 0)
+	if len(hosts) != 1 || hosts[0] != h {
+		t.Errorf("Aliases can not be queried: %v", hosts)
+	}
+}
+
+func TestNoIdentityKeys(t *testing.T) {
+	r := NewRegistry("/tmp", "/tmp")
+	r.AddProvider(&hostsProvider{name: "aws", hosts: Hosts{NewHost("ip-10-1-2-3.ec2.internal", "10.1.2.3", nil)}})
+	r.AddProvider(&hostsProvider{name: "consul", hosts: Hosts{NewHost("web-12", "10.1.2.3", nil)}})
+	if err := r.LoadHosts(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	if len(r.hosts) != 2 {
+		t.Errorf("Hosts should not be merged without identity keys, got %d hosts", len(r.hosts))
+	}
+}
+
+func TestJSONAliases(t *testing.T) {
+	// Hosts from caches and plugins are decoded from JSON, so their aliases
+	// are not a []string
+	cached := &Host{}
+	if err := json.Unmarshal([]byte(`{"Name": "ip-10-1-2-3.ec2.internal", "Address": "10.1.2.3", "Attributes": {"herd_aliases": ["web-12"]}}`), cached); err != nil {
+		t.Fatalf("Unable to decode host: %s", err)
+	}
+	r := NewRegistry("/tmp", "/tmp")
+	r.AddProvider(&hostsProvider{name: "aws", hosts: Hosts{NewHost("ip-10-1-2-3.ec2.internal", "10.1.2.3", nil)}})
+	r.AddProvider(&hostsProvider{name: "cache", hosts: Hosts{cached}})
+	r.AddProvider(&hostsProvider{name: "known_hosts", hosts: Hosts{NewHost("web-12", "", nil)}})
+	if err := r.LoadHosts(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	if len(r.hosts) != 1 {
+		t.Fatalf("Hosts not merged, got %d hosts", len(r.hosts))
+	}
+	if diff := deep.Equal(r.hosts[0].Names(), []string{"ip-10-1-2-3.ec2.internal", "web-12"}); diff != nil {
+		t.Errorf("Incorrect names: %v", diff)
+	}
+}
+
+func TestMergeWithoutProviders(t *testing.T) {
+	r := NewRegistry("/tmp", "/tmp")
+	r.SetIdentityKeys([]string{"address"})
+	hosts := r.mergeHosts([]Hosts{
+		{NewHost("web-12", "10.1.2.3", HostAttributes{"herd_provider": "consul"})},
+		{NewHost("web-12.example.com", "10.1.2.3", HostAttributes{"herd_provider": []string{}})},
+		{NewHost("ip-10-1-2-3.ec2.internal", "10.1.2.3", nil)},
+	})
+	if len(hosts) != 1 {
+		t.Fatalf("Hosts not merged, got %d hosts", len(hosts))
+	}
+}
@@ -0,0 +1,88 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/sirupsen/logrus"
+)
+
+// The container executor runs commands inside containers using the docker (or
+// compatible) or kubectl command line tools. Which container to use is
+// determined by host attributes:
+//
+//	herd_container   The container name (docker) or container in the pod (kubectl)
+//	herd_pod         The pod name, kubectl only
+//	herd_namespace   The namespace of the pod, kubectl only
+//	herd_kubecontext The kubectl context to use, kubectl only
+//
+// If no container or pod is specified, the hostname is used.
+type ContainerExecutor struct {
+	tool           string
+	kubernetes     bool
+	shell          []string
+	connectTimeout time.Duration
+}
+
+func NewDockerExecutor() herd.Executor {
+	return &ContainerExecutor{tool: "docker", shell: []string{"/bin/sh", "-c"}}
+}
+
+func NewPodmanExecutor() herd.Executor {
+	return &ContainerExecutor{tool: "podman", shell: []string{"/bin/sh", "-c"}}
+}
+
+func NewKubectlExecutor() herd.Executor {
+	return &ContainerExecutor{tool: "kubectl", kubernetes: true, shell: []string{"/bin/sh", "-c"}}
+}
+
+func (e *ContainerExecutor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+}
+
+func (e *ContainerExecutor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	args := e.args(host, command)
+	logrus.Debugf("Running %s %v for %s", e.tool, args, host.Name)
+	return run(ctx, host, exec.Command(e.tool, args...), oc)
+}
+
+func (e *ContainerExecutor) args(host *herd.Host, command string) []string {
+	container := stringAttribute(host, "herd_container")
+	args := []string{"exec", "-i"}
+	if e.kubernetes {
+		pod := stringAttribute(host, "herd_pod")
+		if pod == "" {
+			pod = host.Name
+		}
+		if kc := stringAttribute(host, "herd_kubecontext"); kc != "" {
+			args = append(args, "--context", kc)
+		}
+		if ns := stringAttribute(host, "herd_namespace"); ns != "" {
+			args = append(args, "--namespace", ns)
+		}
+		if container != "" {
+			args = append(args, "--container", container)
+		}
+		args = append(args, pod, "--")
+	} else {
+		if container == "" {
+			container = host.Name
+		}
+		args = append(args, container)
+	}
+	args = append(args, e.shell...)
+	return append(args, command)
+}
+
+func stringAttribute(host *herd.Host, name string) string {
+	v, ok := host.Attributes[name]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+var _ herd.Executor = &ContainerExecutor{}
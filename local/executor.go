@@ -0,0 +1,146 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/sirupsen/logrus"
+)
+
+// The local executor runs a command on the local machine once for every
+// host, with the host's name, address and attributes exported as environment
+// variables. This is useful for things like API-driven operations per host.
+type Executor struct {
+	shell          []string
+	connectTimeout time.Duration
+}
+
+func NewExecutor() herd.Executor {
+	return &Executor{shell: defaultShell}
+}
+
+func (e *Executor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+}
+
+func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	args := append(append([]string{}, e.shell[1:]...), command)
+	cmd := exec.Command(e.shell[0], args...)
+	cmd.Env = append(os.Environ(), hostEnvironment(host)...)
+	logrus.Debugf("Running %s locally for %s", command, host.Name)
+	return run(ctx, host, cmd, oc)
+}
+
+var invalidEnvChars = regexp.MustCompile("[^A-Z0-9_]")
+
+// Export host data as HERD_HOST, HERD_ADDRESS and HERD_ATTR_<NAME> variables.
+// Attribute names are uppercased and any character that is not valid in an
+// environment variable name is replaced by an underscore. Slices are joined
+// with commas.
+func hostEnvironment(host *herd.Host) []string {
+	env := []string{
+		"HERD_HOST=" + host.Name,
+		"HERD_ADDRESS=" + host.Address,
+	}
+	keys := make([]string, 0, len(host.Attributes))
+	for k := range host.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := "HERD_ATTR_" + invalidEnvChars.ReplaceAllString(strings.ToUpper(k), "_")
+		env = append(env, fmt.Sprintf("%s=%s", name, envValue(host.Attributes[k])))
+	}
+	return env
+}
+
+func envValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		parts := make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			parts[i] = fmt.Sprintf("%v", rv.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Run a local command on behalf of a host, collecting its output the same way
+// the ssh executor does.
+func run(ctx context.Context, host *herd.Host, cmd *exec.Cmd, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
+	defer func() {
+		r.EndTime = time.Now()
+		r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+
+	var stdout, stderr herd.ByteWriter
+	if oc != nil {
+		stdout = herd.NewLineWriterBuffer(host, false, oc)
+		stderr = herd.NewLineWriterBuffer(host, true, oc)
+	} else {
+		stdout = bytes.NewBuffer([]byte{})
+		stderr = bytes.NewBuffer([]byte{})
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		r.Err = err
+		return r
+	}
+	ec := make(chan error)
+	go func() {
+		ec <- cmd.Wait()
+	}()
+
+	signals := herd.Signals(ctx)
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			signalProcess(cmd, sig)
+		case <-ctx.Done():
+			killProcess(cmd)
+			<-ec
+			r.Err = herd.TimeoutError{Message: "Timed out while executing command"}
+			break wait
+		case err := <-ec:
+			r.Err = err
+			break wait
+		}
+	}
+	if r.Err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(r.Err, &exitErr) {
+			r.ExitStatus = exitErr.ExitCode()
+		}
+	} else {
+		r.ExitStatus = 0
+	}
+	r.Stdout = stdout.Bytes()
+	r.Stderr = stderr.Bytes()
+	return r
+}
+
+var _ herd.Executor = &Executor{}
@@ -0,0 +1,108 @@
+package local
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seveas/herd"
+)
+
+func TestHostEnvironment(t *testing.T) {
+	host := herd.NewHost("host-1.example.com", "10.0.0.1", herd.HostAttributes{
+		"site":         "site1",
+		"service:smtp": []string{"primary", "tls"},
+		"cpus":         int64(4),
+	})
+	env := strings.Join(hostEnvironment(host), "\n")
+	for _, expected := range []string{
+		"HERD_HOST=host-1.example.com",
+		"HERD_ADDRESS=10.0.0.1",
+		"HERD_ATTR_SITE=site1",
+		"HERD_ATTR_SERVICE_SMTP=primary,tls",
+		"HERD_ATTR_CPUS=4",
+		"HERD_ATTR_DOMAINNAME=example.com",
+	} {
+		if !strings.Contains(env, expected+"\n") && !strings.HasSuffix(env, expected) {
+			t.Errorf("%s not found in environment:\n%s", expected, env)
+		}
+	}
+}
+
+func TestLocalExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a posix shell")
+	}
+	e := NewExecutor()
+	host := herd.NewHost("host-1.example.com", "", herd.HostAttributes{"site": "site1"})
+
+	r := e.Run(context.Background(), host, "echo $HERD_HOST $HERD_ATTR_SITE; echo oops >&2; exit 3", nil)
+	if r.ExitStatus != 3 {
+		t.Errorf("Expected exit status 3, got %d (%v)", r.ExitStatus, r.Err)
+	}
+	if string(r.Stdout) != "host-1.example.com site1\n" {
+		t.Errorf("Unexpected output: %q", r.Stdout)
+	}
+	if string(r.Stderr) != "oops\n" {
+		t.Errorf("Unexpected error output: %q", r.Stderr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r = e.Run(ctx, host, "sleep 5", nil)
+	if _, ok := r.Err.(herd.TimeoutError); !ok || r.ExitStatus != -1 {
+		t.Errorf("Expected a timeout, got %v (%d)", r.Err, r.ExitStatus)
+	}
+
+	signals := make(chan os.Signal, 1)
+	ctx, cancel = context.WithTimeout(herd.WithSignals(context.Background(), signals), 5*time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		signals <- os.Interrupt
+	}()
+	r = e.Run(ctx, host, "trap 'echo interrupted; exit 4' INT; while true; do sleep 0.05; done", nil)
+	if r.ExitStatus != 4 || string(r.Stdout) != "interrupted\n" {
+		t.Errorf("Expected the command to be interrupted, got %q (%d)", r.Stdout, r.ExitStatus)
+	}
+}
+
+func TestLocalExecutorShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a posix shell")
+	}
+	// Concurrent runs share the shell, its spare capacity must not be used
+	shell := append(make([]string, 0, 3), "/bin/sh", "-c")
+	e := &Executor{shell: shell}
+	host := herd.NewHost("host-1.example.com", "", herd.HostAttributes{})
+	if r := e.Run(context.Background(), host, "echo one", nil); string(r.Stdout) != "one\n" {
+		t.Errorf("Unexpected output: %q", r.Stdout)
+	}
+	if spare := shell[:3][2]; spare != "" {
+		t.Errorf("Command was stored in the shell: %q", spare)
+	}
+}
+
+func TestContainerArgs(t *testing.T) {
+	tests := []struct {
+		executor herd.Executor
+		attrs    herd.HostAttributes
+		expected string
+	}{
+		{NewDockerExecutor(), herd.HostAttributes{}, "exec -i web-1 /bin/sh -c id"},
+		{NewDockerExecutor(), herd.HostAttributes{"herd_container": "web"}, "exec -i web /bin/sh -c id"},
+		{NewKubectlExecutor(), herd.HostAttributes{}, "exec -i web-1 -- /bin/sh -c id"},
+		{NewKubectlExecutor(), herd.HostAttributes{"herd_namespace": "prod", "herd_pod": "web-abc", "herd_container": "nginx"},
+			"exec -i --namespace prod --container nginx web-abc -- /bin/sh -c id"},
+	}
+	for _, test := range tests {
+		host := herd.NewHost("web-1", "", test.attrs)
+		args := strings.Join(test.executor.(*ContainerExecutor).args(host, "id"), " ")
+		if args != test.expected {
+			t.Errorf("Expected '%s', got '%s'", test.expected, args)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var defaultShell = []string{"/bin/sh", "-c"}
+
+// Commands run in their own process group, so we can kill them including any
+// children they spawned.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcess(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func signalProcess(cmd *exec.Cmd, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(-cmd.Process.Pid, s)
+	}
+}
@@ -0,0 +1,20 @@
+package local
+
+import (
+	"os"
+	"os/exec"
+)
+
+var defaultShell = []string{"cmd.exe", "/c"}
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcess(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// Windows has no way of sending signals to other processes, so commands are
+// only killed once the grace period is over.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) {
+}
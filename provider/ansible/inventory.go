@@ -0,0 +1,672 @@
+package ansible
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type vars map[string]interface{}
+
+type group struct {
+	name     string
+	hosts    []string
+	children []string
+	parents  []string
+	vars     vars
+}
+
+// An inventory is built up from one or more inventory sources, after which
+// the variables of each host can be calculated.
+type inventory struct {
+	groups        map[string]*group
+	hosts         map[string]vars
+	groupVarFiles map[string]vars
+	hostVarFiles  map[string]vars
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		groups:        map[string]*group{},
+		hosts:         map[string]vars{},
+		groupVarFiles: map[string]vars{},
+		hostVarFiles:  map[string]vars{},
+	}
+}
+
+var ignoredExtensions = []string{"~", ".orig", ".bak", ".cfg", ".retry", ".pyc", ".pyo", ".md", ".txt"}
+
+// Load an inventory source, which can be a static inventory in ini or yaml
+// format, an executable dynamic inventory script or a directory containing any
+// of these. Variables from group_vars and host_vars next to the source are
+// loaded as well.
+func (i *inventory) load(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+	entries:
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || name == "group_vars" || name == "host_vars" {
+				continue
+			}
+			for _, ext := range ignoredExtensions {
+				if strings.HasSuffix(name, ext) {
+					continue entries
+				}
+			}
+			if err := i.loadFile(ctx, filepath.Join(path, name)); err != nil {
+				return err
+			}
+		}
+		return i.loadVarsDirs(path)
+	}
+	if err := i.loadFile(ctx, path); err != nil {
+		return err
+	}
+	return i.loadVarsDirs(filepath.Dir(path))
+}
+
+func (i *inventory) loadFile(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return i.load(ctx, path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml", ".json":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := i.parseYaml(data); err != nil {
+			return fmt.Errorf("Unable to parse %s: %s", path, err)
+		}
+		return nil
+	}
+	if runtime.GOOS != "windows" && info.Mode()&0111 != 0 {
+		return i.runScript(ctx, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := i.parseIni(data); err != nil {
+		return fmt.Errorf("Unable to parse %s: %s", path, err)
+	}
+	return nil
+}
+
+func (i *inventory) group(name string) *group {
+	g, ok := i.groups[name]
+	if !ok {
+		g = &group{name: name, vars: vars{}}
+		i.groups[name] = g
+	}
+	return g
+}
+
+func (i *inventory) addHost(g *group, name string, v vars) {
+	hv, ok := i.hosts[name]
+	if !ok {
+		hv = vars{}
+		i.hosts[name] = hv
+	}
+	for k, val := range v {
+		hv[k] = val
+	}
+	if g != nil && !contains(g.hosts, name) {
+		g.hosts = append(g.hosts, name)
+	}
+}
+
+func (i *inventory) addChild(parent *group, child string) {
+	i.group(child)
+	if !contains(parent.children, child) {
+		parent.children = append(parent.children, child)
+	}
+	c := i.groups[child]
+	if !contains(c.parents, parent.name) {
+		c.parents = append(c.parents, parent.name)
+	}
+}
+
+var iniSection = regexp.MustCompile(`^\[([^\]:]+)(?::(\w+))?\]$`)
+
+func (i *inventory) parseIni(data []byte) error {
+	g := i.group("ungrouped")
+	section := "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if m := iniSection.FindStringSubmatch(line); m != nil {
+			g = i.group(m[1])
+			section = m[2]
+			if section == "" {
+				section = "hosts"
+			}
+			if section != "hosts" && section != "vars" && section != "children" {
+				return fmt.Errorf("line %d: unknown section type %s", lineno, section)
+			}
+			continue
+		}
+		switch section {
+		case "hosts":
+			fields, err := splitIniLine(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", lineno, err)
+			}
+			hv := vars{}
+			for _, f := range fields[1:] {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					return fmt.Errorf("line %d: expected key=value, got %s", lineno, f)
+				}
+				hv[kv[0]] = iniValue(kv[1])
+			}
+			names, err := expandHostPattern(fields[0])
+			if err != nil {
+				return fmt.Errorf("line %d: %s", lineno, err)
+			}
+			for _, name := range names {
+				i.addHost(g, name, hv)
+			}
+		case "vars":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("line %d: expected key=value, got %s", lineno, line)
+			}
+			g.vars[strings.TrimSpace(kv[0])] = iniValue(strings.TrimSpace(kv[1]))
+		case "children":
+			i.addChild(g, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// Split a host line on whitespace, honoring quotes
+func splitIniLine(line string) ([]string, error) {
+	fields := []string{}
+	var field strings.Builder
+	var quote rune
+	inField := false
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			field.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inField = true
+			field.WriteRune(c)
+		case c == '#' && !inField:
+			return fields, nil
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			inField = true
+			field.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// Values in ini inventories are python literals, we support the common cases
+// of numbers, booleans and (quoted) strings.
+func iniValue(s string) interface{} {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+var hostRange = regexp.MustCompile(`\[([0-9a-zA-Z]+):([0-9a-zA-Z]+)(?::([0-9]+))?\]`)
+
+// Expand host patterns such as www[01:50].example.com and db-[a:f].example.com
+func expandHostPattern(pattern string) ([]string, error) {
+	m := hostRange.FindStringSubmatchIndex(pattern)
+	if m == nil {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:m[0]], pattern[m[1]:]
+	start, end := pattern[m[2]:m[3]], pattern[m[4]:m[5]]
+	step := 1
+	if m[6] != -1 {
+		step, _ = strconv.Atoi(pattern[m[6]:m[7]])
+		if step < 1 {
+			return nil, fmt.Errorf("invalid step in host range %s", pattern[m[0]:m[1]])
+		}
+	}
+	var values []string
+	if s, err := strconv.Atoi(start); err == nil {
+		e, err := strconv.Atoi(end)
+		if err != nil || e < s {
+			return nil, fmt.Errorf("invalid host range %s", pattern[m[0]:m[1]])
+		}
+		width := 0
+		if len(start) > 1 && start[0] == '0' {
+			width = len(start)
+		}
+		for n := s; n <= e; n += step {
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		}
+	} else {
+		if len(start) != 1 || len(end) != 1 || end[0] < start[0] {
+			return nil, fmt.Errorf("invalid host range %s", pattern[m[0]:m[1]])
+		}
+		for c := start[0]; c <= end[0]; c += byte(step) {
+			values = append(values, string(c))
+			if int(c)+step > 255 {
+				break
+			}
+		}
+	}
+	ret := []string{}
+	for _, v := range values {
+		expanded, err := expandHostPattern(prefix + v + suffix)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, expanded...)
+	}
+	return ret, nil
+}
+
+func (i *inventory) parseYaml(data []byte) error {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	for name, data := range doc {
+		if err := i.parseYamlGroup(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *inventory) parseYamlGroup(name string, data interface{}) error {
+	g := i.group(name)
+	if data == nil {
+		return nil
+	}
+	m, ok := normalize(data).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("group %s is not a mapping", name)
+	}
+	if hosts, ok := m["hosts"].(map[string]interface{}); ok {
+		for pattern, hv := range hosts {
+			names, err := expandHostPattern(pattern)
+			if err != nil {
+				return err
+			}
+			v, _ := hv.(map[string]interface{})
+			for _, name := range names {
+				i.addHost(g, name, v)
+			}
+		}
+	} else if m["hosts"] != nil {
+		return fmt.Errorf("hosts of group %s is not a mapping", name)
+	}
+	if v, ok := m["vars"].(map[string]interface{}); ok {
+		for k, val := range v {
+			g.vars[k] = val
+		}
+	}
+	if children, ok := m["children"].(map[string]interface{}); ok {
+		for child, data := range children {
+			i.addChild(g, child)
+			if err := i.parseYamlGroup(child, data); err != nil {
+				return err
+			}
+		}
+	} else if m["children"] != nil {
+		return fmt.Errorf("children of group %s is not a mapping", name)
+	}
+	return nil
+}
+
+func (i *inventory) runScript(ctx context.Context, path string) error {
+	out, err := exec.CommandContext(ctx, path, "--list").Output()
+	if err != nil {
+		return fmt.Errorf("Unable to run inventory script %s: %s", path, err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return fmt.Errorf("Unable to parse output of inventory script %s: %s", path, err)
+	}
+	var hostvars map[string]interface{}
+	haveMeta := false
+	if meta, ok := doc["_meta"].(map[string]interface{}); ok {
+		hostvars, haveMeta = meta["hostvars"].(map[string]interface{})
+	}
+	delete(doc, "_meta")
+	scriptHosts := map[string]bool{}
+	addHosts := func(g *group, hosts []interface{}) {
+		for _, h := range hosts {
+			if h, ok := h.(string); ok {
+				i.addHost(g, h, nil)
+				scriptHosts[h] = true
+			}
+		}
+	}
+	for name, data := range doc {
+		g := i.group(name)
+		switch data := data.(type) {
+		case []interface{}:
+			// A plain list of hosts
+			addHosts(g, data)
+		case map[string]interface{}:
+			if hosts, ok := data["hosts"].([]interface{}); ok {
+				addHosts(g, hosts)
+			}
+			if v, ok := data["vars"].(map[string]interface{}); ok {
+				for k, val := range v {
+					g.vars[k] = normalize(val)
+				}
+			}
+			if children, ok := data["children"].([]interface{}); ok {
+				for _, c := range children {
+					if c, ok := c.(string); ok {
+						i.addChild(g, c)
+					}
+				}
+			}
+		}
+	}
+	// Old scripts don't return host variables in --list output, and need to be
+	// asked for each host separately.
+	for name := range scriptHosts {
+		var v interface{}
+		if haveMeta {
+			v = hostvars[name]
+		} else {
+			out, err := exec.CommandContext(ctx, path, "--host", name).Output()
+			if err != nil {
+				return fmt.Errorf("Unable to run inventory script %s: %s", path, err)
+			}
+			if err := json.Unmarshal(out, &v); err != nil {
+				return fmt.Errorf("Unable to parse output of inventory script %s: %s", path, err)
+			}
+		}
+		if m, ok := normalize(v).(map[string]interface{}); ok {
+			i.addHost(nil, name, m)
+		}
+	}
+	return nil
+}
+
+// Load group_vars and host_vars that live next to an inventory source.
+// Variables can be in a file named after the group or host, optionally with a
+// yaml or json extension, or in any files in a directory named after them.
+func (i *inventory) loadVarsDirs(dir string) error {
+	for sub, dest := range map[string]map[string]vars{"group_vars": i.groupVarFiles, "host_vars": i.hostVarFiles} {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			path := filepath.Join(dir, sub, name)
+			files := []string{path}
+			if entry.IsDir() {
+				files, err = filepath.Glob(filepath.Join(path, "*"))
+				if err != nil {
+					return err
+				}
+				sort.Strings(files)
+			} else {
+				switch filepath.Ext(name) {
+				case ".yml", ".yaml", ".json":
+					name = strings.TrimSuffix(name, filepath.Ext(name))
+				}
+			}
+			for _, file := range files {
+				if err := loadVarsFile(file, name, dest); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func loadVarsFile(path, name string, dest map[string]vars) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("Unable to parse %s: %s", path, err)
+	}
+	if doc == nil {
+		return nil
+	}
+	m, ok := normalize(doc).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Unable to parse %s: not a mapping", path)
+	}
+	if dest[name] == nil {
+		dest[name] = vars{}
+	}
+	for k, v := range m {
+		dest[name][k] = v
+	}
+	return nil
+}
+
+// Every group is a child of all, and hosts without a group are in ungrouped.
+func (i *inventory) finalize() {
+	all := i.group("all")
+	for name, g := range i.groups {
+		if name != "all" && len(g.parents) == 0 {
+			i.addChild(all, name)
+		}
+	}
+	grouped := map[string]bool{}
+	for name, g := range i.groups {
+		if name == "all" || name == "ungrouped" {
+			continue
+		}
+		for _, h := range g.hosts {
+			grouped[h] = true
+		}
+	}
+	ungrouped := i.group("ungrouped")
+	hosts := ungrouped.hosts[:0]
+	for _, h := range ungrouped.hosts {
+		if !grouped[h] {
+			hosts = append(hosts, h)
+		}
+	}
+	ungrouped.hosts = hosts
+	for h := range i.hosts {
+		if !grouped[h] && !contains(ungrouped.hosts, h) {
+			ungrouped.hosts = append(ungrouped.hosts, h)
+		}
+	}
+}
+
+// The depth of a group is the length of the longest path from all to it, and
+// determines the order in which group variables are applied.
+func (i *inventory) depth(name string, seen map[string]bool) int {
+	if seen[name] {
+		return 0
+	}
+	seen[name] = true
+	defer delete(seen, name)
+	d := 0
+	for _, p := range i.groups[name].parents {
+		if pd := i.depth(p, seen) + 1; pd > d {
+			d = pd
+		}
+	}
+	return d
+}
+
+// All groups a host is a member of, including the groups those are children
+// of, sorted by depth and name.
+func (i *inventory) allGroups(host string) []string {
+	member := map[string]bool{}
+	var addParents func(string)
+	addParents = func(name string) {
+		if member[name] {
+			return
+		}
+		member[name] = true
+		for _, p := range i.groups[name].parents {
+			addParents(p)
+		}
+	}
+	for name, g := range i.groups {
+		if contains(g.hosts, host) {
+			addParents(name)
+		}
+	}
+	groups := make([]string, 0, len(member))
+	depths := map[string]int{}
+	for name := range member {
+		groups = append(groups, name)
+		depths[name] = i.depth(name, map[string]bool{})
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		if depths[groups[a]] != depths[groups[b]] {
+			return depths[groups[a]] < depths[groups[b]]
+		}
+		return groups[a] < groups[b]
+	})
+	return groups
+}
+
+// Group names of a host, excluding the implicit all and ungrouped groups, like
+// ansible's group_names variable.
+func (i *inventory) hostGroups(host string) []string {
+	ret := []string{}
+	for _, name := range i.allGroups(host) {
+		if name != "all" && name != "ungrouped" {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Merge all variables for a host. Group variables are applied from the least
+// to the most specific group, and host variables override group variables.
+// Variables from group_vars and host_vars override those from the inventory.
+func (i *inventory) hostVars(host string) vars {
+	ret := vars{}
+	for _, name := range i.allGroups(host) {
+		for k, v := range i.groups[name].vars {
+			ret[k] = v
+		}
+		for k, v := range i.groupVarFiles[name] {
+			ret[k] = v
+		}
+	}
+	for k, v := range i.hosts[host] {
+		ret[k] = v
+	}
+	for k, v := range i.hostVarFiles[host] {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Turn yaml maps into string-keyed maps and integers into int64, so hosts can
+// be cached as json and matched like hosts from other providers.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprintf("%v", k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = normalize(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = normalize(val)
+		}
+		return l
+	case int:
+		return int64(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	}
+	return v
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, twig := range haystack {
+		if twig == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package ansible
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/cache"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("ansible", newProvider, magicProvider)
+}
+
+type ansibleProvider struct {
+	name   string
+	config struct {
+		File   string
+		Prefix string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &ansibleProvider{name: name}
+}
+
+// Use the same inventory ansible would use, if it's set in the environment.
+func magicProvider() herd.HostProvider {
+	inventory, _ := os.LookupEnv("ANSIBLE_INVENTORY")
+	if inventory == "" || strings.Contains(inventory, ",") {
+		return nil
+	}
+	p := &ansibleProvider{name: "ansible"}
+	p.config.File = inventory
+	return cache.NewFromProvider(p)
+}
+
+func (p *ansibleProvider) Name() string {
+	return p.name
+}
+
+func (p *ansibleProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *ansibleProvider) Equivalent(o herd.HostProvider) bool {
+	return p.config.File == o.(*ansibleProvider).config.File
+}
+
+func (p *ansibleProvider) SetDataDir(dir string) error {
+	if !filepath.IsAbs(p.config.File) {
+		p.config.File = filepath.Join(dir, p.config.File)
+	}
+	_, err := os.Stat(p.config.File)
+	return err
+}
+
+func (p *ansibleProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *ansibleProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
+	lm(p.name, false, nil)
+	inv := newInventory()
+	if err := inv.load(ctx, p.config.File); err != nil {
+		return nil, err
+	}
+	inv.finalize()
+	names := make([]string, 0, len(inv.hosts))
+	for name := range inv.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hosts := make(herd.Hosts, 0, len(names))
+	for _, name := range names {
+		vars := inv.hostVars(name)
+		attrs := make(herd.HostAttributes)
+		for k, v := range vars {
+			attrs[k] = v
+		}
+		attrs["groups"] = inv.hostGroups(name)
+		address := ""
+		for _, key := range []string{"ansible_host", "ansible_ssh_host"} {
+			if v, ok := vars[key].(string); ok {
+				address = v
+				break
+			}
+		}
+		// Connection settings ansible knows about are used by herd too
+		for _, key := range []string{"ansible_port", "ansible_ssh_port"} {
+			if v, ok := vars[key]; ok {
+				attrs["herd_port"] = v
+				break
+			}
+		}
+		for _, key := range []string{"ansible_user", "ansible_ssh_user"} {
+			if v, ok := vars[key]; ok {
+				attrs["herd_user"] = v
+				break
+			}
+		}
+		if v, ok := vars["ansible_ssh_private_key_file"]; ok {
+			attrs["herd_identity_file"] = v
+		}
+		hosts = append(hosts, herd.NewHost(name, address, attrs))
+	}
+	return hosts, nil
+}
+
+var _ herd.DataLoader = &ansibleProvider{}
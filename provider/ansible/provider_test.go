@@ -0,0 +1,143 @@
+package ansible
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/seveas/herd"
+)
+
+var testdata string
+
+func init() {
+	_, me, _, _ := runtime.Caller(0)
+	testdata = filepath.Join(filepath.Dir(me), "testdata")
+}
+
+func loadInventory(t *testing.T, file string) map[string]*herd.Host {
+	p := newProvider("ansible").(*ansibleProvider)
+	p.config.File = file
+	if err := p.SetDataDir(testdata); err != nil {
+		t.Fatalf("Inventory not found: %s", err)
+	}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Unable to load inventory: %s", err)
+	}
+	ret := make(map[string]*herd.Host)
+	for _, h := range hosts {
+		ret[h.Name] = h
+	}
+	return ret
+}
+
+func TestIniInventory(t *testing.T) {
+	hosts := loadInventory(t, "ini/hosts")
+	if len(hosts) != 7 {
+		t.Fatalf("Expected 7 hosts, got %d", len(hosts))
+	}
+	bastion := hosts["bastion.example.com"]
+	if bastion.Address != "192.0.2.1" {
+		t.Errorf("ansible_host was not used as address: %s", bastion.Address)
+	}
+	if diff := deep.Equal(bastion.Attributes["groups"], []string{}); diff != nil {
+		t.Errorf("Ungrouped host has groups: %v", diff)
+	}
+	web01 := hosts["web01.example.com"]
+	if diff := deep.Equal(web01.Attributes["groups"], []string{"site1", "web"}); diff != nil {
+		t.Errorf("Incorrect groups: %v", diff)
+	}
+	expected := map[string]interface{}{
+		"http_port":  int64(8080),
+		"site":       "site1",
+		"ntp_server": "ntp1.example.com",
+		"env":        "production",
+		"packages":   []interface{}{"nginx", "certbot"},
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(web01.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	web04 := hosts["web04.example.com"]
+	if web04.Attributes["ansible_port"] != int64(2222) || web04.Attributes["ansible_user"] != "deploy" || web04.Attributes["comment"] != "hello world" {
+		t.Errorf("Host variables were not parsed correctly: %v", web04.Attributes)
+	}
+	if web04.Attributes["herd_port"] != int64(2222) || web04.Attributes["herd_user"] != "deploy" {
+		t.Errorf("Connection settings were not mapped: %v", web04.Attributes)
+	}
+	if hosts["db-b.example.com"].Address != "db.internal" {
+		t.Errorf("Host range variables were not applied")
+	}
+}
+
+func TestYamlInventory(t *testing.T) {
+	hosts := loadInventory(t, "yaml/inventory.yml")
+	if len(hosts) != 5 {
+		t.Fatalf("Expected 5 hosts, got %d", len(hosts))
+	}
+	replica := hosts["db-replica.example.com"]
+	if diff := deep.Equal(replica.Attributes["groups"], []string{"db", "replicas"}); diff != nil {
+		t.Errorf("Incorrect groups: %v", diff)
+	}
+	if replica.Attributes["env"] != "staging" {
+		t.Errorf("Variables of all were not applied")
+	}
+	db := hosts["db.example.com"]
+	if db.Address != "10.0.0.5" || db.Attributes["ansible_port"] != int64(5022) {
+		t.Errorf("Host variables were not applied: %s %v", db.Address, db.Attributes)
+	}
+	if hosts["web2.example.com"].Attributes["ansible_user"] != "www" {
+		t.Errorf("Group variables were not applied")
+	}
+	if db.Attributes["herd_port"] != int64(5022) || hosts["web2.example.com"].Attributes["herd_user"] != "www" {
+		t.Errorf("Connection settings were not mapped")
+	}
+}
+
+func TestScriptInventory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a posix shell script")
+	}
+	hosts := loadInventory(t, "script/inventory")
+	if len(hosts) != 3 {
+		t.Fatalf("Expected 3 hosts, got %d", len(hosts))
+	}
+	web1 := hosts["web1.example.com"]
+	if web1.Address != "10.0.0.1" || web1.Attributes["http_port"] != int64(80) || web1.Attributes["site"] != "site1" {
+		t.Errorf("Variables were not applied: %s %v", web1.Address, web1.Attributes)
+	}
+	if diff := deep.Equal(web1.Attributes["tags"], map[string]interface{}{"role": "frontend"}); diff != nil {
+		t.Errorf("Nested variables were not parsed: %v", diff)
+	}
+	if diff := deep.Equal(hosts["lonely.example.com"].Attributes["groups"], []string{}); diff != nil {
+		t.Errorf("Ungrouped host has groups: %v", diff)
+	}
+}
+
+func TestHostPatterns(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"host.example.com", []string{"host.example.com"}},
+		{"www[01:03].example.com", []string{"www01.example.com", "www02.example.com", "www03.example.com"}},
+		{"www[1:5:2]", []string{"www1", "www3", "www5"}},
+		{"db-[a:c]-[1:2]", []string{"db-a-1", "db-a-2", "db-b-1", "db-b-2", "db-c-1", "db-c-2"}},
+	}
+	for _, test := range tests {
+		names, err := expandHostPattern(test.pattern)
+		if err != nil {
+			t.Errorf("Unable to expand %s: %s", test.pattern, err)
+		}
+		if diff := deep.Equal(names, test.expected); diff != nil {
+			t.Errorf("Incorrect expansion of %s: %v", test.pattern, diff)
+		}
+	}
+	if _, err := expandHostPattern("www[5:1]"); err == nil {
+		t.Errorf("Invalid ranges should be rejected")
+	}
+}
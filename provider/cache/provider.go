@@ -20,12 +20,15 @@ func init() {
 }
 
 type Cache struct {
-	name   string
-	source herd.HostProvider
-	config struct {
-		Lifetime time.Duration
-		File     string
-		Prefix   string
+	name       string
+	source     herd.HostProvider
+	refreshing chan struct{}
+	age        time.Duration
+	config     struct {
+		Lifetime             time.Duration
+		File                 string
+		Prefix               string
+		StaleWhileRevalidate bool
 	}
 }
 
@@ -60,8 +63,10 @@ func (c *Cache) Source() herd.HostProvider {
 	return c.source
 }
 
+// An explicit refresh request means we don't want stale data either
 func (c *Cache) Invalidate() {
 	c.config.Lifetime = -1
+	c.config.StaleWhileRevalidate = false
 }
 
 func (c *Cache) Equivalent(p herd.HostProvider) bool {
@@ -89,35 +94,151 @@ func (c *Cache) mustRefresh() bool {
 	return err != nil || time.Since(info.ModTime()) > c.config.Lifetime
 }
 
+// What we store in the cache file. The validator is opaque to us, it is
+// whatever the source provider needs to tell whether its data has changed.
+type cacheData struct {
+	Validator string `json:",omitempty"`
+	Hosts     herd.Hosts
+}
+
+func (c *Cache) read() (*cacheData, error) {
+	data, err := ioutil.ReadFile(c.config.File)
+	if err != nil {
+		return nil, err
+	}
+	cd := &cacheData{Hosts: make(herd.Hosts, 0)}
+	// Older versions of herd only stored the list of hosts
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &cd.Hosts)
+	} else {
+		err = json.Unmarshal(data, cd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cd, nil
+}
+
+// Cache files are written to a temporary file that is moved in place, so
+// concurrent herd processes never see a half-written cache.
+func (c *Cache) write(cd *cacheData) error {
+	data, err := json.Marshal(cd)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(c.config.File)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Unable to create cache directory %s: %s", dir, err.Error())
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(c.config.File)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.config.File)
+}
+
 func (c *Cache) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
-	if !c.mustRefresh() {
-		logrus.Debugf("Loading cached data from %s for %s", c.config.File, c.source.Name())
-		hosts := make(herd.Hosts, 0)
-		data, err := ioutil.ReadFile(c.config.File)
-		if err != nil {
-			return nil, err
-		}
-		if err = json.Unmarshal(data, &hosts); err != nil {
-			return nil, err
+	cached, err := c.read()
+	if err != nil {
+		cached = nil
+		if !os.IsNotExist(err) {
+			logrus.Debugf("Ignoring unreadable cache %s: %s", c.config.File, err)
 		}
-		return hosts, nil
 	}
-	hosts, err := c.source.Load(ctx, lm)
-	if err == nil && len(hosts) > 0 {
-		var data []byte
-		dir := filepath.Dir(c.config.File)
-		if err = os.MkdirAll(dir, 0700); err != nil {
-			return nil, fmt.Errorf("Unable to create cache directory %s: %s", dir, err.Error())
+	if cached != nil {
+		if info, err := os.Stat(c.config.File); err == nil {
+			c.age = time.Since(info.ModTime())
 		}
-		if data, err = json.Marshal(hosts); err != nil {
-			return nil, err
+	}
+	if cached != nil && !c.mustRefresh() {
+		logrus.Debugf("Loading cached data from %s for %s", c.config.File, c.source.Name())
+		return cached.Hosts, nil
+	}
+	if cached != nil && c.config.StaleWhileRevalidate {
+		logrus.Debugf("Loading stale cached data from %s for %s, refreshing in the background", c.config.File, c.source.Name())
+		// Our context is canceled as soon as loading is done, so the refresh
+		// gets its own context with the same deadline. That way herd waits
+		// no longer than the load timeout for it when exiting.
+		bctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			bctx, cancel = context.WithDeadline(bctx, deadline)
 		}
-		if err = ioutil.WriteFile(c.config.File, data, 0644); err != nil {
-			return nil, err
+		c.refreshing = make(chan struct{})
+		go func() {
+			defer close(c.refreshing)
+			defer cancel()
+			if _, err := c.refresh(bctx, func(string, bool, error) {}, cached); err != nil {
+				logrus.Warnf("Background refresh of %s failed: %s", c.name, err)
+			}
+		}()
+		return cached.Hosts, nil
+	}
+	c.age = 0
+	return c.refresh(ctx, lm, cached)
+}
+
+// How old the data returned by the last Load was
+func (c *Cache) Age() time.Duration {
+	return c.age
+}
+
+// Load data from the source and store it. If the source can tell us that
+// nothing changed since we last cached its data, we reuse the cached data.
+func (c *Cache) refresh(ctx context.Context, lm herd.LoadingMessage, cached *cacheData) (herd.Hosts, error) {
+	cl, conditional := c.source.(herd.ConditionalLoader)
+	if conditional {
+		validator := ""
+		if cached != nil {
+			validator = cached.Validator
 		}
+		cl.SetValidator(validator)
+	}
+	hosts, err := c.source.Load(ctx, lm)
+	if err == herd.ErrNotModified && cached != nil {
+		logrus.Debugf("Cached data in %s for %s is still valid", c.config.File, c.source.Name())
+		now := time.Now()
+		return cached.Hosts, os.Chtimes(c.config.File, now, now)
+	}
+	if err != nil || len(hosts) == 0 {
+		return hosts, err
+	}
+	cd := &cacheData{Hosts: hosts}
+	if conditional {
+		cd.Validator = cl.Validator()
+	}
+	if err = c.write(cd); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// Wait for a background refresh to finish, so the next invocation gets fresh
+// data. The refresh gives up when the load timeout expires.
+func (c *Cache) WaitForRefresh() {
+	if c.refreshing == nil {
+		return
+	}
+	select {
+	case <-c.refreshing:
+	default:
+		logrus.Infof("Waiting for the background refresh of %s to finish", c.name)
+		<-c.refreshing
 	}
-	return hosts, err
 }
 
 // Make sure we actually are a cache
 var _ herd.Cache = &Cache{}
+var _ herd.BackgroundRefresher = &Cache{}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -17,6 +18,7 @@ import (
 type fakeProvider struct {
 	loaded  int
 	doError bool
+	value   string
 }
 
 func (p *fakeProvider) Name() string {
@@ -33,7 +35,11 @@ func (p *fakeProvider) Equivalent(o herd.HostProvider) bool {
 
 func (p *fakeProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
 	p.loaded++
-	h := herd.NewHost("test-host", "", herd.HostAttributes{"foo": "bar"})
+	value := p.value
+	if value == "" {
+		value = "bar"
+	}
+	h := herd.NewHost("test-host", "", herd.HostAttributes{"foo": value})
 	if p.doError {
 		return herd.Hosts{h}, fmt.Errorf("You wanted an error")
 	}
@@ -114,3 +120,188 @@ func TestRelativeFiles(t *testing.T) {
 		t.Errorf("Expected attribute not found in %v", hosts[0].Attributes)
 	}
 }
+
+// A provider that can tell us its data has not changed
+type conditionalProvider struct {
+	fakeProvider
+	validator string
+}
+
+func (p *conditionalProvider) SetValidator(v string) {
+	p.validator = v
+}
+
+func (p *conditionalProvider) Validator() string {
+	return "v1"
+}
+
+func (p *conditionalProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
+	if p.validator == "v1" {
+		p.loaded++
+		return nil, herd.ErrNotModified
+	}
+	return p.fakeProvider.Load(ctx, lm)
+}
+
+func makeStale(t *testing.T, c *Cache) {
+	then := time.Now().Add(-2 * c.config.Lifetime)
+	if err := os.Chtimes(c.config.File, then, then); err != nil {
+		t.Fatalf("Unable to age cache file: %s", err)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	tmpdir := t.TempDir()
+	p := &fakeProvider{}
+	c := NewFromProvider(p).(*Cache)
+	c.config.StaleWhileRevalidate = true
+	c.SetCacheDir(tmpdir)
+	if _, err := c.Load(context.Background(), func(string, bool, error) {}); err != nil || p.loaded != 1 {
+		t.Fatalf("Initial load did not go to the backend provider")
+	}
+	makeStale(t, c)
+	p.value = "baz"
+	hosts, err := c.Load(context.Background(), func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 || hosts[0].Attributes["foo"] != "bar" {
+		t.Errorf("Stale data was not returned: %v %v", hosts, err)
+	}
+	c.WaitForRefresh()
+	if p.loaded != 2 {
+		t.Errorf("Stale data was not refreshed in the background")
+	}
+	if c.mustRefresh() {
+		t.Errorf("Cache is still stale after refreshing")
+	}
+	hosts, _ = c.Load(context.Background(), func(string, bool, error) {})
+	if len(hosts) != 1 || hosts[0].Attributes["foo"] != "baz" {
+		t.Errorf("Refreshed data was not stored: %v", hosts)
+	}
+
+	// Explicit refreshes always block
+	c.Invalidate()
+	p.value = "quux"
+	hosts, _ = c.Load(context.Background(), func(string, bool, error) {})
+	if p.loaded != 3 || len(hosts) != 1 || hosts[0].Attributes["foo"] != "quux" {
+		t.Errorf("Invalidated cache did not load new data: %v", hosts)
+	}
+
+	files, _ := ioutil.ReadDir(tmpdir)
+	if len(files) != 1 {
+		t.Errorf("Expected only the cache file, found %d files", len(files))
+	}
+}
+
+// A provider that takes a while to load, or forever if its delay is negative
+type slowProvider struct {
+	fakeProvider
+	delay time.Duration
+}
+
+func (p *slowProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
+	if p.delay < 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return p.fakeProvider.Load(ctx, lm)
+}
+
+func TestWaitForRefresh(t *testing.T) {
+	tmpdir := t.TempDir()
+	p := &slowProvider{}
+	c := NewFromProvider(p).(*Cache)
+	c.config.StaleWhileRevalidate = true
+	c.SetCacheDir(tmpdir)
+	if _, err := c.Load(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Initial load failed: %s", err)
+	}
+	makeStale(t, c)
+	p.delay = 100 * time.Millisecond
+	p.value = "baz"
+	hosts, err := c.Load(context.Background(), func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 || hosts[0].Attributes["foo"] != "bar" {
+		t.Fatalf("Stale data was not returned: %v %v", hosts, err)
+	}
+	c.WaitForRefresh()
+
+	// The next invocation gets the refreshed data from the cache
+	p2 := &fakeProvider{value: "quux"}
+	c2 := NewFromProvider(p2).(*Cache)
+	c2.config.StaleWhileRevalidate = true
+	c2.SetCacheDir(tmpdir)
+	hosts, err = c2.Load(context.Background(), func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 || hosts[0].Attributes["foo"] != "baz" || p2.loaded != 0 {
+		t.Errorf("Next invocation did not see the refreshed data: %v %v", hosts, err)
+	}
+}
+
+func TestWaitForRefreshTimeout(t *testing.T) {
+	p := &slowProvider{}
+	c := NewFromProvider(p).(*Cache)
+	c.config.StaleWhileRevalidate = true
+	c.SetCacheDir(t.TempDir())
+	if _, err := c.Load(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Initial load failed: %s", err)
+	}
+	makeStale(t, c)
+	p.delay = -1
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	hosts, err := c.Load(ctx, func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("Stale data was not returned: %v %v", hosts, err)
+	}
+	// Loading is done, but the refresh may still use the load timeout
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		c.WaitForRefresh()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Waiting for the background refresh did not stop at the load timeout")
+	}
+	if !c.mustRefresh() {
+		t.Errorf("A refresh that timed out should leave the cache stale")
+	}
+}
+
+func TestConditionalRefresh(t *testing.T) {
+	p := &conditionalProvider{}
+	c := NewFromProvider(p).(*Cache)
+	c.SetCacheDir(t.TempDir())
+	if _, err := c.Load(context.Background(), func(string, bool, error) {}); err != nil || p.loaded != 1 {
+		t.Fatalf("Initial load did not go to the backend provider")
+	}
+	makeStale(t, c)
+	hosts, err := c.Load(context.Background(), func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 {
+		t.Errorf("Cached data was not used when the source was not modified: %v %v", hosts, err)
+	}
+	if p.loaded != 2 {
+		t.Errorf("Source was not asked whether its data was modified")
+	}
+	if c.mustRefresh() {
+		t.Errorf("Unmodified data did not reset the cache lifetime")
+	}
+}
+
+func TestLegacyCacheFile(t *testing.T) {
+	p := &fakeProvider{}
+	c := NewFromProvider(p).(*Cache)
+	c.SetCacheDir(t.TempDir())
+	data, _ := json.Marshal(herd.Hosts{herd.NewHost("legacy-host", "", herd.HostAttributes{})})
+	if err := ioutil.WriteFile(c.config.File, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := c.Load(context.Background(), func(string, bool, error) {})
+	if err != nil || len(hosts) != 1 || hosts[0].Name != "legacy-host" || p.loaded != 0 {
+		t.Errorf("Old style cache file was not used: %v %v", hosts, err)
+	}
+}
@@ -143,7 +143,16 @@ func (p *consulProvider) loadDatacenter(ctx context.Context, dc string) (herd.Ho
 	for i, node := range catalognodes {
 		nodePositions[node.Node] = i
 		ap := strings.Split(node.Address, ":")
-		hosts[i] = herd.NewHost(node.Node, ap[0], herd.HostAttributes{"datacenter": node.Datacenter})
+		attrs := herd.HostAttributes{"datacenter": node.Datacenter}
+		// Node meta is namespaced, so herd_port in node meta becomes
+		// meta:herd_port and only sets the port after a rename rule.
+		for k, v := range node.Meta {
+			attrs[fmt.Sprintf("meta:%s", k)] = v
+		}
+		for k, v := range node.TaggedAddresses {
+			attrs[fmt.Sprintf("address:%s", k)] = v
+		}
+		hosts[i] = herd.NewHost(node.Node, ap[0], attrs)
 	}
 	services, _, err := catalog.Services(opts)
 	if err != nil {
@@ -163,6 +172,16 @@ func (p *consulProvider) loadDatacenter(ctx context.Context, dc string) (herd.Ho
 			}
 			h.Attributes["service"] = append(s, service.ServiceName)
 			h.Attributes[fmt.Sprintf("service:%s", service.ServiceName)] = service.ServiceTags
+			t := []string{}
+			if ti, ok := h.Attributes["service_tags"]; ok {
+				t = ti.([]string)
+			}
+			for _, tag := range service.ServiceTags {
+				if !stringInList(t, tag) {
+					t = append(t, tag)
+				}
+			}
+			h.Attributes["service_tags"] = t
 		}
 	}
 
@@ -172,6 +191,69 @@ func (p *consulProvider) loadDatacenter(ctx context.Context, dc string) (herd.Ho
 			sort.Strings(ss)
 			h.Attributes["service"] = ss
 		}
+		if t, ok := h.Attributes["service_tags"]; ok {
+			sort.Strings(t.([]string))
+		}
+	}
+
+	checks, _, err := client.Health().State(consul.HealthAny, opts)
+	if err != nil {
+		return nil, err
 	}
+	addHealth(hosts, nodePositions, checks)
 	return hosts, nil
 }
+
+var healthOrder = map[string]int{
+	consul.HealthPassing:  0,
+	consul.HealthWarning:  1,
+	consul.HealthCritical: 2,
+	consul.HealthMaint:    2,
+}
+
+func worstHealth(a, b string) string {
+	if a == "" || healthOrder[b] > healthOrder[a] {
+		return b
+	}
+	return a
+}
+
+// Health checks are added per check as check:<id> with the check status, per
+// service as health:<service> and for the whole node as consul_health. The
+// latter two contain the worst status of all relevant checks. Node checks,
+// such as consul's own serfHealth, count towards the health of all services on
+// that node, like they do in consul itself.
+func addHealth(hosts herd.Hosts, nodePositions map[string]int, checks consul.HealthChecks) {
+	nodeHealth := make(map[string]string)
+	for _, check := range checks {
+		if check.ServiceID == "" {
+			nodeHealth[check.Node] = worstHealth(nodeHealth[check.Node], check.Status)
+		}
+	}
+	for _, h := range hosts {
+		status := nodeHealth[h.Name]
+		if status == "" {
+			status = consul.HealthPassing
+		}
+		h.Attributes["consul_health"] = status
+		if s, ok := h.Attributes["service"]; ok {
+			for _, svc := range s.([]string) {
+				h.Attributes[fmt.Sprintf("health:%s", svc)] = status
+			}
+		}
+	}
+	for _, check := range checks {
+		pos, ok := nodePositions[check.Node]
+		if !ok {
+			continue
+		}
+		h := hosts[pos]
+		h.Attributes[fmt.Sprintf("check:%s", check.CheckID)] = check.Status
+		h.Attributes["consul_health"] = worstHealth(h.Attributes["consul_health"].(string), check.Status)
+		if check.ServiceName != "" {
+			key := fmt.Sprintf("health:%s", check.ServiceName)
+			current, _ := h.Attributes[key].(string)
+			h.Attributes[key] = worstHealth(current, check.Status)
+		}
+	}
+}
@@ -51,6 +51,10 @@ func TestConsulMock(t *testing.T) {
 		httpmock.NewStringResponder(200, mockServices("site1", "service2", 2)))
 	httpmock.RegisterResponder("GET", "=~http://consul.ci:8080/v1/catalog/service/service2.*site2",
 		httpmock.NewStringResponder(200, mockServices("site2", "service2", 2)))
+	httpmock.RegisterResponder("GET", "=~http://consul.ci:8080/v1/health/state/any.*site1",
+		httpmock.NewStringResponder(200, mockChecks("site1")))
+	httpmock.RegisterResponder("GET", "=~http://consul.ci:8080/v1/health/state/any.*site2",
+		httpmock.NewStringResponder(200, mockChecks("site2")))
 
 	p.config.Address = "http://consul.ci:8080"
 	ctx := context.Background()
@@ -88,10 +92,70 @@ func TestConsulMock(t *testing.T) {
 				}
 			}
 		}
-		_ = i
+		if h.Attributes["meta:rack"] != fmt.Sprintf("rack-%d", i%10%3) {
+			t.Errorf("node meta not set for %s: %v", h.Name, h.Attributes["meta:rack"])
+		}
+		if h.Attributes["address:wan"] != "127.0.0.1" {
+			t.Errorf("tagged addresses not set for %s", h.Name)
+		}
+		tags := h.Attributes["service_tags"].([]string)
+		if tags[0] != "service1" || tags[1] != "service1X" {
+			t.Errorf("incorrect service_tags %v set for %s", tags, h.Name)
+		}
+		// node-3 has a failing service check, node-5 a warning on the node itself
+		health := map[string]string{"node": "passing", "service1": "passing", "service2": "passing"}
+		switch i % 10 {
+		case 3:
+			health = map[string]string{"node": "critical", "service1": "critical"}
+		case 5:
+			health = map[string]string{"node": "warning", "service1": "warning"}
+		}
+		if h.Attributes["consul_health"] != health["node"] {
+			t.Errorf("incorrect consul_health %v for %s", h.Attributes["consul_health"], h.Name)
+		}
+		if h.Attributes["health:service1"] != health["service1"] {
+			t.Errorf("incorrect health:service1 %v for %s", h.Attributes["health:service1"], h.Name)
+		}
+		if s, ok := health["service2"]; ok && h.Attributes["health:service2"] != nil && h.Attributes["health:service2"] != s {
+			t.Errorf("incorrect health:service2 %v for %s", h.Attributes["health:service2"], h.Name)
+		}
+		if h.Attributes["check:serfHealth"] != "passing" && i%10 != 5 {
+			t.Errorf("serfHealth check not set for %s", h.Name)
+		}
 	}
 }
 
+func mockChecks(site string) string {
+	checks := []map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		node := fmt.Sprintf("node-%d.%s.consul.ci", i, site)
+		status := "passing"
+		if i == 5 {
+			status = "warning"
+		}
+		checks = append(checks, map[string]interface{}{
+			"Node":    node,
+			"CheckID": "serfHealth",
+			"Name":    "Serf Health Status",
+			"Status":  status,
+		})
+		status = "passing"
+		if i == 3 {
+			status = "critical"
+		}
+		checks = append(checks, map[string]interface{}{
+			"Node":        node,
+			"CheckID":     "service:service1",
+			"Name":        "Service 'service1' check",
+			"Status":      status,
+			"ServiceID":   "service1",
+			"ServiceName": "service1",
+		})
+	}
+	data, _ := json.Marshal(checks)
+	return string(data)
+}
+
 func mockHosts(site string) string {
 	nodes := make([]map[string]interface{}, 10)
 	for i := 0; i < 10; i++ {
@@ -108,6 +172,7 @@ func mockHosts(site string) string {
 			},
 			"Meta": map[string]string{
 				"consul-network-segment": "",
+				"rack":                   fmt.Sprintf("rack-%d", i%3),
 			},
 			"NodeMeta": map[string]string{
 				"consul-network-segment": "",
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/common"
 
 	"github.com/spf13/viper"
 )
@@ -18,11 +19,14 @@ type exampleProvider struct {
 	config struct {
 		Prefix string
 		Color  string
+		Count  int
 	}
 }
 
 func newProvider(name string) herd.HostProvider {
-	return &exampleProvider{name: name}
+	p := &exampleProvider{name: name}
+	p.config.Count = 5
+	return p
 }
 
 func (p *exampleProvider) Name() string {
@@ -37,20 +41,57 @@ func (p *exampleProvider) Equivalent(o herd.HostProvider) bool {
 	return true
 }
 
+// When served as a plugin, herd uses this to validate the configuration
+// before sending it to the plugin, and to document the plugin.
+func (p *exampleProvider) Describe() *common.Schema {
+	return &common.Schema{
+		Description: "An example provider that generates hosts",
+		Fields: []common.Field{
+			{Name: "Color", Type: common.TypeString, Description: "The value of the config_color attribute"},
+			{Name: "Count", Type: common.TypeInt, Description: "The number of hosts to generate", Default: 5},
+		},
+	}
+}
+
 func (p *exampleProvider) ParseViper(v *viper.Viper) error {
 	return v.Unmarshal(&p.config)
 }
 
 func (p *exampleProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
-	nhosts := 5
-	hosts := make(herd.Hosts, nhosts)
-	for i := 0; i < nhosts; i++ {
-		attrs := herd.HostAttributes{
-			"static_attribute":  "static_value",
-			"dynamic_attribute": fmt.Sprintf("dynamic_value_%d", i),
-			"config_color":      p.config.Color,
+	hosts := make(herd.Hosts, 0, p.config.Count)
+	err := p.LoadStream(ctx, lm, func(batch herd.Hosts) error {
+		hosts = append(hosts, batch...)
+		return nil
+	})
+	return hosts, err
+}
+
+// When served as a plugin, providers can send hosts to herd in batches while
+// they are still loading, so large inventories don't need to be kept in memory
+// or sent in one go. Real providers would send every page they get from an
+// API.
+func (p *exampleProvider) LoadStream(ctx context.Context, lm herd.LoadingMessage, send func(herd.Hosts) error) error {
+	batchSize := 100
+	for start := 0; start < p.config.Count; start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + batchSize
+		if end > p.config.Count {
+			end = p.config.Count
+		}
+		hosts := make(herd.Hosts, 0, end-start)
+		for i := start; i < end; i++ {
+			attrs := herd.HostAttributes{
+				"static_attribute":  "static_value",
+				"dynamic_attribute": fmt.Sprintf("dynamic_value_%d", i),
+				"config_color":      p.config.Color,
+			}
+			hosts = append(hosts, herd.NewHost(fmt.Sprintf("host-%d.example.com", i), "", attrs))
+		}
+		if err := send(hosts); err != nil {
+			return err
 		}
-		hosts[i] = herd.NewHost(fmt.Sprintf("host-%d.example.com", i), "", attrs)
 	}
-	return hosts, nil
+	return nil
 }
@@ -1,8 +1,12 @@
 package example
 
 import (
-	"github.com/spf13/viper"
+	"context"
 	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/viper"
 )
 
 func TestConfigAttribute(t *testing.T) {
@@ -10,7 +14,7 @@ func TestConfigAttribute(t *testing.T) {
 	v.SetDefault("Color", "pink")
 	p := newProvider("example")
 	p.ParseViper(v)
-	h, _ := p.Load(nil, nil)
+	h, _ := p.Load(context.Background(), nil)
 	if h[0].Attributes["static_attribute"] != "static_value" {
 		t.Errorf("Static attribute has wrong value %s", h[0].Attributes["static_attribute"])
 	}
@@ -21,3 +25,21 @@ func TestConfigAttribute(t *testing.T) {
 		t.Errorf("Configured attribute has wrong value %s", h[0].Attributes["config_color"])
 	}
 }
+
+func TestLoadStream(t *testing.T) {
+	v := viper.New()
+	v.SetDefault("Count", 250)
+	p := newProvider("example").(*exampleProvider)
+	p.ParseViper(v)
+	batches := []int{}
+	err := p.LoadStream(context.Background(), nil, func(hosts herd.Hosts) error {
+		batches = append(batches, len(hosts))
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(batches) != 3 || batches[0] != 100 || batches[2] != 50 {
+		t.Errorf("Unexpected batches: %v", batches)
+	}
+}
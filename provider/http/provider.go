@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 
 	"github.com/seveas/herd"
 
@@ -18,9 +19,11 @@ func init() {
 }
 
 type HttpProvider struct {
-	name   string
-	client *http.Client
-	config struct {
+	name      string
+	client    *http.Client
+	validator string
+	received  string
+	config    struct {
 		Prefix   string
 		Url      string
 		Username string
@@ -53,6 +56,16 @@ func (p *HttpProvider) ParseViper(v *viper.Viper) error {
 	return v.Unmarshal(&p.config)
 }
 
+// We prefer ETags over modification times, and remember which one we used
+// so we know which header to send.
+func (p *HttpProvider) SetValidator(validator string) {
+	p.validator = validator
+}
+
+func (p *HttpProvider) Validator() string {
+	return p.received
+}
+
 func (p *HttpProvider) Fetch(ctx context.Context) ([]byte, error) {
 	req, err := http.NewRequest("GET", p.config.Url, nil)
 	if err != nil {
@@ -67,11 +80,20 @@ func (p *HttpProvider) Fetch(ctx context.Context) ([]byte, error) {
 			req.Header.Set(key, value)
 		}
 	}
+	if strings.HasPrefix(p.validator, "etag:") {
+		req.Header.Set("If-None-Match", p.validator[5:])
+	} else if strings.HasPrefix(p.validator, "last-modified:") {
+		req.Header.Set("If-Modified-Since", p.validator[14:])
+	}
 	resp, err := p.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && p.validator != "" {
+		return nil, herd.ErrNotModified
+	}
+	p.received = ""
 	if resp.StatusCode != 200 {
 		body, _ := ioutil.ReadAll(resp.Body)
 		return nil, fmt.Errorf("http response code %d: %s", resp.StatusCode, body)
@@ -80,6 +102,12 @@ func (p *HttpProvider) Fetch(ctx context.Context) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Only a complete, successful response can be validated later
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		p.received = "etag:" + etag
+	} else if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		p.received = "last-modified:" + lm
+	}
 	return body, nil
 }
 
@@ -95,3 +123,5 @@ func (p *HttpProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.H
 	}
 	return hosts, nil
 }
+
+var _ herd.ConditionalLoader = &HttpProvider{}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/seveas/herd"
@@ -45,6 +46,61 @@ func TestHttpProvider(t *testing.T) {
 
 }
 
+func TestConditionalFetch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	_, data := mockData()
+	respond := func(header, validator, value string) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == value {
+				return httpmock.NewStringResponse(304, ""), nil
+			}
+			resp := httpmock.NewStringResponse(200, data)
+			resp.Header.Set(validator, value)
+			return resp, nil
+		}
+	}
+	httpmock.RegisterResponder("GET", "http://inventory.example.com/etag", respond("If-None-Match", "ETag", `"v1"`))
+	httpmock.RegisterResponder("GET", "http://inventory.example.com/modified", respond("If-Modified-Since", "Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT"))
+
+	for _, path := range []string{"etag", "modified"} {
+		p := NewProvider("http").(*HttpProvider)
+		p.config.Url = "http://inventory.example.com/" + path
+		hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+		if err != nil || len(hosts) != 10 {
+			t.Errorf("Initial fetch from %s failed: %v", path, err)
+		}
+		validator := p.Validator()
+		if validator == "" {
+			t.Errorf("No validator received from %s", path)
+		}
+		p = NewProvider("http").(*HttpProvider)
+		p.config.Url = "http://inventory.example.com/" + path
+		p.SetValidator(validator)
+		if _, err = p.Load(context.Background(), func(string, bool, error) {}); err != herd.ErrNotModified {
+			t.Errorf("Expected data from %s to not be modified, got %v", path, err)
+		}
+	}
+}
+
+func TestErrorHasNoValidator(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://inventory.example.com/broken", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(500, "oops")
+		resp.Header.Set("ETag", `"broken"`)
+		return resp, nil
+	})
+	p := NewProvider("http").(*HttpProvider)
+	p.config.Url = "http://inventory.example.com/broken"
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Expected an error for a 500 response")
+	}
+	if v := p.Validator(); v != "" {
+		t.Errorf("Error responses should not set a validator, got %s", v)
+	}
+}
+
 func mockData() (herd.Hosts, string) {
 	nhosts := 10
 	hosts := make(herd.Hosts, nhosts)
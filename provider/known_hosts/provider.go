@@ -23,6 +23,7 @@ func init() {
 
 type knownHostsProvider struct {
 	name   string
+	magic  bool
 	config struct {
 		Prefix string
 		Files  []string
@@ -51,11 +52,20 @@ func magicProvider() herd.HostProvider {
 			files = append(files, filepath.Join(u.HomeDir, ".ssh", "known_hosts"))
 		}
 	}
-	p := &knownHostsProvider{name: "known_hosts"}
+	p := &knownHostsProvider{name: "known_hosts", magic: true}
 	p.config.Files = files
 	return p
 }
 
+// The magic provider also reads the known_hosts file maintained by herd
+// hostkeys update
+func (p *knownHostsProvider) SetDataDir(dir string) error {
+	if p.magic {
+		p.config.Files = append(p.config.Files, filepath.Join(dir, "known_hosts"))
+	}
+	return nil
+}
+
 func (p *knownHostsProvider) Equivalent(o herd.HostProvider) bool {
 	return reflect.DeepEqual(p.config.Files, o.(*knownHostsProvider).config.Files)
 }
@@ -109,3 +119,5 @@ func (p *knownHostsProvider) Load(ctx context.Context, lm herd.LoadingMessage) (
 	}
 	return hosts, nil
 }
+
+var _ herd.DataLoader = &knownHostsProvider{}
@@ -0,0 +1,301 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The subset of the kubeconfig format we need to talk to the API server
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string
+		Cluster struct {
+			Server                   string
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		}
+	}
+	Contexts []struct {
+		Name    string
+		Context struct {
+			Cluster   string
+			User      string
+			Namespace string
+		}
+	}
+	Users []struct {
+		Name string
+		User struct {
+			Token                 string
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string
+			Password              string
+			Exec                  *struct {
+				Command string
+				Args    []string
+				Env     []struct {
+					Name  string
+					Value string
+				}
+			}
+		}
+	}
+	dir string
+}
+
+// Connection details for a single context in a kubeconfig
+type cluster struct {
+	context   string
+	server    string
+	namespace string
+	client    *http.Client
+	token     string
+	username  string
+	password  string
+}
+
+// Load one or more kubeconfig files, separated like $KUBECONFIG. Like kubectl
+// does, the first file that defines a context, cluster or user wins.
+func loadKubeconfig(paths string) (*kubeconfig, error) {
+	ret := &kubeconfig{}
+	found := false
+	for _, path := range filepath.SplitList(paths) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		kc := &kubeconfig{}
+		if err := yaml.Unmarshal(data, kc); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", path, err)
+		}
+		// Relative paths are relative to the file they're in
+		dir := filepath.Dir(path)
+		for i := range kc.Clusters {
+			kc.Clusters[i].Cluster.CertificateAuthority = resolvePath(dir, kc.Clusters[i].Cluster.CertificateAuthority)
+		}
+		for i := range kc.Users {
+			u := &kc.Users[i].User
+			u.TokenFile = resolvePath(dir, u.TokenFile)
+			u.ClientCertificate = resolvePath(dir, u.ClientCertificate)
+			u.ClientKey = resolvePath(dir, u.ClientKey)
+		}
+		if ret.CurrentContext == "" {
+			ret.CurrentContext = kc.CurrentContext
+		}
+		ret.Clusters = append(ret.Clusters, kc.Clusters...)
+		ret.Contexts = append(ret.Contexts, kc.Contexts...)
+		ret.Users = append(ret.Users, kc.Users...)
+	}
+	if !found {
+		return nil, fmt.Errorf("No kubeconfig found in %s", paths)
+	}
+	return ret, nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (kc *kubeconfig) cluster(ctx context.Context, name string) (*cluster, error) {
+	if name == "" {
+		name = kc.CurrentContext
+	}
+	if name == "" {
+		return nil, fmt.Errorf("No context specified and no current context set")
+	}
+	c := &cluster{context: name}
+	var clusterName, userName string
+	found := false
+	for _, kctx := range kc.Contexts {
+		if kctx.Name == name {
+			clusterName, userName, c.namespace = kctx.Context.Cluster, kctx.Context.User, kctx.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No such context: %s", name)
+	}
+
+	tlsConfig := &tls.Config{}
+	found = false
+	for _, cl := range kc.Clusters {
+		if cl.Name != clusterName {
+			continue
+		}
+		found = true
+		c.server = strings.TrimRight(cl.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cl.Cluster.InsecureSkipTLSVerify
+		ca, err := dataOrFile(cl.Cluster.CertificateAuthorityData, cl.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, err
+		}
+		if ca != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("No certificates found in certificate authority for cluster %s", clusterName)
+			}
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("No such cluster: %s", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		user := u.User
+		c.token, c.username, c.password = user.Token, user.Username, user.Password
+		if c.token == "" && user.TokenFile != "" {
+			token, err := ioutil.ReadFile(user.TokenFile)
+			if err != nil {
+				return nil, err
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+		cert, err := dataOrFile(user.ClientCertificateData, user.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		key, err := dataOrFile(user.ClientKeyData, user.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		if user.Exec != nil {
+			env := os.Environ()
+			for _, e := range user.Exec.Env {
+				env = append(env, e.Name+"="+e.Value)
+			}
+			cmd := exec.CommandContext(ctx, user.Exec.Command, user.Exec.Args...)
+			cmd.Env = env
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("Unable to get credentials from %s: %s", user.Exec.Command, err)
+			}
+			var cred struct {
+				Status struct {
+					Token                 string
+					ClientCertificateData string
+					ClientKeyData         string
+				}
+			}
+			if err := json.Unmarshal(out, &cred); err != nil {
+				return nil, fmt.Errorf("Unable to parse credentials from %s: %s", user.Exec.Command, err)
+			}
+			if cred.Status.Token != "" {
+				c.token = cred.Status.Token
+			}
+			if cred.Status.ClientCertificateData != "" {
+				cert, key = []byte(cred.Status.ClientCertificateData), []byte(cred.Status.ClientKeyData)
+			}
+		}
+		if cert != nil && key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to load client certificate for %s: %s", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		break
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.client = &http.Client{Transport: transport}
+	return c, nil
+}
+
+// Certificates and keys can be embedded base64-encoded, or live in a file
+func dataOrFile(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// Fetch a list of objects, following continuation tokens until all objects
+// have been seen.
+func (c *cluster) list(ctx context.Context, path, labelSelector string, items func(json.RawMessage) error) error {
+	cont := ""
+	for {
+		req, err := http.NewRequest("GET", c.server+path, nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		q := req.URL.Query()
+		q.Set("limit", "500")
+		if cont != "" {
+			q.Set("continue", cont)
+		}
+		if labelSelector != "" {
+			q.Set("labelSelector", labelSelector)
+		}
+		req.URL.RawQuery = q.Encode()
+		req.Header.Set("Accept", "application/json")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("http response code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+		var list struct {
+			Metadata struct {
+				Continue string
+			}
+			Items json.RawMessage
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return err
+		}
+		if err := items(list.Items); err != nil {
+			return err
+		}
+		if list.Metadata.Continue == "" {
+			return nil
+		}
+		cont = list.Metadata.Continue
+	}
+}
@@ -0,0 +1,283 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/cache"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("kubernetes", newProvider, magicProvider)
+}
+
+type kubernetesProvider struct {
+	name   string
+	config struct {
+		Prefix             string
+		Kubeconfig         string
+		Context            string
+		LabelSelector      string
+		UseExternalAddress bool
+		Pods               bool
+		Namespaces         []string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	p := &kubernetesProvider{name: name}
+	if home, err := os.UserHomeDir(); err == nil {
+		p.config.Kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	return p
+}
+
+// Only use kubernetes automatically when explicitly pointed at a cluster via
+// the environment.
+func magicProvider() herd.HostProvider {
+	kc, _ := os.LookupEnv("KUBECONFIG")
+	if kc == "" {
+		return nil
+	}
+	p := newProvider("kubernetes").(*kubernetesProvider)
+	p.config.Kubeconfig = kc
+	return cache.NewFromProvider(p)
+}
+
+func (p *kubernetesProvider) Name() string {
+	return p.name
+}
+
+func (p *kubernetesProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *kubernetesProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*kubernetesProvider)
+	return p.config.Kubeconfig == op.config.Kubeconfig &&
+		p.config.Context == op.config.Context &&
+		p.config.LabelSelector == op.config.LabelSelector &&
+		p.config.Pods == op.config.Pods &&
+		reflect.DeepEqual(p.config.Namespaces, op.config.Namespaces)
+}
+
+func (p *kubernetesProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *kubernetesProvider) Load(ctx context.Context, lm herd.LoadingMessage) (hosts herd.Hosts, err error) {
+	lm(p.name, false, nil)
+	defer func() { lm(p.name, true, err) }()
+	kc, err := loadKubeconfig(p.config.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	c, err := kc.cluster(ctx, p.config.Context)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err = p.loadNodes(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.Pods {
+		namespaces := p.config.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = []string{""}
+		}
+		for _, ns := range namespaces {
+			pods, err := p.loadPods(ctx, c, ns)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, pods...)
+		}
+	}
+	return hosts, nil
+}
+
+type objectMeta struct {
+	Name              string
+	Namespace         string
+	Uid               string
+	CreationTimestamp string
+	Labels            map[string]string
+}
+
+type node struct {
+	Metadata objectMeta
+	Spec     struct {
+		PodCIDR       string
+		ProviderID    string
+		Unschedulable bool
+		Taints        []struct {
+			Key    string
+			Value  string
+			Effect string
+		}
+	}
+	Status struct {
+		Addresses []struct {
+			Type    string
+			Address string
+		}
+		Conditions []struct {
+			Type   string
+			Status string
+		}
+		NodeInfo struct {
+			Architecture            string
+			ContainerRuntimeVersion string
+			KernelVersion           string
+			KubeletVersion          string
+			OperatingSystem         string
+			OsImage                 string
+		}
+	}
+}
+
+func (p *kubernetesProvider) loadNodes(ctx context.Context, c *cluster) (herd.Hosts, error) {
+	hosts := herd.Hosts{}
+	err := c.list(ctx, "/api/v1/nodes", p.config.LabelSelector, func(data json.RawMessage) error {
+		var nodes []node
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			attrs := herd.HostAttributes{
+				"kind":              "node",
+				"kubecontext":       c.context,
+				"uid":               n.Metadata.Uid,
+				"creation_time":     n.Metadata.CreationTimestamp,
+				"pod_cidr":          n.Spec.PodCIDR,
+				"provider_id":       n.Spec.ProviderID,
+				"unschedulable":     n.Spec.Unschedulable,
+				"architecture":      n.Status.NodeInfo.Architecture,
+				"container_runtime": n.Status.NodeInfo.ContainerRuntimeVersion,
+				"kernel_version":    n.Status.NodeInfo.KernelVersion,
+				"kubelet_version":   n.Status.NodeInfo.KubeletVersion,
+				"operating_system":  n.Status.NodeInfo.OperatingSystem,
+				"os_image":          n.Status.NodeInfo.OsImage,
+			}
+			// Labels are namespaced, so they can't override the attributes above
+			for k, v := range n.Metadata.Labels {
+				attrs["label:"+k] = v
+			}
+			taints := []string{}
+			for _, t := range n.Spec.Taints {
+				taint := t.Key
+				if t.Value != "" {
+					taint += "=" + t.Value
+				}
+				taints = append(taints, taint+":"+t.Effect)
+			}
+			attrs["taints"] = taints
+			conditions := []string{}
+			attrs["ready"] = false
+			for _, cond := range n.Status.Conditions {
+				if cond.Status == "True" {
+					conditions = append(conditions, cond.Type)
+					if cond.Type == "Ready" {
+						attrs["ready"] = true
+					}
+				}
+			}
+			attrs["conditions"] = conditions
+			address := ""
+			for _, a := range n.Status.Addresses {
+				switch a.Type {
+				case "InternalIP":
+					attrs["internal_ip"] = a.Address
+					if address == "" || !p.config.UseExternalAddress {
+						address = a.Address
+					}
+				case "ExternalIP":
+					attrs["external_ip"] = a.Address
+					if address == "" || p.config.UseExternalAddress {
+						address = a.Address
+					}
+				}
+			}
+			hosts = append(hosts, herd.NewHost(n.Metadata.Name, address, attrs))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list nodes: %s", err)
+	}
+	return hosts, nil
+}
+
+type pod struct {
+	Metadata objectMeta
+	Spec     struct {
+		NodeName   string
+		Containers []struct {
+			Name  string
+			Image string
+		}
+	}
+	Status struct {
+		Phase  string
+		PodIP  string
+		HostIP string
+	}
+}
+
+// Pods are named pod.namespace, and set up to use the kubectl executor
+func (p *kubernetesProvider) loadPods(ctx context.Context, c *cluster, namespace string) (herd.Hosts, error) {
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/pods", namespace)
+	}
+	hosts := herd.Hosts{}
+	err := c.list(ctx, path, p.config.LabelSelector, func(data json.RawMessage) error {
+		var pods []pod
+		if err := json.Unmarshal(data, &pods); err != nil {
+			return err
+		}
+		for _, pd := range pods {
+			containers := make([]string, len(pd.Spec.Containers))
+			images := make([]string, len(pd.Spec.Containers))
+			for i, c := range pd.Spec.Containers {
+				containers[i] = c.Name
+				images[i] = c.Image
+			}
+			attrs := herd.HostAttributes{
+				"kind":             "pod",
+				"kubecontext":      c.context,
+				"uid":              pd.Metadata.Uid,
+				"creation_time":    pd.Metadata.CreationTimestamp,
+				"namespace":        pd.Metadata.Namespace,
+				"node":             pd.Spec.NodeName,
+				"phase":            strings.ToLower(pd.Status.Phase),
+				"pod_ip":           pd.Status.PodIP,
+				"host_ip":          pd.Status.HostIP,
+				"containers":       containers,
+				"images":           images,
+				"herd_transport":   "kubectl",
+				"herd_pod":         pd.Metadata.Name,
+				"herd_namespace":   pd.Metadata.Namespace,
+				"herd_kubecontext": c.context,
+			}
+			for k, v := range pd.Metadata.Labels {
+				attrs["label:"+k] = v
+			}
+			name := pd.Metadata.Name + "." + pd.Metadata.Namespace
+			hosts = append(hosts, herd.NewHost(name, pd.Status.PodIP, attrs))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list pods: %s", err)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,162 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/seveas/herd"
+)
+
+const nodesPage1 = `{"kind": "NodeList", "metadata": {"continue": "page2"}, "items": [{
+  "metadata": {"name": "node-1", "uid": "1234", "labels": {"kubernetes.io/os": "linux", "node-role.kubernetes.io/control-plane": ""}},
+  "spec": {"podCIDR": "10.244.0.0/24", "taints": [{"key": "node-role.kubernetes.io/control-plane", "effect": "NoSchedule"}]},
+  "status": {
+    "addresses": [{"type": "InternalIP", "address": "192.168.1.1"}, {"type": "ExternalIP", "address": "203.0.113.1"}, {"type": "Hostname", "address": "node-1"}],
+    "conditions": [{"type": "MemoryPressure", "status": "False"}, {"type": "Ready", "status": "True"}],
+    "nodeInfo": {"kubeletVersion": "v1.25.3", "architecture": "amd64"}
+  }
+}]}`
+
+const nodesPage2 = `{"kind": "NodeList", "metadata": {}, "items": [{
+  "metadata": {"name": "node-2", "labels": {"kubernetes.io/os": "linux", "ready": "yes"}},
+  "spec": {"unschedulable": true, "taints": [{"key": "dedicated", "value": "gpu", "effect": "NoExecute"}]},
+  "status": {
+    "addresses": [{"type": "InternalIP", "address": "192.168.1.2"}],
+    "conditions": [{"type": "Ready", "status": "Unknown"}]
+  }
+}]}`
+
+const pods = `{"kind": "PodList", "metadata": {}, "items": [{
+  "metadata": {"name": "web-5d4f8", "namespace": "shop", "labels": {"app": "web", "herd_transport": "ssh"}},
+  "spec": {"nodeName": "node-2", "containers": [{"name": "nginx", "image": "nginx:1.23"}]},
+  "status": {"phase": "Running", "podIP": "10.244.1.5", "hostIP": "192.168.1.2"}
+}]}`
+
+func fakeApiServer(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"kind": "Status", "message": "Unauthorized"}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			if r.URL.Query().Get("continue") == "page2" {
+				fmt.Fprint(w, nodesPage2)
+			} else {
+				fmt.Fprint(w, nodesPage1)
+			}
+		case "/api/v1/namespaces/shop/pods":
+			fmt.Fprint(w, pods)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func writeKubeconfig(t *testing.T, server *httptest.Server, token string) string {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test
+  context:
+    cluster: test-cluster
+    user: test-user
+users:
+- name: test-user
+  user:
+    token: %s
+`, server.URL, base64.StdEncoding.EncodeToString(ca), token)
+	fn := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(fn, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestKubernetesProvider(t *testing.T) {
+	server := fakeApiServer(t)
+	defer server.Close()
+
+	p := newProvider("kubernetes").(*kubernetesProvider)
+	p.config.Kubeconfig = writeKubeconfig(t, server, "s3cr3t")
+	p.config.Pods = true
+	p.config.Namespaces = []string{"shop"}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	if len(hosts) != 3 {
+		t.Fatalf("Expected 3 hosts, got %d", len(hosts))
+	}
+
+	node := hosts[0]
+	if node.Name != "node-1" || node.Address != "192.168.1.1" {
+		t.Errorf("Unexpected node name or address: %s %s", node.Name, node.Address)
+	}
+	expected := herd.HostAttributes{
+		"label:kubernetes.io/os": "linux",
+		"taints":                 []string{"node-role.kubernetes.io/control-plane:NoSchedule"},
+		"conditions":             []string{"Ready"},
+		"ready":                  true,
+		"external_ip":            "203.0.113.1",
+		"kubelet_version":        "v1.25.3",
+		"kubecontext":            "test",
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(node.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	node = hosts[1]
+	if node.Attributes["ready"] != false || node.Attributes["label:ready"] != "yes" || node.Attributes["unschedulable"] != true {
+		t.Errorf("Node status was not parsed correctly: %v", node.Attributes)
+	}
+	if diff := deep.Equal(node.Attributes["taints"], []string{"dedicated=gpu:NoExecute"}); diff != nil {
+		t.Errorf("Incorrect taints: %v", diff)
+	}
+
+	pod := hosts[2]
+	if pod.Name != "web-5d4f8.shop" || pod.Address != "10.244.1.5" {
+		t.Errorf("Unexpected pod name or address: %s %s", pod.Name, pod.Address)
+	}
+	if pod.Attributes["herd_transport"] != "kubectl" || pod.Attributes["herd_pod"] != "web-5d4f8" || pod.Attributes["node"] != "node-2" || pod.Attributes["label:app"] != "web" || pod.Attributes["label:herd_transport"] != "ssh" {
+		t.Errorf("Pod attributes were not set correctly: %v", pod.Attributes)
+	}
+
+	p.config.UseExternalAddress = true
+	hosts, _ = p.Load(context.Background(), func(string, bool, error) {})
+	if hosts[0].Address != "203.0.113.1" || hosts[1].Address != "192.168.1.2" {
+		t.Errorf("External addresses were not used: %s %s", hosts[0].Address, hosts[1].Address)
+	}
+}
+
+func TestKubernetesErrors(t *testing.T) {
+	server := fakeApiServer(t)
+	defer server.Close()
+
+	p := newProvider("kubernetes").(*kubernetesProvider)
+	p.config.Kubeconfig = writeKubeconfig(t, server, "wrong")
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Authentication errors should be returned")
+	}
+	p.config.Context = "nonexistent"
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil || err.Error() != "No such context: nonexistent" {
+		t.Errorf("Unexpected error for a missing context: %v", err)
+	}
+}
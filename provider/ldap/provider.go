@@ -0,0 +1,202 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("ldap", newProvider, nil)
+}
+
+type ldapProvider struct {
+	name   string
+	config struct {
+		Prefix             string
+		Url                string
+		StartTls           bool
+		CaFile             string
+		InsecureSkipVerify bool
+		BindDn             string
+		BindPassword       string
+		BaseDn             string
+		Filter             string
+		NameAttribute      string
+		AddressAttribute   string
+		Attributes         map[string]string
+		MultiValued        []string
+		ShortenDns         bool
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	p := &ldapProvider{name: name}
+	p.config.Filter = "(objectClass=*)"
+	p.config.NameAttribute = "cn"
+	p.config.MultiValued = []string{"memberOf", "objectClass"}
+	return p
+}
+
+func (p *ldapProvider) Name() string {
+	return p.name
+}
+
+func (p *ldapProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *ldapProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*ldapProvider)
+	return p.config.Url == op.config.Url &&
+		p.config.BindDn == op.config.BindDn &&
+		p.config.BaseDn == op.config.BaseDn &&
+		p.config.Filter == op.config.Filter &&
+		p.config.NameAttribute == op.config.NameAttribute &&
+		p.config.AddressAttribute == op.config.AddressAttribute &&
+		reflect.DeepEqual(p.config.Attributes, op.config.Attributes)
+}
+
+func (p *ldapProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *ldapProvider) tlsConfig() (*tls.Config, error) {
+	u, err := url.Parse(p.config.Url)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: p.config.InsecureSkipVerify}
+	if p.config.CaFile != "" {
+		ca, err := ioutil.ReadFile(p.config.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No certificates found in %s", p.config.CaFile)
+		}
+	}
+	return config, nil
+}
+
+func (p *ldapProvider) Load(ctx context.Context, lm herd.LoadingMessage) (hosts herd.Hosts, err error) {
+	lm(p.name, false, nil)
+	defer func() { lm(p.name, true, err) }()
+	tlsConfig, err := p.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := goldap.DialURL(p.config.Url, goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// The ldap library doesn't know about contexts, so we close the
+	// connection to abort any in-flight request
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	if p.config.StartTls {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	if p.config.BindDn != "" {
+		if err := conn.Bind(p.config.BindDn, p.config.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without a mapping we fetch all attributes and use their lowercased
+	// names, as ldap attribute names are case insensitive anyway.
+	var attributes []string
+	mapping := make(map[string]string)
+	for k, v := range p.config.Attributes {
+		mapping[strings.ToLower(k)] = v
+		attributes = append(attributes, k)
+	}
+	if len(attributes) != 0 {
+		attributes = append(attributes, p.config.NameAttribute)
+		if p.config.AddressAttribute != "" {
+			attributes = append(attributes, p.config.AddressAttribute)
+		}
+	}
+	multiValued := make(map[string]bool)
+	for _, a := range p.config.MultiValued {
+		multiValued[strings.ToLower(a)] = true
+	}
+
+	req := goldap.NewSearchRequest(p.config.BaseDn, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false, p.config.Filter, attributes, nil)
+	res, err := conn.SearchWithPaging(req, 500)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	hosts = make(herd.Hosts, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		name := e.GetAttributeValue(p.config.NameAttribute)
+		if name == "" {
+			continue
+		}
+		address := ""
+		if p.config.AddressAttribute != "" {
+			address = e.GetAttributeValue(p.config.AddressAttribute)
+		}
+		attrs := herd.HostAttributes{"dn": e.DN}
+		for _, a := range e.Attributes {
+			key := strings.ToLower(a.Name)
+			if len(mapping) != 0 {
+				if key = mapping[key]; key == "" {
+					continue
+				}
+			}
+			values := a.Values
+			if p.config.ShortenDns {
+				values = make([]string, len(a.Values))
+				for i, v := range a.Values {
+					values[i] = shortenDn(v)
+				}
+			}
+			if len(values) == 1 && !multiValued[strings.ToLower(a.Name)] {
+				attrs[key] = values[0]
+			} else {
+				attrs[key] = values
+			}
+		}
+		hosts = append(hosts, herd.NewHost(name, address, attrs))
+	}
+	return hosts, nil
+}
+
+// Turn cn=web,cn=hostgroups,cn=accounts,dc=example,dc=com into web, leave
+// values that are not distinguished names alone.
+func shortenDn(value string) string {
+	if !strings.Contains(value, "=") || !strings.Contains(value, ",") {
+		return value
+	}
+	dn, err := goldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return value
+	}
+	return dn.RDNs[0].Attributes[0].Value
+}
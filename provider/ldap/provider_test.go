@@ -0,0 +1,157 @@
+package ldap
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var freeipaHosts = []testEntry{
+	{
+		dn: "fqdn=web01.example.com,cn=computers,cn=accounts,dc=example,dc=com",
+		attributes: map[string][]string{
+			"fqdn":               {"web01.example.com"},
+			"objectClass":        {"top", "ipahost"},
+			"memberOf":           {"cn=web,cn=hostgroups,cn=accounts,dc=example,dc=com", "cn=allow_web,cn=hbac,dc=example,dc=com"},
+			"nsHardwarePlatform": {"x86_64"},
+			"ipHostNumber":       {"192.168.1.10"},
+		},
+	},
+	{
+		dn: "fqdn=db01.example.com,cn=computers,cn=accounts,dc=example,dc=com",
+		attributes: map[string][]string{
+			"fqdn":        {"db01.example.com"},
+			"objectClass": {"top", "ipahost"},
+			"memberOf":    {"cn=db,cn=hostgroups,cn=accounts,dc=example,dc=com"},
+		},
+	},
+	{
+		dn:         "cn=orphan,cn=computers,cn=accounts,dc=example,dc=com",
+		attributes: map[string][]string{"objectClass": {"top"}},
+	},
+}
+
+func newTestProvider(t *testing.T, s *testServer, scheme string, ca []byte) *ldapProvider {
+	t.Helper()
+	s.bindDn = "uid=herd,cn=sysaccounts,dc=example,dc=com"
+	s.password = "s3cr3t"
+	s.baseDn = "cn=computers,cn=accounts,dc=example,dc=com"
+	s.filter = "(objectClass=ipaHost)"
+	s.entries = freeipaHosts
+	p := newProvider("ldap").(*ldapProvider)
+	p.config.Url = scheme + "://" + s.addr()
+	p.config.BindDn = s.bindDn
+	p.config.BindPassword = s.password
+	p.config.BaseDn = s.baseDn
+	p.config.Filter = s.filter
+	p.config.NameAttribute = "fqdn"
+	if ca != nil {
+		p.config.CaFile = filepath.Join(t.TempDir(), "ca.pem")
+		if err := ioutil.WriteFile(p.config.CaFile, ca, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestLdap(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	p := newTestProvider(t, s, "ldap", nil)
+	p.config.BindPassword = "wrong"
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Bind with an incorrect password should fail")
+	}
+	p.config.BindPassword = s.password
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query ldap server: %s", err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", len(hosts))
+	}
+	h := hosts[0]
+	if h.Name != "web01.example.com" || h.Address != "" {
+		t.Errorf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected := map[string]interface{}{
+		"dn":                 "fqdn=web01.example.com,cn=computers,cn=accounts,dc=example,dc=com",
+		"objectclass":        []string{"top", "ipahost"},
+		"memberof":           []string{"cn=web,cn=hostgroups,cn=accounts,dc=example,dc=com", "cn=allow_web,cn=hbac,dc=example,dc=com"},
+		"nshardwareplatform": "x86_64",
+		"iphostnumber":       "192.168.1.10",
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	// Configured multi-valued attributes are slices, even with one value
+	if diff := deep.Equal(hosts[1].Attributes["memberof"], []string{"cn=db,cn=hostgroups,cn=accounts,dc=example,dc=com"}); diff != nil {
+		t.Errorf("Incorrect memberof: %v", diff)
+	}
+}
+
+func TestLdapMapping(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	p := newTestProvider(t, s, "ldap", nil)
+	p.config.AddressAttribute = "ipHostNumber"
+	p.config.ShortenDns = true
+	p.config.Attributes = map[string]string{"memberOf": "groups", "nsHardwarePlatform": "arch"}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query ldap server: %s", err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", len(hosts))
+	}
+	h := hosts[0]
+	if h.Name != "web01.example.com" || h.Address != "192.168.1.10" {
+		t.Errorf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected := map[string]interface{}{
+		"dn":     "fqdn=web01.example.com,cn=computers,cn=accounts,dc=example,dc=com",
+		"groups": []string{"web", "allow_web"},
+		"arch":   "x86_64",
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	if _, ok := h.Attributes["objectclass"]; ok {
+		t.Errorf("Unmapped attributes should not be included")
+	}
+}
+
+func TestLdapTls(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		ldaps    bool
+		scheme   string
+		startTls bool
+	}{
+		{"ldaps", true, "ldaps", false},
+		{"starttls", false, "ldap", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ca := newTestServer(t, tc.ldaps)
+			p := newTestProvider(t, s, tc.scheme, nil)
+			p.config.StartTls = tc.startTls
+			if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+				t.Errorf("Untrusted certificate should result in an error")
+			}
+			p = newTestProvider(t, s, tc.scheme, ca)
+			p.config.StartTls = tc.startTls
+			hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+			if err != nil {
+				t.Fatalf("Failed to query ldap server: %s", err)
+			}
+			if len(hosts) != 2 {
+				t.Errorf("Expected 2 hosts, got %d", len(hosts))
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// A minimal in-process ldap server that supports just enough of the protocol
+// to test the provider: simple binds, StartTLS and subtree searches with an
+// exact filter match.
+type testServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	bindDn   string
+	password string
+	baseDn   string
+	filter   string
+	entries  []testEntry
+}
+
+type testEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func newTestServer(t *testing.T, ldaps bool) (*testServer, []byte) {
+	t.Helper()
+	cert, caPem := testCertificate(t)
+	s := &testServer{tls: &tls.Config{Certificates: []tls.Certificate{cert}}}
+	var err error
+	if ldaps {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tls)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatalf("Unable to start ldap server: %s", err)
+	}
+	t.Cleanup(func() { s.listener.Close() })
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, caPem
+}
+
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := goldap.LDAPResultInvalidCredentials
+			if dn == s.bindDn && password == s.password {
+				code = goldap.LDAPResultSuccess
+				bound = true
+			}
+			s.reply(conn, id, goldap.ApplicationBindResponse, code)
+		case goldap.ApplicationExtendedRequest:
+			s.reply(conn, id, goldap.ApplicationExtendedResponse, goldap.LDAPResultSuccess)
+			conn = tls.Server(conn, s.tls)
+		case goldap.ApplicationSearchRequest:
+			if !bound {
+				s.reply(conn, id, goldap.ApplicationSearchResultDone, goldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			filter, err := goldap.DecompileFilter(op.Children[6])
+			if err != nil || op.Children[0].Data.String() != s.baseDn || filter != s.filter {
+				s.reply(conn, id, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess)
+				continue
+			}
+			wanted := make(map[string]bool)
+			for _, a := range op.Children[7].Children {
+				wanted[strings.ToLower(a.Data.String())] = true
+			}
+			for _, e := range s.entries {
+				s.sendEntry(conn, id, e, wanted)
+			}
+			s.reply(conn, id, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess)
+		default:
+			return
+		}
+	}
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func (s *testServer) reply(conn net.Conn, id int64, tag ber.Tag, code int) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	conn.Write(envelope(id, op).Bytes())
+}
+
+func (s *testServer) sendEntry(conn net.Conn, id int64, e testEntry, wanted map[string]bool) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attributes {
+		if len(wanted) != 0 && !wanted[strings.ToLower(name)] {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	conn.Write(envelope(id, op).Bytes())
+}
+
+// Create a self-signed certificate for 127.0.0.1, returning it and the PEM
+// encoded certificate to use as CA.
+func testCertificate(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,290 @@
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/cache"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("netbox", newProvider, magicProvider)
+}
+
+type netboxProvider struct {
+	name   string
+	client *http.Client
+	config struct {
+		Prefix          string
+		Url             string
+		Token           string
+		Devices         bool
+		VirtualMachines bool
+		Filters         map[string]string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	p := &netboxProvider{name: name, client: http.DefaultClient}
+	p.config.Devices = true
+	p.config.VirtualMachines = true
+	return p
+}
+
+func magicProvider() herd.HostProvider {
+	u, _ := os.LookupEnv("NETBOX_URL")
+	if u == "" {
+		return nil
+	}
+	p := newProvider("netbox").(*netboxProvider)
+	p.config.Url = u
+	p.config.Token = os.Getenv("NETBOX_TOKEN")
+	return cache.NewFromProvider(p)
+}
+
+func (p *netboxProvider) Name() string {
+	return p.name
+}
+
+func (p *netboxProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *netboxProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*netboxProvider)
+	return p.config.Url == op.config.Url &&
+		p.config.Devices == op.config.Devices &&
+		p.config.VirtualMachines == op.config.VirtualMachines &&
+		reflect.DeepEqual(p.config.Filters, op.config.Filters)
+}
+
+func (p *netboxProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *netboxProvider) Load(ctx context.Context, lm herd.LoadingMessage) (hosts herd.Hosts, err error) {
+	lm(p.name, false, nil)
+	defer func() { lm(p.name, true, err) }()
+	hosts = herd.Hosts{}
+	if p.config.Devices {
+		err := p.list(ctx, "/api/dcim/devices/", func(data json.RawMessage) error {
+			var o object
+			if err := json.Unmarshal(data, &o); err != nil {
+				return err
+			}
+			if h := o.host("device"); h != nil {
+				hosts = append(hosts, h)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list devices: %s", err)
+		}
+	}
+	if p.config.VirtualMachines {
+		err := p.list(ctx, "/api/virtualization/virtual-machines/", func(data json.RawMessage) error {
+			var o object
+			if err := json.Unmarshal(data, &o); err != nil {
+				return err
+			}
+			if h := o.host("virtual_machine"); h != nil {
+				hosts = append(hosts, h)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list virtual machines: %s", err)
+		}
+	}
+	return hosts, nil
+}
+
+// Fetch all pages of a list endpoint, following the next links
+func (p *netboxProvider) list(ctx context.Context, path string, item func(json.RawMessage) error) error {
+	u, err := url.Parse(strings.TrimRight(p.config.Url, "/") + path)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("limit", "1000")
+	for k, v := range p.config.Filters {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	next := u.String()
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", "application/json")
+		if p.config.Token != "" {
+			req.Header.Set("Authorization", "Token "+p.config.Token)
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("http response code %d: %s", resp.StatusCode, body)
+		}
+		var page struct {
+			Next    string
+			Results []json.RawMessage
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		for _, r := range page.Results {
+			if err := item(r); err != nil {
+				return err
+			}
+		}
+		next = page.Next
+	}
+	return nil
+}
+
+type ref struct {
+	Name string
+	Slug string
+}
+
+// Choices like status are objects with a value and a label
+type choice struct {
+	Value string
+	Label string
+}
+
+type ipAddress struct {
+	Address string
+}
+
+// Devices and virtual machines share most of their fields. NetBox 4 renamed
+// device_role to role for devices, we accept both.
+type object struct {
+	Id         int64
+	Name       string
+	Status     choice
+	Site       *ref
+	Location   *ref
+	Rack       *ref
+	Position   *float64
+	Role       *ref
+	DeviceRole *ref `json:"device_role"`
+	DeviceType *struct {
+		Model        string
+		Slug         string
+		Manufacturer ref
+	} `json:"device_type"`
+	Platform     *ref
+	Tenant       *ref
+	Cluster      *ref
+	Serial       string
+	AssetTag     *string `json:"asset_tag"`
+	Vcpus        *float64
+	Memory       *int64
+	Disk         *int64
+	PrimaryIp    *ipAddress `json:"primary_ip"`
+	PrimaryIp4   *ipAddress `json:"primary_ip4"`
+	PrimaryIp6   *ipAddress `json:"primary_ip6"`
+	Tags         []ref
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+func (o *object) host(kind string) *herd.Host {
+	if o.Name == "" {
+		return nil
+	}
+	attrs := herd.HostAttributes{
+		"kind":      kind,
+		"netbox_id": o.Id,
+		"status":    o.Status.Value,
+	}
+	refs := map[string]*ref{
+		"site":     o.Site,
+		"location": o.Location,
+		"platform": o.Platform,
+		"tenant":   o.Tenant,
+		"cluster":  o.Cluster,
+		"role":     o.Role,
+	}
+	if o.Role == nil {
+		refs["role"] = o.DeviceRole
+	}
+	for k, r := range refs {
+		if r == nil {
+			continue
+		}
+		// Not all objects have a slug, clusters for example don't
+		if r.Slug != "" {
+			attrs[k] = r.Slug
+		} else {
+			attrs[k] = r.Name
+		}
+	}
+	if o.Rack != nil {
+		attrs["rack"] = o.Rack.Name
+	}
+	if o.Position != nil {
+		attrs["position"] = *o.Position
+	}
+	if o.DeviceType != nil {
+		attrs["manufacturer"] = o.DeviceType.Manufacturer.Slug
+		attrs["model"] = o.DeviceType.Model
+	}
+	if o.Serial != "" {
+		attrs["serial"] = o.Serial
+	}
+	if o.AssetTag != nil {
+		attrs["asset_tag"] = *o.AssetTag
+	}
+	if o.Vcpus != nil {
+		attrs["vcpus"] = *o.Vcpus
+	}
+	if o.Memory != nil {
+		attrs["memory"] = *o.Memory
+	}
+	if o.Disk != nil {
+		attrs["disk"] = *o.Disk
+	}
+	tags := make([]string, len(o.Tags))
+	for i, t := range o.Tags {
+		tags[i] = t.Slug
+	}
+	attrs["tags"] = tags
+	// Custom fields are named like NetBox's own filters for them
+	for k, v := range o.CustomFields {
+		if v == nil {
+			continue
+		}
+		if f, ok := v.(float64); ok && f == float64(int64(f)) {
+			v = int64(f)
+		}
+		attrs["cf_"+k] = v
+	}
+	address := ""
+	for _, ip := range []*ipAddress{o.PrimaryIp, o.PrimaryIp4, o.PrimaryIp6} {
+		if ip != nil && ip.Address != "" {
+			address = strings.SplitN(ip.Address, "/", 2)[0]
+			break
+		}
+	}
+	return herd.NewHost(o.Name, address, attrs)
+}
@@ -0,0 +1,132 @@
+package netbox
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+)
+
+const devicesPage1 = `{"count": 3, "next": "http://netbox.ci/api/dcim/devices/?limit=1000&offset=1000&status=active", "results": [
+  {"id": 1, "name": "sw01", "status": {"value": "active", "label": "Active"},
+   "site": {"name": "Amsterdam 1", "slug": "ams1"}, "rack": {"name": "R12"}, "position": 42.0,
+   "device_role": {"name": "Switch", "slug": "switch"}, "platform": {"name": "Junos", "slug": "junos"},
+   "device_type": {"model": "EX4300", "slug": "ex4300", "manufacturer": {"name": "Juniper", "slug": "juniper"}},
+   "serial": "PE3714", "asset_tag": null, "tenant": null,
+   "primary_ip": {"address": "10.0.0.2/24"}, "primary_ip4": {"address": "10.0.0.2/24"}, "primary_ip6": null,
+   "tags": [{"name": "Core", "slug": "core"}], "custom_fields": {"owner": "network", "uplinks": 4, "decommission": null}},
+  {"id": 2, "name": null, "status": {"value": "active", "label": "Active"}, "tags": [], "custom_fields": {}}
+]}`
+
+const devicesPage2 = `{"count": 3, "next": null, "results": [
+  {"id": 3, "name": "db01", "status": {"value": "active", "label": "Active"},
+   "site": {"name": "Amsterdam 1", "slug": "ams1"}, "role": {"name": "Database", "slug": "database"},
+   "primary_ip": {"address": "2001:db8::3/64"}, "tags": [], "custom_fields": {}}
+]}`
+
+const virtualMachines = `{"count": 1, "next": null, "results": [
+  {"id": 7, "name": "web01", "status": {"value": "active", "label": "Active"},
+   "site": {"name": "Amsterdam 1", "slug": "ams1"}, "cluster": {"name": "vmware-ams1"},
+   "role": {"name": "Webserver", "slug": "webserver"}, "vcpus": 2.0, "memory": 4096, "disk": 40,
+   "primary_ip": {"address": "10.0.1.7/24"},
+   "tags": [{"name": "Public", "slug": "public"}, {"name": "Core", "slug": "core"}], "custom_fields": {"owner": "web"}}
+]}`
+
+func TestNetboxMock(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	auth := func(body string) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "Token s3cr3t" {
+				return httpmock.NewStringResponse(403, `{"detail": "Invalid token"}`), nil
+			}
+			if req.URL.Query().Get("status") != "active" {
+				return httpmock.NewStringResponse(400, "Filter not applied"), nil
+			}
+			return httpmock.NewStringResponse(200, body), nil
+		}
+	}
+	httpmock.RegisterResponder("GET", "http://netbox.ci/api/dcim/devices/?limit=1000&status=active", auth(devicesPage1))
+	httpmock.RegisterResponder("GET", "http://netbox.ci/api/dcim/devices/?limit=1000&offset=1000&status=active", auth(devicesPage2))
+	httpmock.RegisterResponder("GET", "http://netbox.ci/api/virtualization/virtual-machines/?limit=1000&status=active", auth(virtualMachines))
+
+	p := newProvider("netbox").(*netboxProvider)
+	p.config.Url = "http://netbox.ci/"
+	p.config.Filters = map[string]string{"status": "active"}
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Missing token should result in an error")
+	}
+	p.config.Token = "s3cr3t"
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query mock netbox: %s", err)
+	}
+	if len(hosts) != 3 {
+		t.Fatalf("Expected 3 hosts, got %d", len(hosts))
+	}
+
+	h := hosts[0]
+	if h.Name != "sw01" || h.Address != "10.0.0.2" {
+		t.Errorf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected := map[string]interface{}{
+		"kind":         "device",
+		"netbox_id":    int64(1),
+		"status":       "active",
+		"site":         "ams1",
+		"rack":         "R12",
+		"position":     42.0,
+		"role":         "switch",
+		"platform":     "junos",
+		"manufacturer": "juniper",
+		"model":        "EX4300",
+		"serial":       "PE3714",
+		"tags":         []string{"core"},
+		"cf_owner":     "network",
+		"cf_uplinks":   int64(4),
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	if _, ok := h.Attributes["cf_decommission"]; ok {
+		t.Errorf("Unset custom fields should not become attributes")
+	}
+
+	h = hosts[1]
+	if h.Name != "db01" || h.Address != "2001:db8::3" || h.Attributes["role"] != "database" {
+		t.Errorf("Incorrect name, address or role: %s %s %v", h.Name, h.Address, h.Attributes["role"])
+	}
+
+	h = hosts[2]
+	if h.Name != "web01" || h.Address != "10.0.1.7" {
+		t.Errorf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected = map[string]interface{}{
+		"kind":     "virtual_machine",
+		"cluster":  "vmware-ams1",
+		"role":     "webserver",
+		"vcpus":    2.0,
+		"memory":   int64(4096),
+		"disk":     int64(40),
+		"tags":     []string{"public", "core"},
+		"cf_owner": "web",
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+
+	p.config.VirtualMachines = false
+	hosts, err = p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query mock netbox: %s", err)
+	}
+	if len(hosts) != 2 {
+		t.Errorf("Expected only the 2 devices, got %d hosts", len(hosts))
+	}
+}
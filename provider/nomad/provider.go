@@ -0,0 +1,175 @@
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/cache"
+
+	"github.com/seveas/scattergather"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("nomad", newProvider, magicProvider)
+}
+
+type nomadProvider struct {
+	name   string
+	client *http.Client
+	config struct {
+		Prefix  string
+		Address string
+		Token   string
+		Region  string
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &nomadProvider{name: name, client: http.DefaultClient}
+}
+
+func magicProvider() herd.HostProvider {
+	addr, _ := os.LookupEnv("NOMAD_ADDR")
+	if addr == "" {
+		return nil
+	}
+	p := newProvider("nomad").(*nomadProvider)
+	p.config.Address = addr
+	p.config.Token = os.Getenv("NOMAD_TOKEN")
+	p.config.Region = os.Getenv("NOMAD_REGION")
+	return cache.NewFromProvider(p)
+}
+
+func (p *nomadProvider) Name() string {
+	return p.name
+}
+
+func (p *nomadProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *nomadProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*nomadProvider)
+	return p.config.Address == op.config.Address &&
+		p.config.Region == op.config.Region
+}
+
+func (p *nomadProvider) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&p.config)
+}
+
+func (p *nomadProvider) get(ctx context.Context, path string, data interface{}) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(p.config.Address, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if p.config.Region != "" {
+		q := req.URL.Query()
+		q.Set("region", p.config.Region)
+		req.URL.RawQuery = q.Encode()
+	}
+	if p.config.Token != "" {
+		req.Header.Set("X-Nomad-Token", p.config.Token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("http response code %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, data)
+}
+
+type nodeStub struct {
+	ID                    string
+	Name                  string
+	Address               string
+	Datacenter            string
+	NodeClass             string
+	Status                string
+	SchedulingEligibility string
+	Drain                 bool
+	Version               string
+	Drivers               map[string]struct {
+		Detected bool
+		Healthy  bool
+	}
+}
+
+type node struct {
+	Attributes map[string]string
+	Meta       map[string]string
+}
+
+// Nomad client nodes become hosts. The node list contains everything but the
+// node attributes and metadata, which we fetch per node.
+func (p *nomadProvider) Load(ctx context.Context, lm herd.LoadingMessage) (hosts herd.Hosts, err error) {
+	lm(p.name, false, nil)
+	defer func() { lm(p.name, true, err) }()
+	var stubs []nodeStub
+	if err := p.get(ctx, "/v1/nodes", &stubs); err != nil {
+		return nil, err
+	}
+	sg := scattergather.New(10)
+	for _, stub := range stubs {
+		sg.Run(func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			stub := args[0].(nodeStub)
+			var n node
+			if err := p.get(ctx, "/v1/node/"+stub.ID, &n); err != nil {
+				return nil, err
+			}
+			return p.host(stub, n), nil
+		}, ctx, stub)
+	}
+	results, err := sg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	hosts = make(herd.Hosts, len(results))
+	for i, h := range results {
+		hosts[i] = h.(*herd.Host)
+	}
+	return hosts, nil
+}
+
+func (p *nomadProvider) host(stub nodeStub, n node) *herd.Host {
+	drivers := []string{}
+	for name, driver := range stub.Drivers {
+		if driver.Detected && driver.Healthy {
+			drivers = append(drivers, name)
+		}
+	}
+	sort.Strings(drivers)
+	attrs := herd.HostAttributes{
+		"nomad_id":               stub.ID,
+		"datacenter":             stub.Datacenter,
+		"node_class":             stub.NodeClass,
+		"status":                 stub.Status,
+		"scheduling_eligibility": stub.SchedulingEligibility,
+		"drain":                  stub.Drain,
+		"nomad_version":          stub.Version,
+		"drivers":                drivers,
+	}
+	for k, v := range n.Attributes {
+		attrs[fmt.Sprintf("attr:%s", k)] = v
+	}
+	for k, v := range n.Meta {
+		attrs[fmt.Sprintf("meta:%s", k)] = v
+	}
+	return herd.NewHost(stub.Name, stub.Address, attrs)
+}
@@ -0,0 +1,96 @@
+package nomad
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+)
+
+const nodes = `[
+  {"ID": "f7476465-4d6e-c0de-26d0-e383c49be941", "Name": "client-1", "Address": "10.0.0.1", "Datacenter": "dc1", "NodeClass": "compute",
+   "Status": "ready", "SchedulingEligibility": "eligible", "Drain": false, "Version": "1.4.2",
+   "Drivers": {"docker": {"Detected": true, "Healthy": true}, "exec": {"Detected": true, "Healthy": true}, "qemu": {"Detected": false, "Healthy": false}}},
+  {"ID": "4a45b2ce-8b5f-b3b8-0c38-c8bae2c4ce38", "Name": "client-2", "Address": "10.0.0.2", "Datacenter": "dc2", "NodeClass": "",
+   "Status": "down", "SchedulingEligibility": "ineligible", "Drain": true, "Version": "1.4.1",
+   "Drivers": {"docker": {"Detected": true, "Healthy": false}}}
+]`
+
+const node1 = `{"ID": "f7476465-4d6e-c0de-26d0-e383c49be941", "Attributes": {"kernel.name": "linux", "cpu.arch": "amd64"}, "Meta": {"rack": "r1"}}`
+const node2 = `{"ID": "4a45b2ce-8b5f-b3b8-0c38-c8bae2c4ce38", "Attributes": {"kernel.name": "linux", "cpu.arch": "arm64"}, "Meta": {}}`
+
+func TestNomadMock(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://nomad.ci:4646/v1/nodes",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("X-Nomad-Token") != "s3cr3t" || req.URL.Query().Get("region") != "europe" {
+				return httpmock.NewStringResponse(403, "Permission denied"), nil
+			}
+			return httpmock.NewStringResponse(200, nodes), nil
+		})
+	httpmock.RegisterResponder("GET", "=~http://nomad.ci:4646/v1/node/f7476465",
+		httpmock.NewStringResponder(200, node1))
+	httpmock.RegisterResponder("GET", "=~http://nomad.ci:4646/v1/node/4a45b2ce",
+		httpmock.NewStringResponder(200, node2))
+
+	p := newProvider("nomad").(*nomadProvider)
+	p.config.Address = "http://nomad.ci:4646/"
+	p.config.Region = "europe"
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Missing token should result in an error")
+	}
+	p.config.Token = "s3cr3t"
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to query mock nomad: %s", err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", len(hosts))
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	h := hosts[0]
+	if h.Name != "client-1" || h.Address != "10.0.0.1" {
+		t.Errorf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected := map[string]interface{}{
+		"datacenter":    "dc1",
+		"node_class":    "compute",
+		"status":        "ready",
+		"drivers":       []string{"docker", "exec"},
+		"attr:cpu.arch": "amd64",
+		"meta:rack":     "r1",
+		"nomad_version": "1.4.2",
+		"domainname":    "",
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	h = hosts[1]
+	if diff := deep.Equal(h.Attributes["drivers"], []string{}); diff != nil {
+		t.Errorf("Unhealthy drivers should not be listed: %v", diff)
+	}
+	if h.Attributes["drain"] != true || h.Attributes["attr:cpu.arch"] != "arm64" {
+		t.Errorf("Incorrect attributes: %v", h.Attributes)
+	}
+}
+
+func TestProviderEquivalence(t *testing.T) {
+	p1 := newProvider("test").(*nomadProvider)
+	p1.config.Address = "http://nomad:4646"
+	p2 := newProvider("test 2").(*nomadProvider)
+	p2.config.Address = "http://nomad:4646"
+	p2.config.Prefix = "nomad:"
+	if !p1.Equivalent(p2) {
+		t.Errorf("Equivalence not properly detected")
+	}
+	p2.config.Region = "europe"
+	if p1.Equivalent(p2) {
+		t.Errorf("Non-equivalence not properly detected")
+	}
+}
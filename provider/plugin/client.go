@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/seveas/herd/provider/plugin/common"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// Plugins are found in $PATH as herd-<kind>-<name>, optionally with an .exe
+// suffix.
+func findCommand(kind, name string) string {
+	command := ""
+	if path, err := exec.LookPath(fmt.Sprintf("herd-%s-%s", kind, name)); err == nil {
+		command = path
+	}
+	if path, err := exec.LookPath(fmt.Sprintf("herd-%s-%s.exe", kind, name)); err == nil {
+		command = path
+	}
+	return command
+}
+
+// Find the names of all plugins of a kind in $PATH.
+func Discover(kind string) []string {
+	prefix := fmt.Sprintf("herd-%s-", kind)
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), prefix), ".exe")
+			if name == "" || seen[name] || findCommand(kind, name) == "" {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newClient(command, name string, managed bool) *plugin.Client {
+	return plugin.NewClient(&plugin.ClientConfig{
+		Managed:          managed,
+		HandshakeConfig:  common.Handshake,
+		VersionedPlugins: common.PluginSets,
+		Cmd:              exec.Command(command),
+		Logger:           common.NewLogrusLogger(logrus.StandardLogger(), name),
+		SyncStdout:       os.Stdout,
+		SyncStderr:       os.Stderr,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+	})
+}
+
+func dispense(client *plugin.Client, kind string) (interface{}, error) {
+	rpcClient, err := client.Client()
+	if err != nil {
+		return nil, err
+	}
+	return rpcClient.Dispense(kind)
+}
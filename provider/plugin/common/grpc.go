@@ -4,6 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/seveas/herd"
@@ -12,6 +18,8 @@ import (
 	plugin "github.com/hashicorp/go-plugin"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCClient struct {
@@ -21,11 +29,37 @@ type GRPCClient struct {
 }
 
 func (c *GRPCClient) Configure(settings map[string]interface{}) error {
+	return configure(c.ctx, settings, c.client.Configure)
+}
+
+// Plugins built against older versions of herd can't describe their
+// configuration, for those the schema is nil.
+func (c *GRPCClient) Schema() (*Schema, error) {
+	resp, err := c.client.Describe(c.ctx, &Empty{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	schema := &Schema{Description: resp.Description, Fields: make([]Field, len(resp.Fields))}
+	for i, f := range resp.Fields {
+		schema.Fields[i] = Field{Name: f.Name, Type: f.Type, Description: f.Description, Required: f.Required, Secret: f.Secret}
+		if len(f.Default) > 0 {
+			if err := json.Unmarshal(f.Default, &schema.Fields[i].Default); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return schema, nil
+}
+
+func configure(ctx context.Context, settings map[string]interface{}, fn func(context.Context, *ConfigureRequest, ...grpc.CallOption) (*ConfigureResponse, error)) error {
 	data, err := json.Marshal(settings)
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Configure(c.ctx, &ConfigureRequest{Data: data})
+	resp, err := fn(ctx, &ConfigureRequest{Data: data})
 	if err != nil {
 		return err
 	}
@@ -57,32 +91,90 @@ func (c *GRPCClient) Load(ctx context.Context, logger Logger) (herd.Hosts, error
 		deadline = time.Now().Add(10 * time.Minute)
 	}
 	ts, _ := ptypes.TimestampProto(deadline)
-	resp, err := c.client.Load(c.ctx, &LoadRequest{Deadline: ts, Logger: id})
+	req := &LoadRequest{Deadline: ts, Logger: id}
+	hosts, err := c.loadStream(req)
+	if status.Code(err) != codes.Unimplemented {
+		return hosts, err
+	}
+	// Plugins built against older versions of herd can only send all hosts at once
+	resp, err := c.client.Load(c.ctx, req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.Err != "" {
 		return nil, errors.New(resp.Err)
 	}
-	var hosts herd.Hosts
+	hosts = nil
 	if err = json.Unmarshal(resp.Data, &hosts); err != nil {
 		return nil, err
 	}
 	return hosts, nil
 }
 
+func (c *GRPCClient) loadStream(req *LoadRequest) (herd.Hosts, error) {
+	stream, err := c.client.LoadStream(c.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(herd.Hosts, 0)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return hosts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.Err != "" {
+			return nil, errors.New(resp.Err)
+		}
+		var batch herd.Hosts
+		if err = json.Unmarshal(resp.Data, &batch); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, batch...)
+	}
+}
+
 type GRPCServer struct {
 	UnimplementedProviderServer
 	Impl   Provider
 	broker *plugin.GRPCBroker
 }
 
+func (s *GRPCServer) Describe(ctx context.Context, req *Empty) (*DescribeResponse, error) {
+	var schema *Schema
+	if d, ok := s.Impl.(Describer); ok {
+		schema = d.Describe()
+	}
+	if schema == nil {
+		return s.UnimplementedProviderServer.Describe(ctx, req)
+	}
+	resp := &DescribeResponse{Description: schema.Description}
+	for _, f := range schema.Fields {
+		field := &ConfigField{Name: f.Name, Type: f.Type, Description: f.Description, Required: f.Required, Secret: f.Secret}
+		if f.Default != nil {
+			data, err := json.Marshal(f.Default)
+			if err != nil {
+				return nil, err
+			}
+			field.Default = data
+		}
+		resp.Fields = append(resp.Fields, field)
+	}
+	return resp, nil
+}
+
 func (s *GRPCServer) Configure(ctx context.Context, req *ConfigureRequest) (*ConfigureResponse, error) {
+	return configured(req, s.Impl.Configure)
+}
+
+func configured(req *ConfigureRequest, fn func(map[string]interface{}) error) (*ConfigureResponse, error) {
 	var data map[string]interface{}
 	if err := json.Unmarshal(req.Data, &data); err != nil {
 		return nil, err
 	}
-	if err := s.Impl.Configure(data); err != nil {
+	if err := fn(data); err != nil {
 		return &ConfigureResponse{Err: err.Error()}, nil
 	}
 	return &ConfigureResponse{}, nil
@@ -109,6 +201,53 @@ func (s *GRPCServer) Load(ctx context.Context, req *LoadRequest) (*LoadResponse,
 	return &LoadResponse{Data: data}, nil
 }
 
+// Hosts are streamed in batches, to stay well below grpc's message size limit
+const LoadBatchSize = 500
+
+func (s *GRPCServer) LoadStream(req *LoadRequest, stream Provider_LoadStreamServer) error {
+	conn, err := s.broker.Dial(req.Logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ts, _ := ptypes.Timestamp(req.Deadline)
+	ctx, cancel := context.WithDeadline(stream.Context(), ts)
+	defer cancel()
+	l := &GRPCLoggerClient{NewLoggerClient(conn)}
+	sent := 0
+	send := func(hosts herd.Hosts) error {
+		for len(hosts) > 0 {
+			n := len(hosts)
+			if n > LoadBatchSize {
+				n = LoadBatchSize
+			}
+			data, err := json.Marshal(hosts[:n])
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(&LoadStreamResponse{Data: data}); err != nil {
+				return err
+			}
+			sent += n
+			hosts = hosts[n:]
+			l.EmitLogMessage(logrus.DebugLevel, fmt.Sprintf("%d hosts sent", sent))
+		}
+		return nil
+	}
+	if sp, ok := s.Impl.(StreamingProvider); ok {
+		err = sp.LoadStream(ctx, l, send)
+	} else {
+		var hosts herd.Hosts
+		if hosts, err = s.Impl.Load(ctx, l); err == nil {
+			err = send(hosts)
+		}
+	}
+	if err != nil {
+		return stream.Send(&LoadStreamResponse{Err: err.Error()})
+	}
+	return nil
+}
+
 type GRPCLoggerClient struct {
 	client LoggerClient
 }
@@ -144,5 +283,226 @@ func (s *GRPCLoggerServer) EmitLogMessage(ctx context.Context, req *EmitLogMessa
 	return &Empty{}, nil
 }
 
+// Hosts are sent to plugins without their connection and keys, which only
+// mean something inside this process.
+func exportHost(h *herd.Host) *herd.Host {
+	return &herd.Host{Name: h.Name, Address: h.Address, Attributes: h.Attributes}
+}
+
+type GRPCExecutorClient struct {
+	client ExecutorClient
+	ctx    context.Context
+	runs   uint64
+}
+
+func (c *GRPCExecutorClient) Configure(settings map[string]interface{}) error {
+	return configure(c.ctx, settings, c.client.Configure)
+}
+
+func (c *GRPCExecutorClient) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	fail := func(err error) *herd.Result {
+		end := time.Now()
+		return &herd.Result{Host: host, Command: command, ExitStatus: -1, Err: err, StartTime: now, EndTime: end, ElapsedTime: end.Sub(now).Seconds()}
+	}
+	data, err := json.Marshal(exportHost(host))
+	if err != nil {
+		return fail(err)
+	}
+	id := atomic.AddUint64(&c.runs, 1)
+	stream, err := c.client.Run(ctx, &RunRequest{Host: data, Command: command, Id: id})
+	if err != nil {
+		return fail(err)
+	}
+	if signals := herd.Signals(ctx); signals != nil {
+		sctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go c.forwardSignals(sctx, id, signals)
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return fail(errors.New("Plugin did not return a result"))
+		}
+		if err != nil {
+			return fail(err)
+		}
+		switch r := resp.Response.(type) {
+		case *RunResponse_Output:
+			if oc != nil {
+				oc <- herd.OutputLine{Host: host, Stderr: r.Output.Stderr, Data: r.Output.Data}
+			}
+		case *RunResponse_Result:
+			result := &herd.Result{}
+			if err := json.Unmarshal(r.Result, result); err != nil {
+				return fail(err)
+			}
+			result.Host = host
+			return result
+		}
+	}
+}
+
+// Signals for a running command are sent separately, and identified by the id
+// of the run they are for.
+func (c *GRPCExecutorClient) forwardSignals(ctx context.Context, id uint64, signals <-chan os.Signal) {
+	for {
+		select {
+		case sig := <-signals:
+			s, ok := sig.(syscall.Signal)
+			if !ok {
+				continue
+			}
+			if _, err := c.client.Signal(ctx, &SignalRequest{Id: id, Signal: int32(s)}); err != nil {
+				logrus.Debugf("Unable to forward %s to plugin: %s", sig, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type GRPCExecutorServer struct {
+	UnimplementedExecutorServer
+	Impl    Executor
+	lock    sync.Mutex
+	signals map[uint64]chan os.Signal
+}
+
+func (s *GRPCExecutorServer) Configure(ctx context.Context, req *ConfigureRequest) (*ConfigureResponse, error) {
+	return configured(req, s.Impl.Configure)
+}
+
+func (s *GRPCExecutorServer) Run(req *RunRequest, stream Executor_RunServer) error {
+	host := &herd.Host{}
+	if err := json.Unmarshal(req.Host, host); err != nil {
+		return err
+	}
+	oc := make(chan herd.OutputLine)
+	done := make(chan error)
+	go func() {
+		var err error
+		for line := range oc {
+			if err == nil {
+				err = stream.Send(&RunResponse{Response: &RunResponse_Output{Output: &OutputLine{Stderr: line.Stderr, Data: line.Data}}})
+			}
+		}
+		done <- err
+	}()
+	signals := make(chan os.Signal, 1)
+	s.lock.Lock()
+	if s.signals == nil {
+		s.signals = make(map[uint64]chan os.Signal)
+	}
+	s.signals[req.Id] = signals
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.signals, req.Id)
+		s.lock.Unlock()
+	}()
+	result := s.Impl.Run(herd.WithSignals(stream.Context(), signals), host, req.Command, oc)
+	close(oc)
+	if err := <-done; err != nil {
+		return err
+	}
+	if result.Host == nil {
+		result.Host = host
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&RunResponse{Response: &RunResponse_Result{Result: data}})
+}
+
+func (s *GRPCExecutorServer) Signal(ctx context.Context, req *SignalRequest) (*Empty, error) {
+	s.lock.Lock()
+	signals, ok := s.signals[req.Id]
+	s.lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No command running with id %d", req.Id)
+	}
+	select {
+	case signals <- syscall.Signal(req.Signal):
+	default:
+	}
+	return &Empty{}, nil
+}
+
+type GRPCSinkClient struct {
+	client SinkClient
+	ctx    context.Context
+}
+
+func (c *GRPCSinkClient) Configure(settings map[string]interface{}) error {
+	return configure(c.ctx, settings, c.client.Configure)
+}
+
+func (c *GRPCSinkClient) Record(hi *herd.HistoryItem) error {
+	data, err := json.Marshal(hi)
+	if err != nil {
+		return err
+	}
+	// History items only refer to hosts by name, so we send them separately
+	hosts := make(herd.Hosts, len(hi.Hosts))
+	for i, h := range hi.Hosts {
+		hosts[i] = exportHost(h)
+	}
+	hdata, err := json.Marshal(hosts)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Record(c.ctx, &RecordRequest{HistoryItem: data, Hosts: hdata})
+	if err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return errors.New(resp.Err)
+	}
+	return nil
+}
+
+type GRPCSinkServer struct {
+	UnimplementedSinkServer
+	Impl Sink
+}
+
+func (s *GRPCSinkServer) Configure(ctx context.Context, req *ConfigureRequest) (*ConfigureResponse, error) {
+	return configured(req, s.Impl.Configure)
+}
+
+func (s *GRPCSinkServer) Record(ctx context.Context, req *RecordRequest) (*RecordResponse, error) {
+	hi := &herd.HistoryItem{}
+	if err := json.Unmarshal(req.HistoryItem, hi); err != nil {
+		return nil, err
+	}
+	var hosts herd.Hosts
+	if err := json.Unmarshal(req.Hosts, &hosts); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*herd.Host)
+	for _, h := range hosts {
+		byName[h.Name] = h
+	}
+	for i, h := range hi.Hosts {
+		if h2, ok := byName[h.Name]; ok {
+			hi.Hosts[i] = h2
+		}
+	}
+	for _, r := range hi.Results {
+		if h2, ok := byName[r.Host.Name]; ok {
+			r.Host = h2
+		}
+	}
+	if err := s.Impl.Record(hi); err != nil {
+		return &RecordResponse{Err: err.Error()}, nil
+	}
+	return &RecordResponse{}, nil
+}
+
 var _ Logger = &GRPCLoggerClient{}
 var _ Provider = &GRPCClient{}
+var _ SchemaSource = &GRPCClient{}
+var _ Executor = &GRPCExecutorClient{}
+var _ Sink = &GRPCSinkClient{}
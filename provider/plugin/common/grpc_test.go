@@ -0,0 +1,127 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+type testProvider struct {
+	count int
+	err   error
+}
+
+func (p *testProvider) Configure(map[string]interface{}) error {
+	return nil
+}
+
+func (p *testProvider) Load(ctx context.Context, logger Logger) (herd.Hosts, error) {
+	logger.LoadingMessage("test", false, nil)
+	if p.err != nil {
+		return nil, p.err
+	}
+	hosts := make(herd.Hosts, p.count)
+	for i := range hosts {
+		hosts[i] = herd.NewHost(fmt.Sprintf("host-%d.example.com", i), "", herd.HostAttributes{"number": int64(i)})
+	}
+	return hosts, nil
+}
+
+// A plugin built against an older version of herd, which only knows Load
+type legacyPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	ProviderPlugin
+}
+
+type legacyServer struct {
+	UnimplementedProviderServer
+	server *GRPCServer
+}
+
+func (s *legacyServer) Configure(ctx context.Context, req *ConfigureRequest) (*ConfigureResponse, error) {
+	return s.server.Configure(ctx, req)
+}
+
+func (s *legacyServer) Load(ctx context.Context, req *LoadRequest) (*LoadResponse, error) {
+	return s.server.Load(ctx, req)
+}
+
+func (p *legacyPlugin) GRPCServer(b *plugin.GRPCBroker, s *grpc.Server) error {
+	RegisterProviderServer(s, &legacyServer{server: &GRPCServer{Impl: p.Impl, broker: b}})
+	return nil
+}
+
+type testLogger struct {
+	lock     sync.Mutex
+	loading  bool
+	messages []string
+}
+
+func (l *testLogger) LoadingMessage(name string, done bool, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.loading = true
+}
+
+func (l *testLogger) EmitLogMessage(level logrus.Level, message string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.messages = append(l.messages, message)
+}
+
+func TestLoadStream(t *testing.T) {
+	testcases := []struct {
+		name     string
+		plugin   plugin.Plugin
+		messages []string
+	}{
+		{"stream", &ProviderPlugin{Impl: &testProvider{count: 1234}}, []string{"500 hosts sent", "1000 hosts sent", "1234 hosts sent"}},
+		{"legacy", &legacyPlugin{ProviderPlugin: ProviderPlugin{Impl: &testProvider{count: 1234}}}, nil},
+	}
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := plugin.TestPluginGRPCConn(t, map[string]plugin.Plugin{"provider": test.plugin})
+			defer client.Close()
+			raw, err := client.Dispense("provider")
+			if err != nil {
+				t.Fatalf("Unable to dispense provider: %s", err)
+			}
+			logger := &testLogger{}
+			hosts, err := raw.(Provider).Load(context.Background(), logger)
+			if err != nil {
+				t.Fatalf("Unable to load hosts: %s", err)
+			}
+			if len(hosts) != 1234 || hosts[1233].Name != "host-1233.example.com" || hosts[1233].Attributes["number"] != int64(1233) {
+				t.Errorf("Hosts were not loaded correctly")
+			}
+			if !logger.loading {
+				t.Errorf("No loading message was received")
+			}
+			if diff := deep.Equal(logger.messages, test.messages); diff != nil {
+				t.Errorf("Unexpected log messages: %v", diff)
+			}
+		})
+	}
+}
+
+func TestLoadStreamError(t *testing.T) {
+	p := &ProviderPlugin{Impl: &testProvider{err: errors.New("Simulated load error")}}
+	client, _ := plugin.TestPluginGRPCConn(t, map[string]plugin.Plugin{"provider": p})
+	defer client.Close()
+	raw, err := client.Dispense("provider")
+	if err != nil {
+		t.Fatalf("Unable to dispense provider: %s", err)
+	}
+	if _, err = raw.(Provider).Load(context.Background(), &testLogger{}); err == nil || err.Error() != "Simulated load error" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
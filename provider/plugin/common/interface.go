@@ -20,12 +20,41 @@ type Provider interface {
 	Load(ctx context.Context, logger Logger) (herd.Hosts, error)
 }
 
+// Providers that can produce hosts while they are still loading can send them
+// in batches, instead of returning all of them at once.
+type StreamingProvider interface {
+	LoadStream(ctx context.Context, logger Logger, send func(herd.Hosts) error) error
+}
+
+// The herd side of provider plugins can ask for their configuration schema
+type SchemaSource interface {
+	Schema() (*Schema, error)
+}
+
+type Executor interface {
+	Configure(map[string]interface{}) error
+	Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result
+}
+
+type Sink interface {
+	Configure(map[string]interface{}) error
+	Record(hi *herd.HistoryItem) error
+}
+
+// The protocol is versioned. Version 1 only knows about providers, version 2
+// adds executors and sinks. Herd and provider plugins speak both versions, so
+// plugins built against older versions of herd keep working.
 var Handshake = plugin.HandshakeConfig{
 	ProtocolVersion:  1,
 	MagicCookieKey:   "HERD",
 	MagicCookieValue: "plugin",
 }
 
+var PluginSets = map[int]plugin.PluginSet{
+	1: {"provider": &ProviderPlugin{}},
+	2: {"provider": &ProviderPlugin{}, "executor": &ExecutorPlugin{}, "sink": &SinkPlugin{}},
+}
+
 type ProviderPlugin struct {
 	plugin.NetRPCUnsupportedPlugin
 	Impl Provider
@@ -46,3 +75,37 @@ func (p *ProviderPlugin) GRPCClient(ctx context.Context, b *plugin.GRPCBroker, c
 		ctx:    ctx,
 	}, nil
 }
+
+type ExecutorPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	Impl Executor
+}
+
+func (p *ExecutorPlugin) GRPCServer(b *plugin.GRPCBroker, s *grpc.Server) error {
+	RegisterExecutorServer(s, &GRPCExecutorServer{Impl: p.Impl})
+	return nil
+}
+
+func (p *ExecutorPlugin) GRPCClient(ctx context.Context, b *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &GRPCExecutorClient{
+		client: NewExecutorClient(c),
+		ctx:    ctx,
+	}, nil
+}
+
+type SinkPlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+	Impl Sink
+}
+
+func (p *SinkPlugin) GRPCServer(b *plugin.GRPCBroker, s *grpc.Server) error {
+	RegisterSinkServer(s, &GRPCSinkServer{Impl: p.Impl})
+	return nil
+}
+
+func (p *SinkPlugin) GRPCClient(ctx context.Context, b *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &GRPCSinkClient{
+		client: NewSinkClient(c),
+		ctx:    ctx,
+	}, nil
+}
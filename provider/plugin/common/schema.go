@@ -0,0 +1,176 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/cast"
+)
+
+// Plugins describe their configuration, so herd can validate it before
+// configuring the plugin, show documentation for it and keep secrets out of
+// logs.
+type Schema struct {
+	Description string
+	Fields      []Field
+}
+
+type Field struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+	Secret      bool
+	Default     interface{}
+}
+
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+	TypeList     = "list"
+	TypeMap      = "map"
+)
+
+// Providers that implement Describe have their configuration validated by
+// herd before it is sent to them.
+type Describer interface {
+	Describe() *Schema
+}
+
+const redacted = "********"
+
+func (s *Schema) field(name string) *Field {
+	for i, f := range s.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Check settings against the schema, and fill in defaults for missing
+// settings. Settings named in ignore are not checked, they are meant for herd
+// itself.
+func (s *Schema) Validate(settings map[string]interface{}, ignore ...string) error {
+	errs := &herd.MultiError{Subject: "Invalid configuration"}
+	present := make(map[string]bool)
+	for key, value := range settings {
+		if containsFold(ignore, key) {
+			continue
+		}
+		f := s.field(key)
+		if f == nil {
+			errs.Add(fmt.Errorf("unknown setting %s, known settings are: %s", key, strings.Join(s.names(), ", ")))
+			continue
+		}
+		present[strings.ToLower(f.Name)] = true
+		if err := checkType(value, f.Type); err != nil {
+			errs.Add(fmt.Errorf("invalid value for %s: %s", f.Name, err))
+		}
+	}
+	for _, f := range s.Fields {
+		if present[strings.ToLower(f.Name)] {
+			continue
+		}
+		if f.Required {
+			errs.Add(fmt.Errorf("missing required setting %s", f.Name))
+		} else if f.Default != nil {
+			settings[strings.ToLower(f.Name)] = f.Default
+		}
+	}
+	if errs.HasErrors() {
+		return errs
+	}
+	return nil
+}
+
+// A copy of the settings with the values of secret fields hidden
+func (s *Schema) Redact(settings map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if f := s.field(key); f != nil && f.Secret {
+			value = redacted
+		}
+		ret[key] = value
+	}
+	return ret
+}
+
+func (s *Schema) names() []string {
+	names := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		names[i] = f.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Schema) String() string {
+	var ret strings.Builder
+	if s.Description != "" {
+		ret.WriteString(s.Description)
+		ret.WriteString("\n")
+	}
+	for _, f := range s.Fields {
+		fmt.Fprintf(&ret, "  %s (%s", f.Name, f.Type)
+		if f.Required {
+			ret.WriteString(", required")
+		}
+		if f.Secret {
+			ret.WriteString(", secret")
+		}
+		if f.Default != nil {
+			fmt.Fprintf(&ret, ", default: %v", f.Default)
+		}
+		ret.WriteString(")")
+		if f.Description != "" {
+			ret.WriteString(": ")
+			ret.WriteString(f.Description)
+		}
+		ret.WriteString("\n")
+	}
+	return ret.String()
+}
+
+func checkType(value interface{}, typ string) error {
+	var err error
+	switch typ {
+	case TypeString:
+		_, err = cast.ToStringE(value)
+	case TypeInt:
+		_, err = cast.ToInt64E(value)
+	case TypeFloat:
+		_, err = cast.ToFloat64E(value)
+	case TypeBool:
+		_, err = cast.ToBoolE(value)
+	case TypeDuration:
+		_, err = cast.ToDurationE(value)
+	case TypeList:
+		if k := reflect.ValueOf(value).Kind(); k != reflect.Slice && k != reflect.Array {
+			err = fmt.Errorf("expected a list, got %v", value)
+		}
+	case TypeMap:
+		if reflect.ValueOf(value).Kind() != reflect.Map {
+			err = fmt.Errorf("expected a map, got %v", value)
+		}
+	default:
+		err = fmt.Errorf("unknown type %s", typ)
+	}
+	return err
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var testSchema = &Schema{
+	Description: "A test schema",
+	Fields: []Field{
+		{Name: "Url", Type: TypeString, Required: true, Description: "Where to find hosts"},
+		{Name: "Password", Type: TypeString, Secret: true},
+		{Name: "Timeout", Type: TypeDuration, Default: "10s"},
+		{Name: "Retries", Type: TypeInt},
+		{Name: "Verify", Type: TypeBool},
+		{Name: "Tags", Type: TypeList},
+		{Name: "Labels", Type: TypeMap},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	settings := map[string]interface{}{
+		"url":      "https://inventory.example.com",
+		"password": "hunter2",
+		"retries":  "3",
+		"verify":   true,
+		"tags":     []interface{}{"a", "b"},
+		"labels":   map[string]interface{}{"a": "b"},
+		"prefix":   "test:",
+	}
+	if err := testSchema.Validate(settings, "prefix"); err != nil {
+		t.Errorf("Valid settings not accepted: %s", err)
+	}
+	if settings["timeout"] != "10s" {
+		t.Errorf("Default not applied: %v", settings)
+	}
+
+	settings = map[string]interface{}{
+		"urll":    "https://inventory.example.com",
+		"retries": "three",
+		"tags":    "a",
+		"verify":  "maybe",
+	}
+	err := testSchema.Validate(settings)
+	if err == nil {
+		t.Fatalf("Invalid settings accepted")
+	}
+	for _, msg := range []string{
+		"unknown setting urll, known settings are: Labels, Password, Retries, Tags, Timeout, Url, Verify",
+		"invalid value for Retries",
+		"invalid value for Tags",
+		"invalid value for Verify",
+		"missing required setting Url",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Error does not mention %q: %s", msg, err)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	settings := map[string]interface{}{"url": "https://inventory.example.com", "password": "hunter2"}
+	expected := map[string]interface{}{"url": "https://inventory.example.com", "password": "********"}
+	if diff := deep.Equal(testSchema.Redact(settings), expected); diff != nil {
+		t.Errorf("Settings not redacted: %v", diff)
+	}
+	if settings["password"] != "hunter2" {
+		t.Errorf("Original settings were modified")
+	}
+}
+
+func TestSchemaString(t *testing.T) {
+	s := testSchema.String()
+	for _, line := range []string{
+		"A test schema\n",
+		"  Url (string, required): Where to find hosts\n",
+		"  Password (string, secret)\n",
+		"  Timeout (duration, default: 10s)\n",
+	} {
+		if !strings.Contains(s, line) {
+			t.Errorf("Documentation does not contain %q:\n%s", line, s)
+		}
+	}
+}
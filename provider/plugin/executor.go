@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/common"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/spf13/viper"
+)
+
+// An executor that runs commands through a herd-executor-<name> plugin. The
+// plugin is started when the first command is run, and stopped by End.
+type Executor struct {
+	name           string
+	settings       map[string]interface{}
+	connectTimeout time.Duration
+	config         struct {
+		Command string
+	}
+	lock     sync.Mutex
+	client   *plugin.Client
+	executor common.Executor
+	err      error
+}
+
+func NewExecutor(name string) *Executor {
+	e := &Executor{name: name, settings: map[string]interface{}{}}
+	e.config.Command = findCommand("executor", name)
+	return e
+}
+
+func (e *Executor) ParseViper(v *viper.Viper) error {
+	e.settings = v.AllSettings()
+	return v.Unmarshal(&e.config)
+}
+
+func (e *Executor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+}
+
+func (e *Executor) start() (common.Executor, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.executor != nil || e.err != nil {
+		return e.executor, e.err
+	}
+	if e.config.Command == "" {
+		e.err = fmt.Errorf("No herd-executor-%s plugin found", e.name)
+		return nil, e.err
+	}
+	// A missing plugin fails all hosts. Other failures may be temporary, so
+	// the next host tries to start the plugin again.
+	client := newClient(e.config.Command, fmt.Sprintf("executor-%s", e.name), false)
+	raw, err := dispense(client, "executor")
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+	executor := raw.(common.Executor)
+	e.settings["herd_executor_name"] = e.name
+	e.settings["herd_connect_timeout"] = e.connectTimeout.String()
+	if err := executor.Configure(e.settings); err != nil {
+		client.Kill()
+		return nil, err
+	}
+	e.client, e.executor = client, executor
+	return executor, nil
+}
+
+func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	executor, err := e.start()
+	if err != nil {
+		now := time.Now()
+		return &herd.Result{Host: host, Command: command, ExitStatus: -1, Err: err, StartTime: now, EndTime: now}
+	}
+	return executor.Run(ctx, host, command, oc)
+}
+
+func (e *Executor) End() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.client != nil {
+		e.client.Kill()
+	}
+}
+
+var _ herd.Executor = &Executor{}
@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/viper"
+)
+
+func TestDiscover(t *testing.T) {
+	if diff := deep.Equal(Discover("executor"), []string{"ci"}); diff != nil {
+		t.Errorf("Executors not discovered: %v", diff)
+	}
+	if diff := deep.Equal(Discover("provider"), []string{"ci", "fake", "fake2"}); diff != nil {
+		t.Errorf("Providers not discovered: %v", diff)
+	}
+}
+
+func TestExecutorPlugin(t *testing.T) {
+	e := NewExecutor("ci")
+	defer e.End()
+	if e.config.Command != filepath.Join(testdata, "bin", "herd-executor-ci") {
+		t.Errorf("Executor was not found by name automatically")
+	}
+	v := viper.New()
+	v.Set("Greeting", "hello")
+	if err := e.ParseViper(v); err != nil {
+		t.Fatalf("Unable to configure executor: %s", err)
+	}
+	e.SetConnectTimeout(3 * time.Second)
+	host := herd.NewHost("host-1.example.com", "", herd.HostAttributes{"color": "green"})
+	oc := make(chan herd.OutputLine, 10)
+
+	r := e.Run(context.Background(), host, "true", oc)
+	close(oc)
+	if r.Err != nil || r.ExitStatus != 0 || r.Host != host {
+		t.Fatalf("Unexpected result: %v", r)
+	}
+	if string(r.Stdout) != "hello host-1.example.com from green\ntrue\n" {
+		t.Errorf("Unexpected output: %q", r.Stdout)
+	}
+	lines := []herd.OutputLine{}
+	for line := range oc {
+		lines = append(lines, line)
+	}
+	expected := []herd.OutputLine{
+		{Host: host, Data: []byte("hello host-1.example.com from green\n")},
+		{Host: host, Stderr: true, Data: []byte("connect timeout 3s\n")},
+	}
+	if diff := deep.Equal(lines, expected); diff != nil {
+		t.Errorf("Output was not streamed correctly: %v", diff)
+	}
+
+	if r = e.Run(context.Background(), host, "fail", nil); r.ExitStatus != 1 || r.Err != nil {
+		t.Errorf("Unexpected result for failing command: %v", r)
+	}
+	if r = e.Run(context.Background(), host, "error", nil); r.ExitStatus != -1 || r.Err == nil || r.Err.Error() != "Simulated run error" {
+		t.Errorf("Unexpected result for erroring command: %v", r)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if r = e.Run(ctx, host, "sleep", nil); r.Err == nil {
+		t.Errorf("Command was not canceled")
+	}
+
+	// Signals are sent once the command is running, which it is once it
+	// produces output
+	oc = make(chan herd.OutputLine, 10)
+	signals := make(chan os.Signal, 1)
+	go func() {
+		<-oc
+		signals <- syscall.SIGTERM
+	}()
+	ctx, cancel = context.WithTimeout(herd.WithSignals(context.Background(), signals), 5*time.Second)
+	defer cancel()
+	if r = e.Run(ctx, host, "signal", oc); r.Err != nil || !strings.HasSuffix(string(r.Stdout), "signal\nterminated\n") {
+		t.Errorf("Signal was not forwarded: %v %q", r.Err, r.Stdout)
+	}
+}
+
+func TestExecutorPluginErrors(t *testing.T) {
+	e := NewExecutor("missing")
+	host := herd.NewHost("host-1.example.com", "", herd.HostAttributes{})
+	if r := e.Run(context.Background(), host, "true", nil); r.Err == nil || r.Err.Error() != "No herd-executor-missing plugin found" {
+		t.Errorf("Unexpected result for missing plugin: %v", r)
+	}
+	e = NewExecutor("ci")
+	defer e.End()
+	if r := e.Run(context.Background(), host, "true", nil); r.Err == nil || r.Err.Error() != "Simulated configuration error" {
+		t.Errorf("Unexpected result for unconfigured plugin: %v", r)
+	}
+	// Failing to start is not remembered, the next host tries again
+	e.settings["greeting"] = "hello"
+	if r := e.Run(context.Background(), host, "true", nil); r.Err != nil {
+		t.Errorf("Plugin was not started again after failing: %v", r.Err)
+	}
+	e = NewExecutor("provider")
+	e.config.Command = filepath.Join(testdata, "bin", "herd-provider-ci")
+	defer e.End()
+	if r := e.Run(context.Background(), host, "true", nil); r.Err == nil {
+		t.Errorf("A provider plugin should not work as executor")
+	}
+}
@@ -3,13 +3,11 @@ package plugin
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"strings"
 
 	"github.com/seveas/herd"
 	"github.com/seveas/herd/provider/plugin/common"
 
-	"github.com/hashicorp/go-plugin"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -21,20 +19,27 @@ func init() {
 type pluginProvider struct {
 	name     string
 	settings map[string]interface{}
-	config   struct {
+	schema   *common.Schema
+	// Whether we asked the plugin for its schema, plugins without one have a
+	// nil schema
+	described bool
+	// Settings that were resolved from secret references
+	secrets []string
+	config  struct {
 		Command string
 		Prefix  string
 	}
 }
 
+// Settings that are meant for herd, not for the plugin
+var reservedSettings = []string{"provider", "prefix", "command", "optional", "herd_provider_name"}
+
+// If the plugin can't tell us which settings are secret, we guess
+var secretHints = []string{"password", "secret", "token", "key"}
+
 func newPlugin(name string) herd.HostProvider {
 	p := &pluginProvider{name: name}
-	if path, err := exec.LookPath(fmt.Sprintf("herd-provider-%s", name)); err == nil {
-		p.config.Command = path
-	}
-	if path, err := exec.LookPath(fmt.Sprintf("herd-provider-%s.exe", name)); err == nil {
-		p.config.Command = path
-	}
+	p.config.Command = findCommand("provider", name)
 	p.settings = map[string]interface{}{"name": name}
 	return p
 }
@@ -47,10 +52,43 @@ func (p *pluginProvider) Prefix() string {
 	return p.config.Prefix
 }
 
+// The plugin is started once to ask for its schema, so secrets are hidden and
+// the plugin is documented even before hosts are loaded. If that fails, we try
+// again when loading hosts.
 func (p *pluginProvider) ParseViper(v *viper.Viper) error {
 	p.settings = v.AllSettings()
 	p.settings["herd_provider_name"] = p.name
-	return v.Unmarshal(&p.config)
+	if err := v.Unmarshal(&p.config); err != nil {
+		return err
+	}
+	if p.config.Command == "" {
+		return nil
+	}
+	client := newClient(p.config.Command, fmt.Sprintf("plugin-%s", p.name), true)
+	defer client.Kill()
+	raw, err := dispense(client, "provider")
+	if err == nil {
+		err = p.describe(raw)
+	}
+	if err != nil {
+		logrus.Debugf("Unable to fetch the configuration schema of plugin %s: %s", p.name, err)
+	}
+	return nil
+}
+
+func (p *pluginProvider) describe(raw interface{}) error {
+	if p.described {
+		return nil
+	}
+	if ss, ok := raw.(common.SchemaSource); ok {
+		schema, err := ss.Schema()
+		if err != nil {
+			return err
+		}
+		p.schema = schema
+	}
+	p.described = true
+	return nil
 }
 
 func (p *pluginProvider) Equivalent(o herd.HostProvider) bool {
@@ -58,35 +96,65 @@ func (p *pluginProvider) Equivalent(o herd.HostProvider) bool {
 }
 
 func (p *pluginProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
-	pluginMap := map[string]plugin.Plugin{
-		"provider": &common.ProviderPlugin{},
-	}
-	client := plugin.NewClient(&plugin.ClientConfig{
-		Managed:          true,
-		HandshakeConfig:  common.Handshake,
-		Plugins:          pluginMap,
-		Cmd:              exec.Command(p.config.Command),
-		Logger:           common.NewLogrusLogger(logrus.StandardLogger(), fmt.Sprintf("plugin-%s", p.name)),
-		SyncStdout:       os.Stdout,
-		SyncStderr:       os.Stderr,
-		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
-	})
-
-	rpcClient, err := client.Client()
+	client := newClient(p.config.Command, fmt.Sprintf("plugin-%s", p.name), true)
+	raw, err := dispense(client, "provider")
 	if err != nil {
 		return nil, err
 	}
-	raw, err := rpcClient.Dispense("provider")
-	if err != nil {
+	// The schema is kept even if the settings are wrong, so secrets are
+	// hidden and the plugin can be documented.
+	if err := p.describe(raw); err != nil {
 		return nil, err
 	}
+	// Validation fills in defaults, those are for the plugin only, not
+	// something that was configured.
+	settings := make(map[string]interface{}, len(p.settings))
+	for k, v := range p.settings {
+		settings[k] = v
+	}
+	if p.schema != nil {
+		if err := p.schema.Validate(settings, reservedSettings...); err != nil {
+			return nil, fmt.Errorf("%s: %s", p.name, err)
+		}
+	}
+	logrus.Debugf("Configuring plugin %s with %v", p.name, p.Settings())
 	pp := raw.(common.Provider)
-	if err := pp.Configure(p.settings); err != nil {
+	if err := pp.Configure(settings); err != nil {
 		return nil, err
 	}
 	return pp.Load(ctx, &logForwarder{provider: p, lm: lm})
 }
 
+// Settings resolved from secret references are always hidden
+func (p *pluginProvider) SetSecrets(keys []string) {
+	p.secrets = keys
+}
+
+// The plugin settings, with secrets hidden
+func (p *pluginProvider) Settings() map[string]interface{} {
+	if p.schema != nil {
+		return herd.RedactSecrets(p.schema.Redact(p.settings), p.secrets)
+	}
+	ret := make(map[string]interface{}, len(p.settings))
+	for k, v := range p.settings {
+		for _, hint := range secretHints {
+			if strings.Contains(strings.ToLower(k), hint) {
+				v = "********"
+				break
+			}
+		}
+		ret[k] = v
+	}
+	return herd.RedactSecrets(ret, p.secrets)
+}
+
+func (p *pluginProvider) Documentation() string {
+	if p.schema == nil {
+		return ""
+	}
+	return p.schema.String()
+}
+
 type logForwarder struct {
 	provider *pluginProvider
 	lm       herd.LoadingMessage
@@ -101,3 +169,6 @@ func (l *logForwarder) EmitLogMessage(level logrus.Level, message string) {
 }
 
 var _ common.Logger = &logForwarder{}
+var _ herd.ConfiguredProvider = &pluginProvider{}
+var _ herd.DocumentedProvider = &pluginProvider{}
+var _ herd.SecretHider = &pluginProvider{}
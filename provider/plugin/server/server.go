@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/seveas/herd"
 	"github.com/seveas/herd/provider/plugin/common"
@@ -27,12 +29,42 @@ func (p *providerImpl) Configure(values map[string]interface{}) error {
 	return p.provider.ParseViper(v)
 }
 
+// Providers that implement common.Describer have their configuration
+// validated by herd before it is sent to them.
+func (p *providerImpl) Describe() *common.Schema {
+	if d, ok := p.provider.(common.Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
 func (p *providerImpl) Load(ctx context.Context, logger common.Logger) (herd.Hosts, error) {
 	logrus.SetOutput(ioutil.Discard)
 	logrus.AddHook(&logrusHook{logger: logger})
 	return p.provider.Load(ctx, logger.LoadingMessage)
 }
 
+// Providers that implement LoadStream can send hosts to herd in batches while
+// they are still loading, all others send their hosts when they are done.
+type StreamingProvider interface {
+	herd.HostProvider
+	LoadStream(ctx context.Context, lm herd.LoadingMessage, send func(herd.Hosts) error) error
+}
+
+func (p *providerImpl) LoadStream(ctx context.Context, logger common.Logger, send func(herd.Hosts) error) error {
+	sp, ok := p.provider.(StreamingProvider)
+	if !ok {
+		hosts, err := p.Load(ctx, logger)
+		if err != nil {
+			return err
+		}
+		return send(hosts)
+	}
+	logrus.SetOutput(ioutil.Discard)
+	logrus.AddHook(&logrusHook{logger: logger})
+	return sp.LoadStream(ctx, logger.LoadingMessage, send)
+}
+
 func ProviderPluginServer(name string) error {
 	logrus.SetOutput(os.Stdout)
 	logrus.SetLevel(logrus.TraceLevel)
@@ -44,13 +76,84 @@ func ProviderPluginServer(name string) error {
 	p := &providerImpl{
 		provider: provider,
 	}
-	pluginMap := map[string]plugin.Plugin{
+	pluginSet := plugin.PluginSet{
 		"provider": &common.ProviderPlugin{Impl: p},
 	}
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig:  common.Handshake,
+		VersionedPlugins: map[int]plugin.PluginSet{1: pluginSet, 2: pluginSet},
+		GRPCServer:       plugin.DefaultGRPCServer,
+	})
+	return nil
+}
+
+// Executors and sinks can be configured like providers, by implementing
+// ParseViper.
+type viperParser interface {
+	ParseViper(v *viper.Viper) error
+}
+
+func parseViper(impl interface{}, values map[string]interface{}) error {
+	p, ok := impl.(viperParser)
+	if !ok {
+		return nil
+	}
+	v := viper.New()
+	for k, s := range values {
+		v.SetDefault(k, s)
+	}
+	return p.ParseViper(v)
+}
+
+type executorImpl struct {
+	executor herd.Executor
+}
+
+func (e *executorImpl) Configure(values map[string]interface{}) error {
+	if t, ok := values["herd_connect_timeout"]; ok {
+		if d, err := time.ParseDuration(fmt.Sprintf("%v", t)); err == nil {
+			e.executor.SetConnectTimeout(d)
+		}
+	}
+	return parseViper(e.executor, values)
+}
+
+func (e *executorImpl) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	return e.executor.Run(ctx, host, command, oc)
+}
+
+func ExecutorPluginServer(executor herd.Executor) error {
+	logrus.SetOutput(os.Stderr)
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: common.Handshake,
+		VersionedPlugins: map[int]plugin.PluginSet{
+			2: {"executor": &common.ExecutorPlugin{Impl: &executorImpl{executor: executor}}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+	return nil
+}
+
+type sinkImpl struct {
+	sink herd.Sink
+}
+
+func (s *sinkImpl) Configure(values map[string]interface{}) error {
+	return parseViper(s.sink, values)
+}
+
+func (s *sinkImpl) Record(hi *herd.HistoryItem) error {
+	return s.sink.Record(hi)
+}
+
+func SinkPluginServer(sink herd.Sink) error {
+	logrus.SetOutput(os.Stderr)
 	plugin.Serve(&plugin.ServeConfig{
 		HandshakeConfig: common.Handshake,
-		Plugins:         pluginMap,
-		GRPCServer:      plugin.DefaultGRPCServer,
+		VersionedPlugins: map[int]plugin.PluginSet{
+			2: {"sink": &common.SinkPlugin{Impl: &sinkImpl{sink: sink}}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
 	})
 	return nil
 }
@@ -69,3 +172,7 @@ func (h *logrusHook) Fire(entry *logrus.Entry) error {
 }
 
 var _ common.Provider = &providerImpl{}
+var _ common.StreamingProvider = &providerImpl{}
+var _ common.Describer = &providerImpl{}
+var _ common.Executor = &executorImpl{}
+var _ common.Sink = &sinkImpl{}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/common"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/spf13/viper"
+)
+
+// A sink that sends history items to a herd-sink-<name> plugin. The plugin is
+// started when the first history item is recorded, and stopped by End.
+type Sink struct {
+	name     string
+	settings map[string]interface{}
+	config   struct {
+		Command string
+	}
+	lock   sync.Mutex
+	client *plugin.Client
+	sink   common.Sink
+}
+
+func NewSink(name string) *Sink {
+	s := &Sink{name: name, settings: map[string]interface{}{}}
+	s.config.Command = findCommand("sink", name)
+	return s
+}
+
+func (s *Sink) ParseViper(v *viper.Viper) error {
+	s.settings = v.AllSettings()
+	return v.Unmarshal(&s.config)
+}
+
+func (s *Sink) start() error {
+	if s.config.Command == "" {
+		return fmt.Errorf("No herd-sink-%s plugin found", s.name)
+	}
+	client := newClient(s.config.Command, fmt.Sprintf("sink-%s", s.name), false)
+	raw, err := dispense(client, "sink")
+	if err != nil {
+		client.Kill()
+		return err
+	}
+	sink := raw.(common.Sink)
+	s.settings["herd_sink_name"] = s.name
+	if err := sink.Configure(s.settings); err != nil {
+		client.Kill()
+		return err
+	}
+	s.client, s.sink = client, sink
+	return nil
+}
+
+func (s *Sink) Record(hi *herd.HistoryItem) error {
+	s.lock.Lock()
+	if s.sink == nil {
+		if err := s.start(); err != nil {
+			s.lock.Unlock()
+			return err
+		}
+	}
+	sink := s.sink
+	s.lock.Unlock()
+	return sink.Record(hi)
+}
+
+func (s *Sink) End() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.client != nil {
+		s.client.Kill()
+	}
+}
+
+var _ herd.Sink = &Sink{}
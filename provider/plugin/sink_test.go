@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/viper"
+)
+
+func TestSinkPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "herd-sink-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "sink.txt")
+
+	s := NewSink("ci")
+	defer s.End()
+	if err := s.Record(&herd.HistoryItem{}); err == nil || err.Error() != "No file to record to" {
+		t.Errorf("Unconfigured sink did not fail: %v", err)
+	}
+	s = NewSink("ci")
+	defer s.End()
+	v := viper.New()
+	v.Set("File", fn)
+	if err := s.ParseViper(v); err != nil {
+		t.Fatalf("Unable to configure sink: %s", err)
+	}
+
+	e := NewExecutor("ci")
+	defer e.End()
+	v = viper.New()
+	v.Set("Greeting", "hi")
+	e.ParseViper(v)
+	hosts := herd.Hosts{
+		herd.NewHost("host-1.example.com", "", herd.HostAttributes{"color": "green"}),
+		herd.NewHost("host-2.example.com", "", herd.HostAttributes{"color": "red"}),
+	}
+	runner := herd.NewRunner(e)
+	runner.AddHosts(hosts)
+	hi, err := runner.Run("fail", nil, nil)
+	if err != nil {
+		t.Fatalf("Unable to run command: %s", err)
+	}
+	if err := s.Record(hi); err != nil {
+		t.Fatalf("Unable to record history item: %s", err)
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Sink did not write its file: %s", err)
+	}
+	expected := `fail 0/2/0
+host-1.example.com green 1 "hi host-1.example.com from green\nfail\n"
+host-2.example.com red 1 "hi host-2.example.com from red\nfail\n"
+`
+	if string(data) != expected {
+		t.Errorf("Unexpected sink output:\n%s", data)
+	}
+}
+
+func TestSinkConcurrentStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "herd-sink-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewSink("ci")
+	defer s.End()
+	v := viper.New()
+	v.Set("File", filepath.Join(dir, "sink.txt"))
+	if err := s.ParseViper(v); err != nil {
+		t.Fatalf("Unable to configure sink: %s", err)
+	}
+	// Runs can finish at the same time, the plugin must be started only once
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			errs <- s.Record(&herd.HistoryItem{Command: "true"})
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Unable to record history item: %s", err)
+		}
+	}
+}
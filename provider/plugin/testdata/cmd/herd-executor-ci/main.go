@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/server"
+
+	"github.com/spf13/viper"
+)
+
+// An executor that does not execute anything, but echoes the command back
+type ciExecutor struct {
+	connectTimeout time.Duration
+	config         struct {
+		Greeting string
+	}
+}
+
+func (e *ciExecutor) ParseViper(v *viper.Viper) error {
+	if err := v.Unmarshal(&e.config); err != nil {
+		return err
+	}
+	if e.config.Greeting == "" {
+		return errors.New("Simulated configuration error")
+	}
+	return nil
+}
+
+func (e *ciExecutor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+}
+
+func (e *ciExecutor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host, Command: command, StartTime: now}
+	stdout := fmt.Sprintf("%s %s from %s\n", e.config.Greeting, host.Name, host.Attributes["color"])
+	stderr := fmt.Sprintf("connect timeout %s\n", e.connectTimeout)
+	oc <- herd.OutputLine{Host: host, Data: []byte(stdout)}
+	oc <- herd.OutputLine{Host: host, Stderr: true, Data: []byte(stderr)}
+	r.Stdout = []byte(stdout + command + "\n")
+	r.Stderr = []byte(stderr)
+	switch command {
+	case "fail":
+		r.ExitStatus = 1
+	case "error":
+		r.ExitStatus = -1
+		r.Err = errors.New("Simulated run error")
+	case "sleep":
+		select {
+		case <-ctx.Done():
+			r.ExitStatus = -1
+			r.Err = ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	case "signal":
+		select {
+		case sig := <-herd.Signals(ctx):
+			r.Stdout = append(r.Stdout, []byte(sig.String()+"\n")...)
+		case <-ctx.Done():
+			r.ExitStatus = -1
+			r.Err = ctx.Err()
+		}
+	}
+	r.EndTime = time.Now()
+	r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	return r
+}
+
+func main() {
+	if err := server.ExecutorPluginServer(&ciExecutor{}); err != nil {
+		panic(err)
+	}
+}
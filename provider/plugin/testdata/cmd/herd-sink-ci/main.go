@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/server"
+
+	"github.com/spf13/viper"
+)
+
+// A sink that writes a summary of what it received to a file
+type ciSink struct {
+	config struct {
+		File string
+	}
+}
+
+func (s *ciSink) ParseViper(v *viper.Viper) error {
+	return v.Unmarshal(&s.config)
+}
+
+func (s *ciSink) Record(hi *herd.HistoryItem) error {
+	if s.config.File == "" {
+		return fmt.Errorf("No file to record to")
+	}
+	lines := []string{fmt.Sprintf("%s %d/%d/%d", hi.Command, hi.Summary.Ok, hi.Summary.Fail, hi.Summary.Err)}
+	for _, h := range hi.Hosts {
+		r := hi.Results[h.Name]
+		lines = append(lines, fmt.Sprintf("%s %s %d %q", h.Name, r.Host.Attributes["color"], r.ExitStatus, r.Stdout))
+	}
+	sort.Strings(lines[1:])
+	return ioutil.WriteFile(s.config.File, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func main() {
+	if err := server.SinkPluginServer(&ciSink{}); err != nil {
+		panic(err)
+	}
+}
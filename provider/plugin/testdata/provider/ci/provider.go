@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/plugin/common"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -18,8 +19,11 @@ func init() {
 type ciProvider struct {
 	name   string
 	config struct {
-		Prefix string
-		Mode   string
+		Prefix     string
+		Mode       string
+		Token      string
+		Credential string
+		Count      int
 	}
 }
 
@@ -39,6 +43,18 @@ func (p *ciProvider) Equivalent(o herd.HostProvider) bool {
 	return true
 }
 
+func (p *ciProvider) Describe() *common.Schema {
+	return &common.Schema{
+		Description: "Provider for testing the plugin protocol",
+		Fields: []common.Field{
+			{Name: "Mode", Type: common.TypeString, Required: true, Description: "What to simulate"},
+			{Name: "Token", Type: common.TypeString, Secret: true},
+			{Name: "Credential", Type: common.TypeString, Secret: true},
+			{Name: "Count", Type: common.TypeInt, Default: 5},
+		},
+	}
+}
+
 func (p *ciProvider) ParseViper(v *viper.Viper) error {
 	err := v.Unmarshal(&p.config)
 	if err != nil {
@@ -62,7 +78,7 @@ func (p *ciProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hos
 	}
 	switch p.config.Mode {
 	case "normal":
-		nhosts := 5
+		nhosts := p.config.Count
 		hosts := make(herd.Hosts, nhosts)
 		for i := 0; i < nhosts; i++ {
 			attrs := herd.HostAttributes{
@@ -61,6 +61,14 @@ func (p *prometheusProvider) Equivalent(o herd.HostProvider) bool {
 		reflect.DeepEqual(p.config.Jobs, op.config.Jobs)
 }
 
+func (p *prometheusProvider) SetValidator(validator string) {
+	p.hp.SetValidator(validator)
+}
+
+func (p *prometheusProvider) Validator() string {
+	return p.hp.Validator()
+}
+
 func (p *prometheusProvider) ParseViper(v *viper.Viper) error {
 	if err := p.hp.ParseViper(v); err != nil {
 		return err
@@ -0,0 +1,289 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/seveas/herd"
+	"github.com/seveas/herd/provider/http"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	herd.RegisterProvider("terraform", newProvider, nil)
+}
+
+// How to turn an instance of a resource type into a host. All values are
+// paths into the instance attributes, like network_interface.0.network_ip.
+// For name and address, the first path that has a value wins.
+type resourceType struct {
+	Name       []string
+	Address    []string
+	Tags       string
+	Attributes map[string]string
+}
+
+var resourceTypes = map[string]resourceType{
+	"aws_instance": {
+		Name:    []string{"tags.Name", "id"},
+		Address: []string{"private_ip", "public_ip"},
+		Tags:    "tags",
+		Attributes: map[string]string{
+			"instance_id":       "id",
+			"instance_type":     "instance_type",
+			"image_id":          "ami",
+			"availability_zone": "availability_zone",
+			"subnet_id":         "subnet_id",
+			"private_ip":        "private_ip",
+			"public_ip":         "public_ip",
+			"state":             "instance_state",
+		},
+	},
+	"google_compute_instance": {
+		Name:    []string{"name"},
+		Address: []string{"network_interface.0.network_ip"},
+		Tags:    "labels",
+		Attributes: map[string]string{
+			"id":          "instance_id",
+			"machinetype": "machine_type",
+			"zone":        "zone",
+			"project":     "project",
+			"tags":        "tags",
+			"external_ip": "network_interface.0.access_config.0.nat_ip",
+		},
+	},
+	"azurerm_linux_virtual_machine": {
+		Name:    []string{"computer_name", "name"},
+		Address: []string{"private_ip_address", "public_ip_address"},
+		Tags:    "tags",
+		Attributes: map[string]string{
+			"VMID":          "virtual_machine_id",
+			"VMSize":        "size",
+			"Location":      "location",
+			"ResourceGroup": "resource_group_name",
+			"public_ip":     "public_ip_address",
+		},
+	},
+	"azurerm_windows_virtual_machine": {
+		Name:    []string{"computer_name", "name"},
+		Address: []string{"private_ip_address", "public_ip_address"},
+		Tags:    "tags",
+		Attributes: map[string]string{
+			"VMID":          "virtual_machine_id",
+			"VMSize":        "size",
+			"Location":      "location",
+			"ResourceGroup": "resource_group_name",
+			"public_ip":     "public_ip_address",
+		},
+	},
+	"libvirt_domain": {
+		Name:    []string{"name"},
+		Address: []string{"network_interface.0.addresses.0"},
+		Attributes: map[string]string{
+			"id":     "id",
+			"vcpu":   "vcpu",
+			"memory": "memory",
+		},
+	},
+}
+
+type terraformProvider struct {
+	name   string
+	hp     *http.HttpProvider
+	config struct {
+		Prefix        string
+		File          string
+		ResourceTypes map[string]resourceType
+	}
+}
+
+func newProvider(name string) herd.HostProvider {
+	return &terraformProvider{name: name, hp: http.NewProvider(name).(*http.HttpProvider)}
+}
+
+func (p *terraformProvider) Name() string {
+	return p.name
+}
+
+func (p *terraformProvider) Prefix() string {
+	return p.config.Prefix
+}
+
+func (p *terraformProvider) Equivalent(o herd.HostProvider) bool {
+	op := o.(*terraformProvider)
+	return p.config.File == op.config.File &&
+		p.hp.Equivalent(op.hp) &&
+		reflect.DeepEqual(p.config.ResourceTypes, op.config.ResourceTypes)
+}
+
+func (p *terraformProvider) SetValidator(validator string) {
+	p.hp.SetValidator(validator)
+}
+
+func (p *terraformProvider) Validator() string {
+	return p.hp.Validator()
+}
+
+func (p *terraformProvider) ParseViper(v *viper.Viper) error {
+	if err := p.hp.ParseViper(v); err != nil {
+		return err
+	}
+	return v.Unmarshal(&p.config)
+}
+
+func (p *terraformProvider) SetDataDir(dir string) error {
+	if p.config.File != "" && !filepath.IsAbs(p.config.File) {
+		p.config.File = filepath.Join(dir, p.config.File)
+		_, err := os.Stat(p.config.File)
+		return err
+	}
+	return nil
+}
+
+// The parts of the state format we care about. Both the local and the http
+// backend store the state in this format.
+type state struct {
+	Version   int
+	Resources []struct {
+		Module    string
+		Mode      string
+		Type      string
+		Name      string
+		Instances []struct {
+			IndexKey   interface{} `json:"index_key"`
+			Attributes map[string]interface{}
+		}
+	}
+}
+
+func (p *terraformProvider) Load(ctx context.Context, lm herd.LoadingMessage) (herd.Hosts, error) {
+	var data []byte
+	var err error
+	if p.config.File != "" {
+		data, err = ioutil.ReadFile(p.config.File)
+	} else {
+		lm(p.name, false, nil)
+		data, err = p.hp.Fetch(ctx)
+		lm(p.name, true, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Version != 4 {
+		return nil, fmt.Errorf("Unsupported terraform state version %d", s.Version)
+	}
+
+	hosts := herd.Hosts{}
+	for _, r := range s.Resources {
+		if r.Mode != "managed" {
+			continue
+		}
+		rt, ok := p.config.ResourceTypes[r.Type]
+		if !ok {
+			if rt, ok = resourceTypes[r.Type]; !ok {
+				continue
+			}
+		}
+		for _, i := range r.Instances {
+			address := r.Type + "." + r.Name
+			if r.Module != "" {
+				address = r.Module + "." + address
+			}
+			switch key := i.IndexKey.(type) {
+			case float64:
+				address += fmt.Sprintf("[%d]", int64(key))
+			case string:
+				address += fmt.Sprintf("[%q]", key)
+			}
+			name := firstString(i.Attributes, rt.Name)
+			if name == "" {
+				continue
+			}
+			attrs := herd.HostAttributes{
+				"terraform_address": address,
+				"terraform_module":  r.Module,
+				"terraform_type":    r.Type,
+			}
+			if tags, ok := lookup(i.Attributes, rt.Tags).(map[string]interface{}); ok {
+				for k, v := range tags {
+					attrs[k] = v
+				}
+			}
+			for k, path := range rt.Attributes {
+				if v := lookup(i.Attributes, path); v != nil {
+					attrs[k] = normalize(v)
+				}
+			}
+			hosts = append(hosts, herd.NewHost(name, firstString(i.Attributes, rt.Address), attrs))
+		}
+	}
+	return hosts, nil
+}
+
+// Find a value by walking a dotted path through maps and lists
+func lookup(attributes map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var value interface{} = attributes
+	for _, part := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+func firstString(attributes map[string]interface{}, paths []string) string {
+	for _, path := range paths {
+		if s, ok := lookup(attributes, path).(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Numbers in json are floats, but we prefer integers where possible. Lists
+// of strings become string slices.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case []interface{}:
+		ret := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return value
+			}
+			ret[i] = s
+		}
+		return ret
+	}
+	return value
+}
+
+var _ herd.DataLoader = &terraformProvider{}
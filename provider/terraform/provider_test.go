@@ -0,0 +1,143 @@
+package terraform
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/jarcoal/httpmock"
+	"github.com/spf13/viper"
+)
+
+func TestTerraformState(t *testing.T) {
+	p := newProvider("terraform").(*terraformProvider)
+	p.config.File = "terraform.tfstate"
+	if err := p.SetDataDir("testdata"); err != nil {
+		t.Fatalf("SetDataDir failed: %s", err)
+	}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+	if len(hosts) != 5 {
+		t.Fatalf("Expected 5 hosts, got %d", len(hosts))
+	}
+
+	tests := []struct {
+		name       string
+		address    string
+		attributes map[string]interface{}
+	}{
+		{"web01", "10.0.1.10", map[string]interface{}{
+			"terraform_address": "module.web.aws_instance.web[0]",
+			"terraform_module":  "module.web",
+			"terraform_type":    "aws_instance",
+			"instance_id":       "i-0123456789abcdef0",
+			"instance_type":     "t3.micro",
+			"availability_zone": "eu-west-1a",
+			"role":              "web",
+		}},
+		{"i-0fedcba9876543210", "10.0.2.10", map[string]interface{}{
+			"terraform_address": "module.web.aws_instance.web[1]",
+		}},
+		{"db-eu", "10.164.0.5", map[string]interface{}{
+			"terraform_address": "module.db[\"primary\"].google_compute_instance.db[\"eu\"]",
+			"terraform_module":  "module.db[\"primary\"]",
+			"machinetype":       "e2-standard-4",
+			"tags":              []string{"db", "ssh"},
+			"external_ip":       "34.90.1.2",
+			"env":               "prod",
+		}},
+		{"app01", "10.1.0.4", map[string]interface{}{
+			"terraform_address": "azurerm_linux_virtual_machine.app",
+			"terraform_module":  "",
+			"VMSize":            "Standard_B2s",
+			"public_ip":         "20.1.2.3",
+			"env":               "test",
+		}},
+		{"lab01", "192.168.122.50", map[string]interface{}{
+			"terraform_address": "libvirt_domain.lab",
+			"vcpu":              int64(2),
+			"memory":            int64(2048),
+		}},
+	}
+	for i, tc := range tests {
+		h := hosts[i]
+		if h.Name != tc.name || h.Address != tc.address {
+			t.Errorf("Incorrect name or address: %s %s, expected %s %s", h.Name, h.Address, tc.name, tc.address)
+			continue
+		}
+		for k, v := range tc.attributes {
+			if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+				t.Errorf("Incorrect value for %s on %s: %v", k, h.Name, diff)
+			}
+		}
+	}
+}
+
+func TestTerraformResourceTypes(t *testing.T) {
+	p := newProvider("terraform").(*terraformProvider)
+	v := viper.New()
+	v.Set("File", "testdata/terraform.tfstate")
+	v.Set("ResourceTypes", map[string]interface{}{
+		"proxmox_vm_qemu": map[string]interface{}{
+			"Name":       "name",
+			"Address":    "default_ipv4_address",
+			"Attributes": map[string]string{"node": "target_node", "cores": "cores"},
+		},
+	})
+	if err := p.ParseViper(v); err != nil {
+		t.Fatalf("Unable to parse config: %s", err)
+	}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+	h := hosts[len(hosts)-1]
+	if h.Name != "pve01" || h.Address != "192.168.10.20" {
+		t.Fatalf("Incorrect name or address: %s %s", h.Name, h.Address)
+	}
+	expected := map[string]interface{}{
+		"terraform_address": "proxmox_vm_qemu.pve",
+		"node":              "node1",
+		"cores":             int64(4),
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(h.Attributes[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+}
+
+func TestTerraformHttpBackend(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://state.ci/herd", httpmock.NewBytesResponder(200, data))
+	httpmock.RegisterResponder("GET", "http://state.ci/missing", httpmock.NewStringResponder(404, "Not found"))
+
+	p := newProvider("terraform").(*terraformProvider)
+	v := viper.New()
+	v.Set("Url", "http://state.ci/missing")
+	if err := p.ParseViper(v); err != nil {
+		t.Fatalf("Unable to parse config: %s", err)
+	}
+	if _, err := p.Load(context.Background(), func(string, bool, error) {}); err == nil {
+		t.Errorf("Missing state should result in an error")
+	}
+	v.Set("Url", "http://state.ci/herd")
+	if err := p.ParseViper(v); err != nil {
+		t.Fatalf("Unable to parse config: %s", err)
+	}
+	hosts, err := p.Load(context.Background(), func(string, bool, error) {})
+	if err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+	if len(hosts) != 5 {
+		t.Errorf("Expected 5 hosts, got %d", len(hosts))
+	}
+}
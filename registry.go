@@ -2,16 +2,19 @@ package herd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"reflect"
 	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/hashicorp/go-plugin"
 	"github.com/seveas/scattergather"
@@ -39,11 +42,16 @@ func RegisterProvider(name string, constructor func(string) HostProvider, magic
 }
 
 type Registry struct {
-	providers []HostProvider
-	hosts     Hosts
-	sort      []string
-	dataDir   string
-	cacheDir  string
+	providers    []HostProvider
+	status       []*ProviderStatus
+	rules        []*AttributeRule
+	conflicts    map[string]string
+	identityKeys []string
+	secrets      map[string][]string
+	hosts        Hosts
+	sort         []string
+	dataDir      string
+	cacheDir     string
 }
 
 type Hosts []*Host
@@ -60,12 +68,63 @@ type DataLoader interface {
 	SetDataDir(string) error
 }
 
+// Providers can report their settings, with any secrets hidden, for the
+// settings overview.
+type ConfiguredProvider interface {
+	Settings() map[string]interface{}
+}
+
+// Providers that show or log their own settings are told which settings were
+// resolved from secret references, so they always hide those.
+type SecretHider interface {
+	SetSecrets(keys []string)
+}
+
+// Providers can document themselves and their configuration, which is shown
+// by herd providers.
+type DocumentedProvider interface {
+	Documentation() string
+}
+
 type Cache interface {
 	Source() HostProvider
 	Invalidate()
 	SetCacheDir(string)
+	Age() time.Duration
+}
+
+// What we know about a provider, and how it fared the last time hosts were
+// loaded.
+type ProviderStatus struct {
+	Name     string
+	Type     string
+	Magic    bool
+	Optional bool
+	Cached   bool
+	CacheAge time.Duration
+	Hosts    int
+	Duration time.Duration
+	Error    error
+	// Only available once the provider has loaded hosts
+	Documentation string
+}
+
+// Caches that refresh in the background implement this, so we can wait for
+// the refresh to finish before exiting.
+type BackgroundRefresher interface {
+	WaitForRefresh()
 }
 
+// Providers that can tell whether their data changed since a previous load
+// implement this. A cache passes in the validator it stored with the cached
+// data, and the provider's Load returns ErrNotModified if it is still valid.
+type ConditionalLoader interface {
+	SetValidator(string)
+	Validator() string
+}
+
+var ErrNotModified = errors.New("Not modified")
+
 func NewRegistry(dataDir, cacheDir string) *Registry {
 	return &Registry{
 		providers: []HostProvider{},
@@ -105,7 +164,17 @@ func (r *Registry) LoadProviders(c *viper.Viper) error {
 
 	// And now all the explicitely configured ones
 	for key, _ := range c.AllSettings() {
-		ps := c.Sub(key)
+		ps, secrets, err := ResolveSecrets(c.Sub(key))
+		if err != nil {
+			rerr.Add(fmt.Errorf("Error parsing config for %s: %s", key, err))
+			continue
+		}
+		if len(secrets) > 0 {
+			if r.secrets == nil {
+				r.secrets = make(map[string][]string)
+			}
+			r.secrets[key] = secrets
+		}
 		pname := ps.GetString("Provider")
 		p, err := NewProvider(pname, key)
 		if err != nil {
@@ -116,6 +185,10 @@ func (r *Registry) LoadProviders(c *viper.Viper) error {
 				rerr.Add(fmt.Errorf("Error parsing config for %s: %s", key, err))
 			} else {
 				r.AddProvider(p)
+				r.status[len(r.status)-1].Optional = ps.GetBool("Optional")
+				if h, ok := stripCache(p).(SecretHider); ok {
+					h.SetSecrets(r.providerSecrets(p))
+				}
 			}
 		}
 	}
@@ -134,6 +207,29 @@ func (r *Registry) AddProvider(p HostProvider) {
 		c.SetDataDir(r.dataDir)
 	}
 	r.providers = append(r.providers, p)
+	r.status = append(r.status, newProviderStatus(p))
+}
+
+func newProviderStatus(p HostProvider) *ProviderStatus {
+	_, cached := p.(Cache)
+	return &ProviderStatus{Name: p.Name(), Type: providerType(p), Cached: cached}
+}
+
+// Providers live in a package named after them, so we use that as their type
+func providerType(p HostProvider) string {
+	t := reflect.TypeOf(stripCache(p))
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+func (r *Registry) ProviderStatus() []ProviderStatus {
+	ret := make([]ProviderStatus, len(r.status))
+	for i, s := range r.status {
+		ret[i] = *s
+	}
+	return ret
 }
 
 func (r *Registry) AddMagicProvider(p HostProvider) {
@@ -153,6 +249,7 @@ func (r *Registry) AddMagicProvider(p HostProvider) {
 		}
 	}
 	r.AddProvider(p)
+	r.status[len(r.status)-1].Magic = true
 }
 
 func stripCache(p HostProvider) HostProvider {
@@ -162,6 +259,22 @@ func stripCache(p HostProvider) HostProvider {
 	return p
 }
 
+// The settings of a provider that were resolved from secret references. For a
+// cache, these are the settings of its source.
+func (r *Registry) providerSecrets(p HostProvider) []string {
+	keys := r.secrets[p.Name()]
+	if _, ok := p.(Cache); !ok {
+		return keys
+	}
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.HasPrefix(k, "source.") {
+			ret = append(ret, k[len("source."):])
+		}
+	}
+	return ret
+}
+
 func (r *Registry) InvalidateCache() {
 	for _, p := range r.providers {
 		if c, ok := p.(Cache); ok {
@@ -170,6 +283,15 @@ func (r *Registry) InvalidateCache() {
 	}
 }
 
+// Wait for any background work by providers to finish
+func (r *Registry) End() {
+	for _, p := range r.providers {
+		if b, ok := p.(BackgroundRefresher); ok {
+			b.WaitForRefresh()
+		}
+	}
+}
+
 func (r *Registry) LoadHosts(ctx context.Context, lm LoadingMessage) error {
 	if len(r.hosts) > 0 {
 		return nil
@@ -193,45 +315,64 @@ func (r *Registry) LoadHosts(ctx context.Context, lm LoadingMessage) error {
 		signal.Reset()
 	}()
 
+	// Providers may have been set up without AddProvider
+	for len(r.status) < len(r.providers) {
+		r.status = append(r.status, newProviderStatus(r.providers[len(r.status)]))
+	}
+
 	sg := scattergather.New(int64(len(r.providers)))
+	// Results are gathered in the order providers finish, but we want to
+	// merge hosts in the order providers were configured.
+	loaded := make([]Hosts, len(r.providers))
 
-	for _, p := range r.providers {
+	for i, p := range r.providers {
 		sg.Run(func(ctx context.Context, args ...interface{}) (interface{}, error) {
 			p := args[0].(HostProvider)
+			status := args[1].(*ProviderStatus)
+			i := args[2].(int)
+			start := time.Now()
 			hosts, err := p.Load(ctx, lm)
+			status.Duration = time.Since(start)
+			status.Hosts = len(hosts)
+			status.Error = err
+			if c, ok := p.(Cache); ok {
+				status.CacheAge = c.Age()
+			}
+			if d, ok := stripCache(p).(DocumentedProvider); ok {
+				status.Documentation = d.Documentation()
+			}
+			if err != nil && status.Optional {
+				lm(p.Name(), true, nil)
+				logrus.Warnf("Ignoring optional provider %s: %s", p.Name(), err)
+				status.Hosts = 0
+				return Hosts{}, nil
+			}
 			lm(p.Name(), true, err)
-			logrus.Debugf("%d hosts returned from %s", len(hosts), p.Name())
+			logrus.Debugf("%d hosts returned from %s in %s", len(hosts), p.Name(), status.Duration)
+			// Rules are applied before merging, so renamed and converted
+			// attributes are what identity keys and conflict policies see.
 			for _, host := range hosts {
 				if p.Prefix() != "" {
 					host.Attributes = host.Attributes.prefix(p.Prefix())
 				}
 				host.Attributes["herd_provider"] = []string{p.Name()}
+				for _, rule := range r.rules {
+					rule.apply(host)
+				}
 			}
+			loaded[i] = hosts
 			return hosts, err
-		}, ctx, p)
+		}, ctx, p, r.status[i], i)
 	}
 
-	untypedHosts, err := sg.Wait()
+	_, err := sg.Wait()
 	lm("", true, nil)
-	seen := make(map[string]int)
-	allHosts := make(Hosts, 0)
 
 	if err != nil {
 		return err
 	}
 
-	for _, uh := range untypedHosts {
-		hosts := uh.(Hosts)
-		for _, host := range hosts {
-			if existing, ok := seen[host.Name]; ok {
-				allHosts[existing].Amend(host)
-			} else {
-				seen[host.Name] = len(allHosts)
-				allHosts = append(allHosts, host)
-			}
-		}
-	}
-	r.hosts = allHosts
+	r.hosts = r.mergeHosts(loaded)
 	return nil
 }
 
@@ -266,7 +407,9 @@ func (r *Registry) getHostsFromFile(fn string, attributes MatchAttributes) Hosts
 	}
 	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
 	for i, host := range r.hosts {
-		seen[host.Name] = i
+		for _, name := range host.Names() {
+			seen[name] = i
+		}
 	}
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -287,9 +430,15 @@ func (r *Registry) Settings() (string, map[string]interface{}) {
 	for i, p := range r.providers {
 		providers[i] = p.Name()
 	}
-	return "Registry", map[string]interface{}{
+	settings := map[string]interface{}{
 		"Providers": providers,
 	}
+	for _, p := range r.providers {
+		if c, ok := stripCache(p).(ConfiguredProvider); ok {
+			settings["Provider "+p.Name()] = redactSettings("", c.Settings(), r.providerSecrets(p))
+		}
+	}
+	return "Registry", settings
 }
 
 func (hosts Hosts) String() string {
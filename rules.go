@@ -0,0 +1,264 @@
+package herd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// A rule that transforms the attributes of the hosts each provider returns,
+// before hosts from different providers are merged, or that determines what
+// happens when multiple providers set the same attribute on a host. Each rule
+// does exactly one thing.
+type AttributeRule struct {
+	Attribute string
+	Rename    string
+	Alias     string
+	Regex     string
+	Template  string
+	Set       string
+	Type      string
+	Drop      bool
+	Conflict  string
+
+	regex    *regexp.Regexp
+	template *template.Template
+}
+
+const (
+	ConflictFirst = "first"
+	ConflictLast  = "last"
+	ConflictMerge = "merge"
+)
+
+// Attributes that herd manages itself, rules must not change them
+var internalAttributes = []string{"herd_provider", "herd_aliases", "herd_transport"}
+
+func (r *AttributeRule) compile() error {
+	actions := 0
+	for _, set := range []bool{r.Rename != "", r.Alias != "", r.Regex != "", r.Template != "", r.Type != "", r.Drop, r.Conflict != ""} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("exactly one of rename, alias, regex, template, type, drop and conflict must be set")
+	}
+	if r.Attribute == "" && r.Template == "" {
+		return fmt.Errorf("no attribute specified")
+	}
+	switch {
+	case r.Regex != "":
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		named := false
+		for _, n := range re.SubexpNames() {
+			named = named || n != ""
+		}
+		if !named && r.Set == "" {
+			return fmt.Errorf("regex has no named groups and no attribute to set")
+		}
+		r.regex = re
+	case r.Template != "":
+		if r.Set == "" {
+			return fmt.Errorf("template has no attribute to set")
+		}
+		tmpl, err := template.New("attribute").Funcs(templateFuncs).Option("missingkey=error").Parse(r.Template)
+		if err != nil {
+			return err
+		}
+		r.template = tmpl
+	case r.Type != "":
+		switch r.Type {
+		case "string", "int", "bool", "list":
+		default:
+			return fmt.Errorf("unknown type %s", r.Type)
+		}
+	case r.Conflict != "":
+		switch r.Conflict {
+		case ConflictFirst, ConflictLast, ConflictMerge:
+		default:
+			return fmt.Errorf("unknown conflict policy %s", r.Conflict)
+		}
+	}
+	targets := []string{r.Rename, r.Alias, r.Set}
+	if r.Rename != "" || r.Drop || r.Type != "" || r.Conflict != "" {
+		targets = append(targets, r.Attribute)
+	}
+	if r.regex != nil {
+		targets = append(targets, r.regex.SubexpNames()...)
+	}
+	for _, target := range targets {
+		for _, attr := range internalAttributes {
+			if target == attr {
+				return fmt.Errorf("%s is managed by herd and can't be changed by rules", attr)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *AttributeRule) apply(h *Host) {
+	if r.template != nil {
+		var buf bytes.Buffer
+		if err := r.template.Execute(&buf, h); err != nil {
+			logrus.Debugf("Not setting %s on %s: %s", r.Set, h.Name, err)
+			return
+		}
+		h.Attributes[r.Set] = buf.String()
+		return
+	}
+	value, ok := h.Attributes[r.Attribute]
+	if !ok {
+		return
+	}
+	switch {
+	case r.Rename != "":
+		delete(h.Attributes, r.Attribute)
+		h.Attributes[r.Rename] = value
+	case r.Alias != "":
+		h.Attributes[r.Alias] = value
+	case r.Drop:
+		delete(h.Attributes, r.Attribute)
+	case r.regex != nil:
+		m := r.regex.FindStringSubmatch(fmt.Sprintf("%v", value))
+		if m == nil {
+			return
+		}
+		named := false
+		for i, n := range r.regex.SubexpNames() {
+			if n != "" {
+				h.Attributes[n] = m[i]
+				named = true
+			}
+		}
+		if !named {
+			// Without named groups, we use the first group or the whole match
+			v := m[0]
+			if len(m) > 1 {
+				v = m[1]
+			}
+			h.Attributes[r.Set] = v
+		}
+	case r.Type != "":
+		v, err := coerce(value, r.Type)
+		if err != nil {
+			logrus.Debugf("Unable to convert %s on %s to %s: %s", r.Attribute, h.Name, r.Type, err)
+			return
+		}
+		h.Attributes[r.Attribute] = v
+	}
+}
+
+func coerce(value interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "int":
+		return cast.ToInt64E(value)
+	case "bool":
+		if s, ok := value.(string); ok {
+			switch strings.ToLower(s) {
+			case "yes", "on":
+				return true, nil
+			case "no", "off":
+				return false, nil
+			}
+		}
+		return cast.ToBoolE(value)
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	case "list":
+		if s, ok := value.(string); ok {
+			ret := []string{}
+			for _, part := range strings.Split(s, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					ret = append(ret, part)
+				}
+			}
+			return ret, nil
+		}
+		return toList(value), nil
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// Turn a value into a list of values. Lists of strings become []string, so
+// they print and match like lists from providers do.
+func toList(value interface{}) interface{} {
+	values := []interface{}{}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).Interface())
+		}
+	} else {
+		values = append(values, value)
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return values
+		}
+		strs[i] = s
+	}
+	return strs
+}
+
+// Combine two values into one list, skipping duplicates
+func mergeValues(a, b interface{}) interface{} {
+	values := []interface{}{}
+	seen := func(v interface{}) bool {
+		if !reflect.TypeOf(v).Comparable() {
+			return false
+		}
+		for _, e := range values {
+			if reflect.TypeOf(e).Comparable() && e == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range []interface{}{a, b} {
+		if v == nil {
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice {
+			rv = reflect.ValueOf([]interface{}{v})
+		}
+		for i := 0; i < rv.Len(); i++ {
+			e := rv.Index(i).Interface()
+			if e != nil && !seen(e) {
+				values = append(values, e)
+			}
+		}
+	}
+	return toList(values)
+}
+
+func (r *Registry) SetAttributeRules(rules []AttributeRule) error {
+	r.rules = []*AttributeRule{}
+	r.conflicts = make(map[string]string)
+	for i := range rules {
+		rule := rules[i]
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("Invalid attribute rule %d: %s", i+1, err)
+		}
+		if rule.Conflict != "" {
+			r.conflicts[rule.Attribute] = rule.Conflict
+		} else {
+			r.rules = append(r.rules, &rule)
+		}
+	}
+	return nil
+}
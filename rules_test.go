@@ -0,0 +1,136 @@
+package herd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/viper"
+)
+
+type attributeProvider struct {
+	name  string
+	attrs HostAttributes
+}
+
+func (p *attributeProvider) Name() string {
+	return p.name
+}
+
+func (p *attributeProvider) Prefix() string {
+	return ""
+}
+
+func (p *attributeProvider) Equivalent(o HostProvider) bool {
+	return false
+}
+
+func (p *attributeProvider) Load(ctx context.Context, lm LoadingMessage) (Hosts, error) {
+	attrs := HostAttributes{}
+	for k, v := range p.attrs {
+		attrs[k] = v
+	}
+	return Hosts{NewHost("host-1.example.com", "", attrs)}, nil
+}
+
+func (p *attributeProvider) ParseViper(v *viper.Viper) error {
+	return nil
+}
+
+func TestInvalidAttributeRules(t *testing.T) {
+	rules := []AttributeRule{
+		{},
+		{Attribute: "os"},
+		{Attribute: "os", Rename: "platform", Drop: true},
+		{Attribute: "os", Regex: "("},
+		{Attribute: "os", Regex: "^linux"},
+		{Template: "{{ .Name }}"},
+		{Attribute: "os", Type: "float"},
+		{Attribute: "os", Conflict: "random"},
+		{Attribute: "herd_provider", Drop: true},
+		{Attribute: "herd_aliases", Type: "string"},
+		{Attribute: "herd_provider", Conflict: "first"},
+		{Attribute: "provider", Rename: "herd_provider"},
+		{Attribute: "transport", Alias: "herd_transport"},
+		{Template: "{{ .Name }}", Set: "herd_aliases"},
+		{Attribute: "os", Regex: "^(?P<herd_transport>\\w+)"},
+	}
+	for _, rule := range rules {
+		r := NewRegistry("/tmp", "/tmp")
+		if err := r.SetAttributeRules([]AttributeRule{rule}); err == nil {
+			t.Errorf("Rule %+v should not be valid", rule)
+		}
+	}
+}
+
+func TestAttributeRules(t *testing.T) {
+	r := NewRegistry("/tmp", "/tmp")
+	r.AddProvider(&attributeProvider{name: "aws", attrs: HostAttributes{
+		"aws:PlatformDetails": "Linux/UNIX",
+		"os":                  "Ubuntu 22.04",
+		"cpus":                "4",
+		"managed":             "yes",
+		"roles":               "web, db",
+		"secret":              "s3cr3t",
+		"tags":                []string{"a", "b"},
+		"aws:Placement":       "ams1",
+	}})
+	r.AddProvider(&attributeProvider{name: "consul", attrs: HostAttributes{
+		"os":   "Ubuntu 20.04",
+		"tags": []string{"b", "c"},
+		"site": "ams2",
+		"rack": "r12",
+	}})
+	err := r.SetAttributeRules([]AttributeRule{
+		{Attribute: "os", Conflict: ConflictFirst},
+		{Attribute: "tags", Conflict: ConflictMerge},
+		{Attribute: "site", Conflict: ConflictMerge},
+		{Attribute: "release", Conflict: ConflictFirst},
+		{Attribute: "operating_system", Conflict: ConflictFirst},
+		{Attribute: "aws:PlatformDetails", Rename: "platform"},
+		{Attribute: "aws:Placement", Rename: "site"},
+		{Attribute: "os", Alias: "operating_system"},
+		{Attribute: "os", Regex: `^(?P<distro>\w+) (?P<release>[\d.]+)$`},
+		{Attribute: "platform", Regex: `^(\w+)/`, Set: "kernel"},
+		{Template: "{{ .Attributes.rack }}.{{ .Attributes.hostname }}", Set: "location"},
+		{Template: "{{ .Attributes.missing }}", Set: "nothing"},
+		{Attribute: "cpus", Type: "int"},
+		{Attribute: "managed", Type: "bool"},
+		{Attribute: "roles", Type: "list"},
+		{Attribute: "secret", Drop: true},
+	})
+	if err != nil {
+		t.Fatalf("Unable to set rules: %s", err)
+	}
+	if err := r.LoadHosts(context.Background(), func(string, bool, error) {}); err != nil {
+		t.Fatalf("Unable to load hosts: %s", err)
+	}
+	if len(r.hosts) != 1 {
+		t.Fatalf("Expected 1 host, got %d", len(r.hosts))
+	}
+	attrs := r.hosts[0].Attributes
+	expected := map[string]interface{}{
+		"platform":         "Linux/UNIX",
+		"os":               "Ubuntu 22.04",
+		"operating_system": "Ubuntu 22.04",
+		"distro":           "Ubuntu",
+		"release":          "22.04",
+		"kernel":           "Linux",
+		"location":         "r12.host-1",
+		"cpus":             int64(4),
+		"managed":          true,
+		"roles":            []string{"web", "db"},
+		"tags":             []string{"a", "b", "c"},
+		"site":             []string{"ams1", "ams2"},
+	}
+	for k, v := range expected {
+		if diff := deep.Equal(attrs[k], v); diff != nil {
+			t.Errorf("Incorrect value for %s: %v", k, diff)
+		}
+	}
+	for _, k := range []string{"aws:PlatformDetails", "aws:Placement", "secret", "nothing"} {
+		if _, ok := attrs[k]; ok {
+			t.Errorf("Attribute %s should not be set", k)
+		}
+	}
+}
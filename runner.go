@@ -3,9 +3,14 @@ package herd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/seveas/scattergather"
@@ -33,10 +38,29 @@ type Runner struct {
 	hosts       Hosts
 	sort        []string
 	parallel    int
+	parallelPer map[string]int
 	splay       time.Duration
 	timeout     time.Duration
 	hostTimeout time.Duration
+	signalGrace time.Duration
+	noTemplate  bool
 	executor    Executor
+	runLock     sync.Mutex
+	runs        map[string]*hostRun
+	resume      *Checkpoint
+	cpDir       string
+	cpLock      sync.Mutex
+	cpSaved     time.Time
+	cpPending   *time.Timer
+}
+
+// The state of a single host in the current run, used to forward signals and
+// to cancel execution on that host.
+type hostRun struct {
+	cancel   context.CancelFunc
+	signals  chan os.Signal
+	running  bool
+	canceled bool
 }
 
 type ProgressState int
@@ -55,6 +79,7 @@ func NewRunner(executor Executor) *Runner {
 		executor:    executor,
 		timeout:     60 * time.Second,
 		hostTimeout: 10 * time.Second,
+		signalGrace: 5 * time.Second,
 	}
 }
 
@@ -62,14 +87,23 @@ func (r *Runner) GetHosts() Hosts {
 	return r.hosts[:]
 }
 
+// Hosts that were already added are sorted again, so the order does not
+// depend on whether hosts or sort fields are set first.
 func (r *Runner) SetSortFields(s []string) {
 	r.sort = s
+	r.hosts.Sort(s)
 }
 
 func (r *Runner) SetParallel(p int) {
 	r.parallel = p
 }
 
+// Limit the number of hosts that run in parallel per value of an attribute,
+// for example at most 5 hosts per site, on top of the global limit.
+func (r *Runner) SetParallelPer(limits map[string]int) {
+	r.parallelPer = limits
+}
+
 func (r *Runner) SetSplay(t time.Duration) {
 	r.splay = t
 }
@@ -82,6 +116,41 @@ func (r *Runner) SetHostTimeout(t time.Duration) {
 	r.hostTimeout = t
 }
 
+// When a run is interrupted or a host is canceled, running commands are first
+// sent the signal, and only killed when they have not exited after this grace
+// period.
+func (r *Runner) SetSignalGrace(t time.Duration) {
+	r.signalGrace = t
+}
+
+// Commands are templates that are rendered for each host, unless templating is
+// disabled for commands that contain literal {{ and }}.
+func (r *Runner) SetNoTemplate(n bool) {
+	r.noTemplate = n
+}
+
+// Progress of each run is saved in this directory, so interrupted runs can be
+// resumed.
+func (r *Runner) SetCheckpointDir(dir string) {
+	r.cpDir = dir
+}
+
+// The next run uses the run id and settings of the checkpoint, and only runs on
+// hosts that did not finish successfully before. Their previous results are
+// merged into the results of the new run.
+func (r *Runner) Resume(cp *Checkpoint) {
+	s := cp.Settings
+	r.SetSortFields(s.Sort)
+	r.parallel = s.Parallel
+	r.parallelPer = s.ParallelPer
+	r.splay = s.Splay
+	r.timeout = s.Timeout
+	r.hostTimeout = s.HostTimeout
+	r.signalGrace = s.SignalGrace
+	r.noTemplate = s.NoTemplate
+	r.resume = cp
+}
+
 // FIXME
 func (r *Runner) SetConnectTimeout(t time.Duration) {
 	if r.executor != nil {
@@ -92,9 +161,12 @@ func (r *Runner) SetConnectTimeout(t time.Duration) {
 func (r *Runner) Settings() (string, map[string]interface{}) {
 	return "Runner", map[string]interface{}{
 		"Parallel":    r.parallel,
+		"ParallelPer": formatParallelPer(r.parallelPer),
 		"Splay":       r.splay,
 		"Timeout":     r.timeout,
 		"HostTimeout": r.hostTimeout,
+		"SignalGrace": r.signalGrace,
+		"NoTemplate":  r.noTemplate,
 	}
 }
 
@@ -129,36 +201,135 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 			}
 		}()
 	}
+	var tmpl *template.Template
+	if !r.noTemplate && strings.Contains(command, "{{") {
+		var err error
+		tmpl, err = template.New("command").Funcs(templateFuncs).Option("missingkey=error").Parse(command)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse command template: %s", err)
+		}
+	}
 	hi := newHistoryItem(command, r.hosts)
+	resume := r.resume
+	r.resume = nil
+	if resume != nil {
+		hi.Id = resume.Id
+	}
+	cp := r.newCheckpoint(hi, resume)
+	if cp != nil {
+		if err := PruneCheckpoints(r.cpDir, checkpointKeep, checkpointMaxAge); err != nil {
+			logrus.Warn(err.Error())
+		}
+	}
+	r.saveCheckpoint(cp, nil, true)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// With limits per attribute, the scheduler enforces the global limit too,
+	// so hosts waiting for their site or rack don't take up slots.
 	var sg *scattergather.ScatterGather
-	if r.parallel > 0 {
+	var sched *scheduler
+	if len(r.parallelPer) > 0 {
+		sched = newScheduler(r.parallel, r.parallelPer)
+		sg = scattergather.New(int64(len(r.hosts)))
+	} else if r.parallel > 0 {
 		sg = scattergather.New(int64(r.parallel))
 	} else {
 		sg = scattergather.New(int64(len(r.hosts)))
 	}
+	r.runLock.Lock()
+	r.runs = make(map[string]*hostRun)
+	r.runLock.Unlock()
+	defer func() {
+		r.runLock.Lock()
+		r.runs = nil
+		r.runLock.Unlock()
+	}()
 	for _, host := range hi.Hosts {
+		if resume != nil && resume.succeeded(host.Name) {
+			result := resume.Results[host.Name]
+			result.Host = host
+			host.lastResult = result
+			hi.Results[host.Name] = result
+			r.saveCheckpoint(cp, result, false)
+			pc <- ProgressMessage{Host: host, State: Finished, Result: result}
+			continue
+		}
+		hctx, hcancel := context.WithCancel(ctx)
+		hr := &hostRun{cancel: hcancel, signals: make(chan os.Signal, 1)}
+		r.runLock.Lock()
+		r.runs[host.Name] = hr
+		r.runLock.Unlock()
+		var sh *scheduledHost
+		if sched != nil {
+			sh = sched.enqueue(host)
+		}
 		sg.Run(func(ctx context.Context, args ...interface{}) (interface{}, error) {
 			host := args[0].(*Host)
+			if sched != nil {
+				if err := sched.wait(ctx, sh); err != nil {
+					return nil, err
+				}
+				defer sched.done(sh)
+			}
 			if r.splay > 0 {
 				pc <- ProgressMessage{Host: host, State: Waiting}
 				r.splayDelay(ctx)
 			}
+			// Hosts canceled while queued may still get a slot, they must not
+			// start running
+			r.runLock.Lock()
+			if hr.canceled {
+				r.runLock.Unlock()
+				return nil, context.Canceled
+			}
+			hr.running = true
+			r.runLock.Unlock()
 			pc <- ProgressMessage{Host: host, State: Running}
 			ctx, cancel := context.WithTimeout(ctx, r.hostTimeout)
 			defer cancel()
-			result := r.executor.Run(ctx, host, command, oc)
+			ctx = WithSignals(ctx, hr.signals)
+			var result *Result
+			if hostCommand, err := renderCommand(tmpl, command, host); err != nil {
+				now := time.Now()
+				result = &Result{Host: host, ExitStatus: -1, Err: err, StartTime: now, EndTime: now}
+			} else {
+				result = r.executor.Run(ctx, host, hostCommand, oc)
+				result.Command = hostCommand
+			}
+			r.runLock.Lock()
+			if hr.canceled && result.ExitStatus != 0 {
+				result.Err = CanceledError{Message: "Canceled while executing command"}
+			}
+			r.runLock.Unlock()
 			host.lastResult = result
+			r.saveCheckpoint(cp, result, false)
 			pc <- ProgressMessage{Host: host, State: Finished, Result: result}
 			return result, nil
-		}, ctx, host)
+		}, hctx, host)
+	}
+	if sched != nil {
+		sched.start()
 	}
 	go func() {
 		timeout := time.After(r.timeout)
 		signals := make(chan os.Signal, 5)
-		signal.Notify(signals, os.Interrupt)
-		defer signal.Reset(os.Interrupt)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Reset(os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-timeout:
+			logrus.Errorf("Run canceled with unfinished tasks!")
+			cancel()
+			return
+		case sig := <-signals:
+			logrus.Errorf("Interrupted, stopping running commands. Interrupt again to cancel immediately")
+			r.runLock.Lock()
+			for _, hr := range r.runs {
+				r.interrupt(hr, sig)
+			}
+			r.runLock.Unlock()
+		case <-ctx.Done():
+			return
+		}
 		select {
 		case <-timeout:
 			logrus.Errorf("Run canceled with unfinished tasks!")
@@ -167,7 +338,6 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 			logrus.Errorf("Interrupted, canceling with unfinished tasks")
 			cancel()
 		case <-ctx.Done():
-			return
 		}
 	}()
 	results, _ := sg.Wait()
@@ -175,22 +345,29 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 	for _, rawResult := range results {
 		result := rawResult.(*Result)
 		hi.Results[result.Host.Name] = result
-		switch result.ExitStatus {
-		case -1:
-			hi.Summary.Err++
-		case 0:
-			hi.Summary.Ok++
-		default:
-			hi.Summary.Fail++
-		}
 	}
 	for _, host := range r.hosts {
 		if _, ok := hi.Results[host.Name]; !ok {
-			result := &Result{Host: host, ExitStatus: -1, Err: errors.New("context canceled")}
+			var err error = errors.New("context canceled")
+			r.runLock.Lock()
+			if hr, ok := r.runs[host.Name]; ok && hr.canceled {
+				err = CanceledError{Message: "Canceled before executing command"}
+			}
+			r.runLock.Unlock()
+			result := &Result{Host: host, ExitStatus: -1, Err: err, Command: command}
 			host.lastResult = result
 			pc <- ProgressMessage{Host: host, State: Finished, Result: result}
 			hi.Results[host.Name] = result
+		}
+	}
+	for _, result := range hi.Results {
+		switch result.ExitStatus {
+		case -1:
 			hi.Summary.Err++
+		case 0:
+			hi.Summary.Ok++
+		default:
+			hi.Summary.Fail++
 		}
 	}
 	for _, key := range r.sort {
@@ -200,9 +377,158 @@ func (r *Runner) Run(command string, pc chan ProgressMessage, oc chan OutputLine
 		}
 	}
 	hi.end()
+	if cp != nil {
+		r.cpLock.Lock()
+		for name, result := range hi.Results {
+			cp.Results[name] = result
+		}
+		cp.Finished = true
+		r.cpLock.Unlock()
+		r.saveCheckpoint(cp, nil, true)
+	}
 	return hi, nil
 }
 
+// Internal commands such as herd:keyscan and herd:tunnel are not sent to the
+// hosts, so they are not checkpointed and cannot be resumed.
+func (r *Runner) newCheckpoint(hi *HistoryItem, resume *Checkpoint) *Checkpoint {
+	if r.cpDir == "" || strings.HasPrefix(hi.Command, "herd:") {
+		return nil
+	}
+	hosts := make([]string, len(hi.Hosts))
+	for i, host := range hi.Hosts {
+		hosts[i] = host.Name
+	}
+	startTime := hi.StartTime
+	results := make(map[string]*Result)
+	// Hosts that could not be found when resuming are kept, so they can still be
+	// resumed later.
+	if resume != nil {
+		hosts = resume.Hosts
+		startTime = resume.StartTime
+		for name, result := range resume.Results {
+			results[name] = result
+		}
+	}
+	return &Checkpoint{
+		Id:      hi.Id,
+		Command: hi.Command,
+		Hosts:   hosts,
+		Settings: checkpointSettings{
+			Sort:        r.sort,
+			Parallel:    r.parallel,
+			ParallelPer: r.parallelPer,
+			Splay:       r.splay,
+			Timeout:     r.timeout,
+			HostTimeout: r.hostTimeout,
+			SignalGrace: r.signalGrace,
+			NoTemplate:  r.noTemplate,
+		},
+		Results:   results,
+		StartTime: startTime,
+	}
+}
+
+// Checkpoints are saved at most once per second while results come in, unless
+// forced at the start and end of a run. Results that came in too soon after the
+// last save are saved when the second is up.
+func (r *Runner) saveCheckpoint(cp *Checkpoint, result *Result, force bool) {
+	if cp == nil {
+		return
+	}
+	r.cpLock.Lock()
+	defer r.cpLock.Unlock()
+	if result != nil {
+		cp.Results[result.Host.Name] = result
+	}
+	if !force && time.Since(r.cpSaved) < checkpointInterval {
+		// Make sure this result is saved even if no other result comes in
+		if r.cpPending == nil {
+			var timer *time.Timer
+			timer = time.AfterFunc(checkpointInterval-time.Since(r.cpSaved), func() {
+				r.cpLock.Lock()
+				defer r.cpLock.Unlock()
+				if r.cpPending != timer {
+					return
+				}
+				r.cpPending = nil
+				if err := cp.save(r.cpDir); err != nil {
+					logrus.Warnf("Unable to save checkpoint for run %s: %s", cp.Id, err)
+				}
+				r.cpSaved = time.Now()
+			})
+			r.cpPending = timer
+		}
+		return
+	}
+	if r.cpPending != nil {
+		r.cpPending.Stop()
+		r.cpPending = nil
+	}
+	if err := cp.save(r.cpDir); err != nil {
+		logrus.Warnf("Unable to save checkpoint for run %s: %s", cp.Id, err)
+	}
+	r.cpSaved = time.Now()
+}
+
+// Cancel the execution on a single host. Hosts that are still queued will not
+// run the command at all, running commands are sent an interrupt and killed if
+// they don't exit within the signal grace period. Returns whether the host was
+// part of the current run.
+func (r *Runner) CancelHost(name string) bool {
+	r.runLock.Lock()
+	defer r.runLock.Unlock()
+	hr, ok := r.runs[name]
+	if ok {
+		r.interrupt(hr, os.Interrupt)
+	}
+	return ok
+}
+
+// Must be called with runLock held
+func (r *Runner) interrupt(hr *hostRun, sig os.Signal) {
+	if hr.canceled {
+		return
+	}
+	hr.canceled = true
+	if !hr.running || r.signalGrace <= 0 {
+		hr.cancel()
+		return
+	}
+	select {
+	case hr.signals <- sig:
+	default:
+	}
+	time.AfterFunc(r.signalGrace, hr.cancel)
+}
+
+type signalKey struct{}
+
+// Attach a channel of signals to forward to a command to the context that is
+// passed to an executor.
+func WithSignals(ctx context.Context, signals <-chan os.Signal) context.Context {
+	return context.WithValue(ctx, signalKey{}, signals)
+}
+
+// Executors can use this to receive signals that should be forwarded to the
+// command they are running. After the grace period, the context is canceled
+// and the command should be killed.
+func Signals(ctx context.Context) <-chan os.Signal {
+	ch, _ := ctx.Value(signalKey{}).(<-chan os.Signal)
+	return ch
+}
+
+func renderCommand(tmpl *template.Template, command string, host *Host) (string, error) {
+	if tmpl == nil {
+		return command, nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, host); err != nil {
+		return "", fmt.Errorf("Unable to render command: %s", err)
+	}
+	return b.String(), nil
+}
+
 func (r *Runner) End() {
 	for _, h := range r.hosts {
 		if h.Connection != nil {
@@ -210,6 +536,9 @@ func (r *Runner) End() {
 			h.Connection.Close()
 		}
 	}
+	if ender, ok := r.executor.(interface{ End() }); ok {
+		ender.End()
+	}
 }
 
 func (r *Runner) splayDelay(ctx context.Context) {
@@ -234,3 +563,11 @@ type TimeoutError struct {
 func (e TimeoutError) Error() string {
 	return e.Message
 }
+
+type CanceledError struct {
+	Message string
+}
+
+func (e CanceledError) Error() string {
+	return e.Message
+}
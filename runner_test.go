@@ -0,0 +1,251 @@
+package herd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandTemplates(t *testing.T) {
+	hosts := Hosts{
+		NewHost("host-1.example.com", "10.0.0.1", HostAttributes{"site": "site1"}),
+		NewHost("host-2.example.com", "10.0.0.2", HostAttributes{"site": "site2"}),
+		NewHost("host-3.example.com", "10.0.0.3", HostAttributes{}),
+	}
+	tests := []struct {
+		command    string
+		noTemplate bool
+		expected   []string
+	}{
+		{"uptime", false, []string{"uptime", "uptime", "uptime"}},
+		{"deploy --site {{.Attributes.site}} --ip {{.Address}}", false, []string{
+			"deploy --site site1 --ip 10.0.0.1",
+			"deploy --site site2 --ip 10.0.0.2",
+			"",
+		}},
+		{"echo '{{.Attributes.site}}'", true, []string{
+			"echo '{{.Attributes.site}}'",
+			"echo '{{.Attributes.site}}'",
+			"echo '{{.Attributes.site}}'",
+		}},
+	}
+	for _, test := range tests {
+		e := &fakeExecutor{}
+		r := NewRunner(e)
+		r.SetNoTemplate(test.noTemplate)
+		r.AddHosts(hosts)
+		hi, err := r.Run(test.command, nil, nil)
+		if err != nil {
+			t.Errorf("Unexpected error running %s: %s", test.command, err)
+			continue
+		}
+		for i, host := range hosts {
+			result := hi.Results[host.Name]
+			if test.expected[i] == "" {
+				if result.Err == nil || result.ExitStatus != -1 {
+					t.Errorf("Expected a template error for %s, got %v", host.Name, result)
+				}
+				if _, ok := e.commands[host.Name]; ok {
+					t.Errorf("Command was run on %s despite a template error", host.Name)
+				}
+				continue
+			}
+			if e.commands[host.Name] != test.expected[i] {
+				t.Errorf("Expected '%s' to run on %s, got '%s'", test.expected[i], host.Name, e.commands[host.Name])
+			}
+			if result.Command != test.expected[i] {
+				t.Errorf("Expected '%s' to be recorded for %s, got '%s'", test.expected[i], host.Name, result.Command)
+			}
+		}
+	}
+
+	r := NewRunner(&fakeExecutor{})
+	r.AddHosts(hosts)
+	if _, err := r.Run("echo {{.Name", nil, nil); err == nil {
+		t.Errorf("Invalid templates should fail the run")
+	}
+}
+
+// An executor whose commands run until they are signaled or killed
+type blockingExecutor struct {
+	stubborn map[string]bool
+	signaled map[string]os.Signal
+	lock     sync.Mutex
+}
+
+func (e *blockingExecutor) SetConnectTimeout(t time.Duration) {
+}
+
+func (e *blockingExecutor) Run(ctx context.Context, host *Host, command string, oc chan OutputLine) *Result {
+	r := &Result{Host: host, ExitStatus: -1}
+	signals := Signals(ctx)
+	for {
+		select {
+		case sig := <-signals:
+			e.lock.Lock()
+			e.signaled[host.Name] = sig
+			stubborn := e.stubborn[host.Name]
+			e.lock.Unlock()
+			if !stubborn {
+				r.ExitStatus = 130
+				return r
+			}
+		case <-ctx.Done():
+			r.Err = TimeoutError{Message: "Timed out while executing command"}
+			return r
+		}
+	}
+}
+
+func TestCancelHost(t *testing.T) {
+	hosts := Hosts{
+		NewHost("host-1.example.com", "", HostAttributes{}),
+		NewHost("host-2.example.com", "", HostAttributes{}),
+		NewHost("host-3.example.com", "", HostAttributes{}),
+	}
+	e := &blockingExecutor{stubborn: make(map[string]bool), signaled: make(map[string]os.Signal)}
+	r := NewRunner(e)
+	r.SetParallel(2)
+	r.SetSignalGrace(100 * time.Millisecond)
+	r.SetTimeout(10 * time.Second)
+	r.SetHostTimeout(10 * time.Second)
+	r.AddHosts(hosts)
+	if r.CancelHost(hosts[0].Name) {
+		t.Errorf("Hosts can't be canceled outside of a run")
+	}
+	// Which hosts get to run first is up to the scheduler, so we make the
+	// second one to start ignore the interrupt
+	pc := make(chan ProgressMessage)
+	running := []string{}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for msg := range pc {
+			if msg.State != Running {
+				continue
+			}
+			running = append(running, msg.Host.Name)
+			if len(running) == 2 {
+				e.lock.Lock()
+				e.stubborn[running[1]] = true
+				e.lock.Unlock()
+				for _, host := range hosts {
+					if !r.CancelHost(host.Name) {
+						t.Errorf("Unable to cancel %s", host.Name)
+					}
+				}
+			}
+		}
+	}()
+	start := time.Now()
+	hi, err := r.Run("sleep 3600", pc, nil)
+	close(pc)
+	<-done
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Canceling hosts took too long")
+	}
+	for _, host := range hosts {
+		result := hi.Results[host.Name]
+		if _, ok := result.Err.(CanceledError); !ok {
+			t.Errorf("Expected %s to be canceled, got %v", host.Name, result.Err)
+		}
+	}
+	if len(running) != 2 {
+		t.Fatalf("Expected 2 hosts to start running, got %v", running)
+	}
+	if len(e.signaled) != 2 || e.signaled[running[0]] != os.Interrupt || e.signaled[running[1]] != os.Interrupt {
+		t.Errorf("Expected the commands on %v to be interrupted, got %v", running, e.signaled)
+	}
+	if hi.Results[running[0]].ExitStatus != 130 {
+		t.Errorf("Commands that exit when interrupted should not be killed")
+	}
+	if hi.Results[running[1]].ExitStatus != -1 {
+		t.Errorf("Commands that ignore the interrupt should be killed")
+	}
+}
+
+// An executor that records how many hosts per site run at the same time
+type concurrencyExecutor struct {
+	lock    sync.Mutex
+	running map[string]int
+	max     map[string]int
+	total   int
+	maxAll  int
+}
+
+func (e *concurrencyExecutor) SetConnectTimeout(t time.Duration) {
+}
+
+func (e *concurrencyExecutor) Run(ctx context.Context, host *Host, command string, oc chan OutputLine) *Result {
+	site, _ := host.Attributes["site"].(string)
+	e.lock.Lock()
+	e.running[site]++
+	e.total++
+	if e.running[site] > e.max[site] {
+		e.max[site] = e.running[site]
+	}
+	if e.total > e.maxAll {
+		e.maxAll = e.total
+	}
+	e.lock.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	e.lock.Lock()
+	e.running[site]--
+	e.total--
+	e.lock.Unlock()
+	return &Result{Host: host, ExitStatus: 0}
+}
+
+func TestParallelPer(t *testing.T) {
+	hosts := Hosts{}
+	for i := 0; i < 12; i++ {
+		site := "site1"
+		if i%4 == 3 {
+			site = "site2"
+		}
+		hosts = append(hosts, NewHost(fmt.Sprintf("host-%02d.example.com", i), "", HostAttributes{"site": site}))
+	}
+	hosts = append(hosts, NewHost("host-99.example.com", "", HostAttributes{}))
+	e := &concurrencyExecutor{running: make(map[string]int), max: make(map[string]int)}
+	r := NewRunner(e)
+	r.SetParallel(4)
+	r.SetParallelPer(map[string]int{"site": 2})
+	r.AddHosts(hosts)
+	hi, err := r.Run("uptime", nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hi.Summary.Ok != len(hosts) {
+		t.Errorf("Expected all hosts to succeed, got %v", hi.Summary)
+	}
+	if e.max["site1"] != 2 || e.max["site2"] != 2 {
+		t.Errorf("Expected at most 2 hosts per site to run at the same time, got %v", e.max)
+	}
+	if e.maxAll > 4 {
+		t.Errorf("Expected at most 4 hosts to run at the same time, got %d", e.maxAll)
+	}
+}
+
+func TestParseParallelPer(t *testing.T) {
+	limits, err := ParseParallelPer([]string{"site=5,rack=1", "os=3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(limits) != 3 || limits["site"] != 5 || limits["rack"] != 1 || limits["os"] != 3 {
+		t.Errorf("Unexpected limits: %v", limits)
+	}
+	for _, spec := range []string{"site", "=5", "site=0", "site=many"} {
+		if _, err := ParseParallelPer([]string{spec}); err == nil {
+			t.Errorf("Expected an error for %s", spec)
+		}
+	}
+	if s := formatParallelPer(limits); s != "os=3,rack=1,site=5" {
+		t.Errorf("Unexpected formatting: %s", s)
+	}
+}
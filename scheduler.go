@@ -0,0 +1,155 @@
+package herd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Parse concurrency limits per attribute, given as attribute=limit. Each spec
+// can contain multiple limits separated by commas.
+func ParseParallelPer(specs []string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			idx := strings.Index(part, "=")
+			if idx < 1 {
+				return nil, fmt.Errorf("Invalid concurrency limit %s, expected attribute=limit", part)
+			}
+			limit, err := strconv.Atoi(part[idx+1:])
+			if err != nil || limit < 1 {
+				return nil, fmt.Errorf("Invalid concurrency limit %s, the limit must be a positive number", part)
+			}
+			limits[part[:idx]] = limit
+		}
+	}
+	return limits, nil
+}
+
+func formatParallelPer(limits map[string]int) string {
+	parts := make([]string, 0, len(limits))
+	for attr, limit := range limits {
+		parts = append(parts, fmt.Sprintf("%s=%d", attr, limit))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// The scheduler decides when hosts may start running, given a global limit and
+// limits per attribute value. Hosts start in the order they are queued, but a
+// host that has to wait for a busy site or rack does not hold up hosts
+// elsewhere.
+type scheduler struct {
+	lock     sync.Mutex
+	parallel int
+	limits   map[string]int
+	running  int
+	counts   map[string]map[string]int
+	queue    []*scheduledHost
+}
+
+type scheduledHost struct {
+	host    *Host
+	values  map[string]string
+	ready   chan struct{}
+	started bool
+}
+
+func newScheduler(parallel int, limits map[string]int) *scheduler {
+	s := &scheduler{parallel: parallel, limits: limits, counts: make(map[string]map[string]int)}
+	for attr := range limits {
+		s.counts[attr] = make(map[string]int)
+	}
+	return s
+}
+
+// Add a host to the queue. Hosts without a limited attribute are not limited
+// by it.
+func (s *scheduler) enqueue(host *Host) *scheduledHost {
+	sh := &scheduledHost{host: host, values: make(map[string]string), ready: make(chan struct{})}
+	for attr := range s.limits {
+		if value, ok := host.GetAttribute(attr); ok && value != nil {
+			sh.values[attr] = fmt.Sprintf("%v", value)
+		}
+	}
+	s.lock.Lock()
+	s.queue = append(s.queue, sh)
+	s.lock.Unlock()
+	return sh
+}
+
+// Wait until the host may start, or the context is done
+func (s *scheduler) wait(ctx context.Context, sh *scheduledHost) error {
+	select {
+	case <-sh.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sh.started {
+		s.release(sh)
+	} else {
+		for i, q := range s.queue {
+			if q == sh {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// Start as many hosts as the limits allow
+func (s *scheduler) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dispatch()
+}
+
+func (s *scheduler) done(sh *scheduledHost) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.release(sh)
+}
+
+func (s *scheduler) release(sh *scheduledHost) {
+	s.running--
+	for attr, value := range sh.values {
+		s.counts[attr][value]--
+	}
+	s.dispatch()
+}
+
+func (s *scheduler) dispatch() {
+	queue := s.queue[:0]
+	for _, sh := range s.queue {
+		if (s.parallel > 0 && s.running >= s.parallel) || !s.fits(sh) {
+			queue = append(queue, sh)
+			continue
+		}
+		s.running++
+		for attr, value := range sh.values {
+			s.counts[attr][value]++
+		}
+		sh.started = true
+		close(sh.ready)
+	}
+	s.queue = queue
+}
+
+func (s *scheduler) fits(sh *scheduledHost) bool {
+	for attr, value := range sh.values {
+		if s.counts[attr][value] >= s.limits[attr] {
+			return false
+		}
+	}
+	return true
+}
@@ -35,10 +35,16 @@ func (c setCommand) execute(e *ScriptEngine) {
 		e.Runner.SetTimeout(c.value.(time.Duration))
 	case "HostTimeout":
 		e.Runner.SetHostTimeout(c.value.(time.Duration))
+	case "SignalGrace":
+		e.Runner.SetSignalGrace(c.value.(time.Duration))
 	case "ConnectTimeout":
 		e.Runner.SetConnectTimeout(c.value.(time.Duration))
 	case "Parallel":
 		e.Runner.SetParallel(int(c.value.(int64)))
+	case "ParallelPer":
+		e.Runner.SetParallelPer(c.value.(map[string]int))
+	case "NoTemplate":
+		e.Runner.SetNoTemplate(c.value.(bool))
 	}
 }
 
@@ -123,6 +129,7 @@ func (c runCommand) execute(e *ScriptEngine) {
 	e.Ui.Sync()
 	if hi != nil {
 		e.History = append(e.History, hi)
+		e.record(hi)
 		// FIXME
 		if !strings.HasPrefix(c.command, "herd:") {
 			e.Ui.PrintHistoryItem(hi)
@@ -133,3 +140,16 @@ func (c runCommand) execute(e *ScriptEngine) {
 func (c runCommand) String() string {
 	return "run " + c.command
 }
+
+type resumeCommand struct {
+	checkpoint *herd.Checkpoint
+}
+
+func (c resumeCommand) execute(e *ScriptEngine) {
+	e.Runner.Resume(c.checkpoint)
+	runCommand{command: c.checkpoint.Command}.execute(e)
+}
+
+func (c resumeCommand) String() string {
+	return "resume " + c.checkpoint.Id
+}
@@ -16,10 +16,16 @@ type ScriptEngine struct {
 	Registry *herd.Registry
 	Runner   *herd.Runner
 	History  herd.History
+	sinks    []namedSink
 	commands []command
 	position int
 }
 
+type namedSink struct {
+	name string
+	sink herd.Sink
+}
+
 func NewScriptEngine(ui herd.UI, registry *herd.Registry, runner *herd.Runner) *ScriptEngine {
 	return &ScriptEngine{
 		Ui:       ui,
@@ -31,6 +37,19 @@ func NewScriptEngine(ui herd.UI, registry *herd.Registry, runner *herd.Runner) *
 	}
 }
 
+// Sinks receive every history item, in the order they were added
+func (e *ScriptEngine) AddSink(name string, sink herd.Sink) {
+	e.sinks = append(e.sinks, namedSink{name: name, sink: sink})
+}
+
+func (e *ScriptEngine) record(hi *herd.HistoryItem) {
+	for _, s := range e.sinks {
+		if err := s.sink.Record(hi); err != nil {
+			logrus.Warnf("Unable to send results to sink %s: %s", s.name, err)
+		}
+	}
+}
+
 func (e *ScriptEngine) ParseCommandLine(args []string, splitAt int) error {
 	filters := args
 	if splitAt != -1 {
@@ -128,6 +147,22 @@ hostspecLoop:
 	return nil
 }
 
+// Queue up the commands to resume an interrupted run: select all hosts of that
+// run, and run the command on the ones that did not yet succeed.
+func (e *ScriptEngine) Resume(cp *herd.Checkpoint) {
+	e.Runner.SetSortFields(cp.Settings.Sort)
+	for _, name := range cp.Hosts {
+		// Names are matched exactly, names that look like a glob would
+		// select other hosts too.
+		if strings.ContainsAny(name, `*?[\`) {
+			e.commands = append(e.commands, addHostsCommand{glob: "*", attributes: herd.MatchAttributes{{Name: "name", Value: name}}})
+		} else {
+			e.commands = append(e.commands, addHostsCommand{glob: name, attributes: herd.MatchAttributes{}})
+		}
+	}
+	e.commands = append(e.commands, resumeCommand{checkpoint: cp})
+}
+
 func (e *ScriptEngine) ParseScriptFile(fn string) error {
 	code, err := ioutil.ReadFile(fn)
 	if err != nil {
@@ -164,5 +199,11 @@ func (e *ScriptEngine) Execute() {
 
 func (e *ScriptEngine) End() {
 	e.Runner.End()
+	for _, s := range e.sinks {
+		if ender, ok := s.sink.(interface{ End() }); ok {
+			ender.End()
+		}
+	}
+	e.Registry.End()
 	e.Ui.End()
 }
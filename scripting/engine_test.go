@@ -144,3 +144,25 @@ func TestParseCommandLine(t *testing.T) {
 		})
 	}
 }
+
+func TestResumeExactNames(t *testing.T) {
+	hosts := herd.Hosts{
+		herd.NewHost("web1.example.com", "", herd.HostAttributes{}),
+		herd.NewHost("web[1].example.com", "", herd.HostAttributes{}),
+		herd.NewHost("web*.example.com", "", herd.HostAttributes{}),
+	}
+	e := NewScriptEngine(nil, nil, herd.NewRunner(nil))
+	e.Resume(&herd.Checkpoint{Hosts: []string{"web[1].example.com", "web*.example.com", "web1.example.com"}})
+	for i, name := range []string{"web[1].example.com", "web*.example.com", "web1.example.com"} {
+		c := e.commands[i].(addHostsCommand)
+		matched := []string{}
+		for _, host := range hosts {
+			if host.Match(c.glob, c.attributes) {
+				matched = append(matched, host.Name)
+			}
+		}
+		if len(matched) != 1 || matched[0] != name {
+			t.Errorf("Resuming %s selects %v", name, matched)
+		}
+	}
+}
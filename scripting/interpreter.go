@@ -123,6 +123,8 @@ func (l *herdListener) ExitSet(c *parser.SetContext) {
 		fallthrough
 	case "HostTimeout":
 		fallthrough
+	case "SignalGrace":
+		fallthrough
 	case "ConnectTimeout":
 		if _, ok := varValue.(time.Duration); !ok {
 			err = fmt.Errorf("%s must be a duration", varName)
@@ -132,10 +134,18 @@ func (l *herdListener) ExitSet(c *parser.SetContext) {
 		if _, ok := varValue.(int64); !ok {
 			err = fmt.Errorf("%s must be a number", varName)
 		}
+	case "ParallelPer":
+		if s, ok := varValue.(string); ok {
+			varValue, err = herd.ParseParallelPer([]string{s})
+		} else {
+			err = fmt.Errorf("%s must be a string", varName)
+		}
 	case "Timestamp":
 		fallthrough
 	case "NoPager":
 		fallthrough
+	case "NoTemplate":
+		fallthrough
 	case "NoColor":
 		if _, ok := varValue.(bool); !ok {
 			err = fmt.Errorf("%s must be a boolean", varName)
@@ -143,15 +153,16 @@ func (l *herdListener) ExitSet(c *parser.SetContext) {
 	case "Output":
 		if s, ok := varValue.(string); ok {
 			outputModes := map[string]herd.OutputMode{
-				"all":      herd.OutputAll,
-				"inline":   herd.OutputInline,
-				"per-host": herd.OutputPerhost,
-				"tail":     herd.OutputTail,
+				"all":       herd.OutputAll,
+				"inline":    herd.OutputInline,
+				"per-host":  herd.OutputPerhost,
+				"tail":      herd.OutputTail,
+				"dashboard": herd.OutputDashboard,
 			}
-			if s == "all" || s == "per-host" || s == "inline" || s == "tail" {
-				varValue = outputModes[s]
+			if om, ok := outputModes[s]; ok {
+				varValue = om
 			} else {
-				err = fmt.Errorf("Unknown output mode: %s. Known modes: all, per-host, inline, tail", s)
+				err = fmt.Errorf("Unknown output mode: %s. Known modes: all, per-host, inline, tail, dashboard", s)
 			}
 		} else {
 			err = fmt.Errorf("%s must be a string", varName)
@@ -72,11 +72,14 @@ var testcases = []testcase{
 			"set Splay 5s",
 			"set Timeout 1m",
 			"set HostTimeout 10m",
+			"set SignalGrace 3s",
 			"set ConnectTimeout 10s",
 			"set Parallel 50",
+			"set ParallelPer \"site=5,rack=1\"",
 			"set Timestamp true",
 			"set NoPager true",
 			"set NoColor true",
+			"set NoTemplate true",
 			"set LogLevel \"debug\"",
 			"set Output \"inline\"",
 		}, "\n") + "\n",
@@ -84,11 +87,14 @@ var testcases = []testcase{
 			setCommand{variable: "Splay", value: 5 * time.Second},
 			setCommand{variable: "Timeout", value: 1 * time.Minute},
 			setCommand{variable: "HostTimeout", value: 10 * time.Minute},
+			setCommand{variable: "SignalGrace", value: 3 * time.Second},
 			setCommand{variable: "ConnectTimeout", value: 10 * time.Second},
 			setCommand{variable: "Parallel", value: int64(50)},
+			setCommand{variable: "ParallelPer", value: map[string]int{"site": 5, "rack": 1}},
 			setCommand{variable: "Timestamp", value: true},
 			setCommand{variable: "NoPager", value: true},
 			setCommand{variable: "NoColor", value: true},
+			setCommand{variable: "NoTemplate", value: true},
 			setCommand{variable: "LogLevel", value: logrus.DebugLevel},
 			setCommand{variable: "Output", value: herd.OutputInline},
 		},
@@ -113,6 +119,10 @@ var testcases = []testcase{
 		program: "set Parallel \"nope\"\n",
 		errors:  []error{fmt.Errorf("line 1:13 Parallel must be a number")},
 	},
+	{
+		program: "set ParallelPer \"site\"\n",
+		errors:  []error{fmt.Errorf("line 1:16 Invalid concurrency limit site, expected attribute=limit")},
+	},
 	{
 		program: "set Timestamp 23\n",
 		errors:  []error{fmt.Errorf("line 1:14 Timestamp must be a boolean")},
@@ -131,7 +141,7 @@ var testcases = []testcase{
 	},
 	{
 		program: "set Output \"foo\"\n",
-		errors:  []error{fmt.Errorf("line 1:11 Unknown output mode: foo. Known modes: all, per-host, inline, tail")},
+		errors:  []error{fmt.Errorf("line 1:11 Unknown output mode: foo. Known modes: all, per-host, inline, tail, dashboard")},
 	},
 	{
 		program: "set LogLevel nil\n",
@@ -0,0 +1,172 @@
+package herd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+// Configuration values can refer to secrets instead of containing them. Only
+// values that consist of a single reference are resolved:
+//
+//	${env:VARIABLE}          the value of an environment variable
+//	${file:/path/to/file}    the contents of a file
+//	${cmd:pass show herd}    the output of a command
+//	${keyring:service/user}  a password from the system keyring
+//
+// Settings that were resolved are remembered by name, so they can be hidden
+// when settings are shown.
+var secretReference = regexp.MustCompile(`^\$\{(env|file|cmd|keyring):(.*)\}$`)
+
+const redactedSecret = "********"
+
+var keyringGet = keyring.Get
+
+func ResolveSecret(value string) (string, bool, error) {
+	parts := secretReference.FindStringSubmatch(value)
+	if parts == nil {
+		return value, false, nil
+	}
+	parts = parts[1:]
+	var secret string
+	switch parts[0] {
+	case "env":
+		v, ok := os.LookupEnv(parts[1])
+		if !ok {
+			return "", true, fmt.Errorf("environment variable %s is not set", parts[1])
+		}
+		secret = v
+	case "file":
+		data, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return "", true, err
+		}
+		secret = strings.TrimRight(string(data), "\r\n")
+	case "cmd":
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", parts[1])
+		} else {
+			cmd = exec.Command("/bin/sh", "-c", parts[1])
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", true, fmt.Errorf("%s failed: %s %s", parts[1], err, strings.TrimSpace(stderr.String()))
+		}
+		secret = strings.TrimRight(string(out), "\r\n")
+	case "keyring":
+		idx := strings.LastIndex(parts[1], "/")
+		if idx == -1 {
+			return "", true, fmt.Errorf("keyring references must look like ${keyring:service/user}")
+		}
+		v, err := keyringGet(parts[1][:idx], parts[1][idx+1:])
+		if err != nil {
+			return "", true, fmt.Errorf("unable to find %s in the keyring: %s", parts[1], err)
+		}
+		secret = v
+	}
+	return secret, true, nil
+}
+
+// Returns a new viper instance with all secret references resolved, and the
+// names of the settings that were resolved.
+func ResolveSecrets(v *viper.Viper) (*viper.Viper, []string, error) {
+	keys := []string{}
+	settings, err := resolveSecrets("", v.AllSettings(), &keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	nv := viper.New()
+	if err := nv.MergeConfigMap(settings.(map[string]interface{})); err != nil {
+		return nil, nil, err
+	}
+	return nv, keys, nil
+}
+
+func resolveSecrets(key string, value interface{}, keys *[]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		secret, resolved, err := ResolveSecret(v)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to resolve %s: %s", key, err)
+		}
+		if resolved {
+			*keys = append(*keys, key)
+		}
+		return secret, nil
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			sk := k
+			if key != "" {
+				sk = key + "." + k
+			}
+			r, err := resolveSecrets(sk, e, keys)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = r
+		}
+		return ret, nil
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			r, err := resolveSecrets(fmt.Sprintf("%s[%d]", key, i), e, keys)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = r
+		}
+		return ret, nil
+	}
+	return value, nil
+}
+
+// Hide the values of the given settings, named like ResolveSecrets names them
+func RedactSecrets(settings map[string]interface{}, keys []string) map[string]interface{} {
+	return redactSettings("", settings, keys).(map[string]interface{})
+}
+
+func redactSettings(key string, value interface{}, keys []string) interface{} {
+	for _, k := range keys {
+		if k == key {
+			return redactedSecret
+		}
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		ret := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := fmt.Sprintf("%v", iter.Key().Interface())
+			sk := k
+			if key != "" {
+				sk = key + "." + k
+			}
+			ret[k] = redactSettings(sk, iter.Value().Interface(), keys)
+		}
+		return ret
+	case reflect.Slice:
+		if _, ok := value.([]byte); ok {
+			return value
+		}
+		ret := make([]interface{}, rv.Len())
+		for i := range ret {
+			ret[i] = redactSettings(fmt.Sprintf("%s[%d]", key, i), rv.Index(i).Interface(), keys)
+		}
+		return ret
+	}
+	return value
+}
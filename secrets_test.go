@@ -0,0 +1,141 @@
+package herd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/spf13/viper"
+)
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("HERD_TEST_SECRET", "from-env")
+	defer os.Unsetenv("HERD_TEST_SECRET")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(f func(string, string) (string, error)) { keyringGet = f }(keyringGet)
+	keyringGet = func(service, user string) (string, error) {
+		if service == "herd/test" && user == "admin" {
+			return "from-keyring", nil
+		}
+		return "", errors.New("secret not found in keyring")
+	}
+
+	testcases := []struct {
+		value    string
+		expected string
+		resolved bool
+		err      bool
+	}{
+		{"plain", "plain", false, false},
+		{"https://example.com", "https://example.com", false, false},
+		{"env:HERD_TEST_SECRET", "env:HERD_TEST_SECRET", false, false},
+		{"${HOME}", "${HOME}", false, false},
+		{"Bearer ${env:HERD_TEST_SECRET}", "Bearer ${env:HERD_TEST_SECRET}", false, false},
+		{"${env:HERD_TEST_SECRET}", "from-env", true, false},
+		{"${env:HERD_TEST_NO_SUCH_VARIABLE}", "", true, true},
+		{"${file:" + file + "}", "from-file", true, false},
+		{"${file:" + filepath.Join(dir, "missing") + "}", "", true, true},
+		{"${cmd:echo from-cmd}", "from-cmd", true, false},
+		{"${cmd:exit 1}", "", true, true},
+		{"${keyring:herd/test/admin}", "from-keyring", true, false},
+		{"${keyring:herd/test/nobody}", "", true, true},
+		{"${keyring:herd}", "", true, true},
+	}
+	for _, test := range testcases {
+		t.Run(test.value, func(t *testing.T) {
+			value, resolved, err := ResolveSecret(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value != test.expected || resolved != test.resolved {
+				t.Errorf("Expected %q (%t), got %q (%t)", test.expected, test.resolved, value, resolved)
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	os.Setenv("HERD_TEST_PASSWORD", "hunter2")
+	defer os.Unsetenv("HERD_TEST_PASSWORD")
+	v := viper.New()
+	v.Set("Provider", "http")
+	v.Set("Password", "${env:HERD_TEST_PASSWORD}")
+	v.Set("Source.Password", "${env:HERD_TEST_PASSWORD}")
+	v.Set("Headers", []interface{}{"X-Token: plain", "${env:HERD_TEST_PASSWORD}"})
+
+	rv, keys, err := ResolveSecrets(v)
+	if err != nil {
+		t.Fatalf("Unable to resolve secrets: %s", err)
+	}
+	sort.Strings(keys)
+	if diff := deep.Equal(keys, []string{"headers[1]", "password", "source.password"}); diff != nil {
+		t.Errorf("Resolved settings not returned: %v", diff)
+	}
+	if rv.GetString("Provider") != "http" || rv.GetString("Password") != "hunter2" {
+		t.Errorf("Secrets not resolved: %v", rv.AllSettings())
+	}
+	if sub := rv.Sub("Source"); sub == nil || sub.GetString("Password") != "hunter2" {
+		t.Errorf("Nested secrets not resolved: %v", rv.AllSettings())
+	}
+	if headers := rv.GetStringSlice("Headers"); len(headers) != 2 || headers[1] != "hunter2" {
+		t.Errorf("Secrets in lists not resolved: %v", headers)
+	}
+	if v.GetString("Password") != "${env:HERD_TEST_PASSWORD}" {
+		t.Errorf("Original configuration was modified")
+	}
+
+	v.Set("Token", "${env:HERD_TEST_NO_SUCH_VARIABLE}")
+	if _, _, err = ResolveSecrets(v); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("Expected an error mentioning the setting, got %v", err)
+	}
+}
+
+func TestSecretSettings(t *testing.T) {
+	os.Setenv("HERD_TEST_TOKEN", "s3cr3t-t0k3n")
+	defer os.Unsetenv("HERD_TEST_TOKEN")
+	v := viper.New()
+	v.Set("Token", "${env:HERD_TEST_TOKEN}")
+	v.Set("Headers", []interface{}{"X-Plain: s3cr3t-t0k3n", "${env:HERD_TEST_TOKEN}"})
+	v.Set("Source.Url", "https://example.com")
+	rv, keys, err := ResolveSecrets(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only settings that were resolved are hidden, the same value elsewhere
+	// is not a secret
+	r := NewRegistry("/tmp", "/tmp")
+	r.AddProvider(&configuredProvider{settings: rv.AllSettings()})
+	r.secrets = map[string][]string{"configured": keys}
+	_, settings := r.Settings()
+	expected := map[string]interface{}{
+		"token":   "********",
+		"headers": []interface{}{"X-Plain: s3cr3t-t0k3n", "********"},
+		"source":  map[string]interface{}{"url": "https://example.com"},
+	}
+	if diff := deep.Equal(settings["Provider configured"], expected); diff != nil {
+		t.Errorf("Secrets not hidden correctly: %v", diff)
+	}
+}
+
+type configuredProvider struct {
+	hostsProvider
+	settings map[string]interface{}
+}
+
+func (p *configuredProvider) Name() string {
+	return "configured"
+}
+
+func (p *configuredProvider) Settings() map[string]interface{} {
+	return p.settings
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/seveas/herd"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -29,8 +30,9 @@ const (
 )
 
 type config struct {
-	user   user.User
-	blocks []*configBlock
+	user     user.User
+	blocks   []*configBlock
+	forwards bool
 }
 
 type configBlock struct {
@@ -39,6 +41,11 @@ type configBlock struct {
 	strictHostKeyChecking strictHostKeyChecking
 	verifyHostKeyDns      bool
 	identityFile          string
+	proxyJump             string
+	addressFamily         string
+	forwardAgent          bool
+	localForwards         []forward
+	remoteForwards        []forward
 	clientConfig          *ssh.ClientConfig
 }
 
@@ -93,6 +100,28 @@ func (c *configBlock) updateFromBlock(o *configBlock) {
 	if c.clientConfig.User == "" {
 		c.clientConfig.User = o.clientConfig.User
 	}
+	if c.proxyJump == "" {
+		c.proxyJump = o.proxyJump
+	}
+	if c.addressFamily == "" {
+		c.addressFamily = o.addressFamily
+	}
+	if !c.forwardAgent {
+		c.forwardAgent = o.forwardAgent
+	}
+	c.localForwards = append(c.localForwards, o.localForwards...)
+	c.remoteForwards = append(c.remoteForwards, o.remoteForwards...)
+}
+
+// The network to dial, based on the AddressFamily setting
+func (c *configBlock) network() string {
+	switch c.addressFamily {
+	case "inet":
+		return "tcp4"
+	case "inet6":
+		return "tcp6"
+	}
+	return "tcp"
 }
 
 // Parse an openssh config file
@@ -131,6 +160,19 @@ func parseConfig(file string) ([]*configBlock, error) {
 			continue
 		}
 
+		// Forwards can be specified multiple times
+		if key == "localforward" || key == "remoteforward" {
+			f, err := parseForward(val)
+			if err != nil {
+				logrus.Errorf("Ignoring invalid ssh config line: %s: %s", line, err)
+			} else if key == "localforward" {
+				config.localForwards = append(config.localForwards, f)
+			} else {
+				config.remoteForwards = append(config.remoteForwards, f)
+			}
+			continue
+		}
+
 		if _, ok := seen[key]; ok {
 			continue
 		}
@@ -157,6 +199,12 @@ func parseConfig(file string) ([]*configBlock, error) {
 			}
 		case "identityfile":
 			config.identityFile = val
+		case "proxyjump":
+			config.proxyJump = val
+		case "addressfamily":
+			config.addressFamily = strings.ToLower(val)
+		case "forwardagent":
+			config.forwardAgent = strings.ToLower(val) == "yes"
 		}
 	}
 	return append(configs, config), nil
@@ -213,6 +261,39 @@ func (c *config) expandSshTokens(input, hostname string, b *configBlock) (string
 	return output, err
 }
 
+// Agent and port forwarding set with the herd_forward_agent,
+// herd_local_forward and herd_remote_forward attributes
+func (c *configBlock) forwardsFromAttributes(host *herd.Host) {
+	if forward, err := cast.ToBoolE(host.Attributes["herd_forward_agent"]); err == nil && host.Attributes["herd_forward_agent"] != nil {
+		c.forwardAgent = forward
+	}
+	for _, attr := range []string{"herd_local_forward", "herd_remote_forward"} {
+		var specs []string
+		switch v := host.Attributes[attr].(type) {
+		case nil:
+			continue
+		case string:
+			specs = []string{v}
+		default:
+			var err error
+			if specs, err = cast.ToStringSliceE(v); err != nil {
+				logrus.Warnf("Ignoring invalid %s for %s: %s", attr, host.Name, err)
+				continue
+			}
+		}
+		for _, spec := range specs {
+			f, err := parseForward(spec)
+			if err != nil {
+				logrus.Warnf("Ignoring invalid %s for %s: %s", attr, host.Name, err)
+			} else if attr == "herd_local_forward" {
+				c.localForwards = append(c.localForwards, f)
+			} else {
+				c.remoteForwards = append(c.remoteForwards, f)
+			}
+		}
+	}
+}
+
 // Find all variables relevant for a host, first match wins
 func (c *config) forHost(host *herd.Host) *configBlock {
 	b := newConfigBlock(nil)
@@ -228,6 +309,49 @@ func (c *config) forHost(host *herd.Host) *configBlock {
 		}
 	}
 
+	// Forwarding the agent or ports is reasonable for interactive use, but not
+	// when connecting to a whole fleet, and inventories should not be able
+	// to get the agent forwarded to hosts they choose. Forwarding from the
+	// ssh config and from the herd_forward_agent, herd_local_forward and
+	// herd_remote_forward attributes is only used when asked for.
+	if c.forwards {
+		b.forwardsFromAttributes(host)
+	} else {
+		b.forwardAgent = false
+		b.localForwards = nil
+		b.remoteForwards = nil
+	}
+
+	// Providers can override the connection settings for a host with
+	// herd_user, herd_port, herd_identity_file, herd_jump (a ProxyJump spec,
+	// or none) and herd_address_family. These are never prefixed, but
+	// attributes that providers namespace, such as consul node meta, are:
+	// meta:herd_port needs a rename rule to become herd_port.
+	if user, ok := host.Attributes["herd_user"].(string); ok && user != "" {
+		b.clientConfig.User = user
+	}
+	if port, err := cast.ToIntE(host.Attributes["herd_port"]); err == nil && port > 0 {
+		b.port = port
+	}
+	if path, ok := host.Attributes["herd_identity_file"].(string); ok && path != "" {
+		b.identityFile = path
+	}
+	if jump, ok := host.Attributes["herd_jump"].(string); ok && jump != "" {
+		b.proxyJump = jump
+	}
+	if family, ok := host.Attributes["herd_address_family"].(string); ok && family != "" {
+		b.addressFamily = strings.ToLower(family)
+	}
+	if b.proxyJump == "none" {
+		b.proxyJump = ""
+	}
+	switch b.addressFamily {
+	case "", "any", "inet", "inet6":
+	default:
+		logrus.Warnf("Ignoring unknown address family %s for %s", b.addressFamily, host.Name)
+		b.addressFamily = ""
+	}
+
 	if path, err := c.expandSshTokens(b.identityFile, host.Name, b); err == nil {
 		b.identityFile = path
 	}
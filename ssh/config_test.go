@@ -0,0 +1,104 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/seveas/herd"
+)
+
+const testConfig = `
+Host *.example.com
+    ProxyJump bastion.example.com
+    IdentityFile ~/.ssh/id_example
+Host *
+    AddressFamily inet
+`
+
+func TestForHost(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(fn, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newConfig(user.User{Username: "me", HomeDir: "/home/me"})
+	blocks, err := parseConfig(fn)
+	if err != nil {
+		t.Fatalf("Unable to parse config: %s", err)
+	}
+	c.blocks = blocks
+
+	tests := []struct {
+		name     string
+		host     string
+		attrs    herd.HostAttributes
+		user     string
+		port     int
+		identity string
+		jump     string
+		family   string
+	}{
+		{"ssh config", "web-1.example.com", nil, "me", 22, "/home/me/.ssh/id_example", "bastion.example.com", "inet"},
+		{"defaults", "web-1.example.org", nil, "me", 22, "", "", "inet"},
+		{"attributes", "web-1.example.com", herd.HostAttributes{
+			"herd_user":           "deploy",
+			"herd_port":           int64(2222),
+			"herd_identity_file":  "~/.ssh/id_deploy",
+			"herd_jump":           "admin@gw.example.com:2022,bastion-2.example.com",
+			"herd_address_family": "INET6",
+		}, "deploy", 2222, "/home/me/.ssh/id_deploy", "admin@gw.example.com:2022,bastion-2.example.com", "inet6"},
+		{"port as string", "web-1.example.org", herd.HostAttributes{"herd_port": "2022"}, "me", 2022, "", "", "inet"},
+		{"no jump host", "web-1.example.com", herd.HostAttributes{"herd_jump": "none"}, "me", 22, "/home/me/.ssh/id_example", "", "inet"},
+		{"invalid values", "web-1.example.org", herd.HostAttributes{"herd_user": "", "herd_port": "ssh", "herd_address_family": "ipx"}, "me", 22, "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := c.forHost(herd.NewHost(test.host, "", test.attrs))
+			if b.clientConfig.User != test.user || b.port != test.port || b.identityFile != test.identity || b.proxyJump != test.jump || b.addressFamily != test.family {
+				t.Errorf("Expected %s@:%d %s via %q (%q), got %s@:%d %s via %q (%q)",
+					test.user, test.port, test.identity, test.jump, test.family,
+					b.clientConfig.User, b.port, b.identityFile, b.proxyJump, b.addressFamily)
+			}
+		})
+	}
+}
+
+func TestJumpHostFor(t *testing.T) {
+	host := herd.NewHost("web-1.example.com", "", nil)
+	tests := []struct {
+		spec string
+		name string
+		user string
+		port string
+		jump string
+		err  bool
+	}{
+		{"gw.example.com", "gw.example.com", "", "", "none", false},
+		{"admin@gw.example.com:2022", "gw.example.com", "admin", "2022", "none", false},
+		{"admin@[2001:db8::1]:2022", "2001:db8::1", "admin", "2022", "none", false},
+		{"gw.example.com, admin@bastion.example.com", "bastion.example.com", "admin", "", "gw.example.com", false},
+		{"a.example.com,b.example.com,c.example.com", "c.example.com", "", "", "a.example.com,b.example.com", false},
+		{"web-1.example.com", "", "", "", "", true},
+		{"admin@", "", "", "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			jump, err := jumpHostFor(host, test.spec)
+			if test.err {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", jump.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			user, _ := jump.Attributes["herd_user"].(string)
+			port, _ := jump.Attributes["herd_port"].(string)
+			if jump.Name != test.name || user != test.user || port != test.port || jump.Attributes["herd_jump"] != test.jump {
+				t.Errorf("Expected %s@%s:%s via %s, got %s@%s:%s via %v", test.user, test.name, test.port, test.jump, user, jump.Name, port, jump.Attributes["herd_jump"])
+			}
+		})
+	}
+}
@@ -4,23 +4,36 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
 	"os/user"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"bytes"
 	"github.com/seveas/herd"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
 type Executor struct {
 	agent          *agent
 	config         *config
 	connectTimeout time.Duration
+	jumpLock       sync.Mutex
+	jumpHosts      map[string]*jumpHost
+	keyStore       *KeyStore
 }
 
-func NewExecutor(agentTimeout time.Duration, user user.User) (herd.Executor, error) {
+// Connections to jump hosts are shared by all hosts that use them
+type jumpHost struct {
+	sync.Mutex
+	host *herd.Host
+}
+
+func NewExecutor(agentTimeout time.Duration, user user.User) (*Executor, error) {
 	agent, err := newAgent(agentTimeout)
 	if err != nil {
 		return nil, err
@@ -31,8 +44,9 @@ func NewExecutor(agentTimeout time.Duration, user user.User) (herd.Executor, err
 	}
 
 	return &Executor{
-		agent:  agent,
-		config: config,
+		agent:     agent,
+		config:    config,
+		jumpHosts: make(map[string]*jumpHost),
 	}, nil
 }
 
@@ -40,6 +54,19 @@ func (e *Executor) SetConnectTimeout(t time.Duration) {
 	e.connectTimeout = t
 }
 
+// Forward the agent and ports as set with ForwardAgent, LocalForward and
+// RemoteForward in the ssh config, or with the herd_forward_agent,
+// herd_local_forward and herd_remote_forward host attributes
+func (e *Executor) SetForwards(enabled bool) {
+	e.config.forwards = enabled
+}
+
+// Record keys that are accepted on first use, and check keys against the keys
+// recorded earlier.
+func (e *Executor) SetKeyStore(s *KeyStore) {
+	e.keyStore = s
+}
+
 func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
 	now := time.Now()
 	r := &herd.Result{Host: host, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
@@ -63,6 +90,11 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 		return r
 	}
 	defer sess.Close()
+	if e.config.forHost(host).forwardAgent {
+		if err = sshagent.RequestAgentForwarding(sess); err != nil {
+			logrus.Warnf("Unable to forward ssh agent to %s: %s", host.Name, err)
+		}
+	}
 
 	var stdout, stderr herd.ByteWriter
 	if oc != nil {
@@ -81,15 +113,25 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 		ec <- sess.Run(command)
 	}()
 
-	select {
-	case <-ctx.Done():
-		// FIXME: no error is ever returned, but the signal is not sent to the process either.
-		// https://github.com/openssh/openssh-portable/commit/cd98925c6405e972dc9f211afc7e75e838abe81c
-		// - OpenSSH 7.9 or newer required
-		sess.Signal(ssh.SIGKILL)
-		r.Err = herd.TimeoutError{Message: "Timed out while executing command"}
-	case err := <-ec:
-		r.Err = err
+	// Signals are forwarded to the remote process, which gets killed when the
+	// context is canceled. Note that servers only honor signal requests since
+	// OpenSSH 7.9, no error is returned by older servers.
+	// https://github.com/openssh/openssh-portable/commit/cd98925c6405e972dc9f211afc7e75e838abe81c
+	signals := herd.Signals(ctx)
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			logrus.Debugf("Sending %s to command on %s", sig, host.Name)
+			sess.Signal(sshSignal(sig))
+		case <-ctx.Done():
+			sess.Signal(ssh.SIGKILL)
+			r.Err = herd.TimeoutError{Message: "Timed out while executing command"}
+			break wait
+		case err := <-ec:
+			r.Err = err
+			break wait
+		}
 	}
 	if r.Err != nil {
 		if err, ok := r.Err.(*ssh.ExitError); ok {
@@ -103,10 +145,32 @@ func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc
 	return r
 }
 
+func sshSignal(sig os.Signal) ssh.Signal {
+	switch sig {
+	case os.Interrupt:
+		return ssh.SIGINT
+	case os.Kill:
+		return ssh.SIGKILL
+	default:
+		return ssh.SIGTERM
+	}
+}
+
 func (e *Executor) connect(ctx context.Context, host *herd.Host) (*ssh.Client, error) {
 	if host.Connection != nil {
 		return host.Connection.(*ssh.Client), nil
 	}
+	if e.keyStore != nil {
+		keys, err := e.keyStore.Keys(host)
+		if err != nil {
+			logrus.Warnf("Unable to read host key store: %s", err)
+		}
+		for _, k := range keys {
+			if !containsKey(host.PublicKeys(), k) {
+				host.AddPublicKey(k)
+			}
+		}
+	}
 	config := e.config.forHost(host)
 	cc := config.clientConfig
 	cc.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
@@ -122,7 +186,16 @@ func (e *Executor) connect(ctx context.Context, host *herd.Host) (*ssh.Client, e
 		address = host.Name
 	}
 	address = net.JoinHostPort(address, strconv.Itoa(config.port))
-	logrus.Debugf("Connecting to %s (%s) as %s with key %s", host.Name, address, cc.User, config.identityFile)
+	var jump *ssh.Client
+	if config.proxyJump != "" {
+		var err error
+		if jump, err = e.connectJump(ctx, host, config.proxyJump); err != nil {
+			return nil, err
+		}
+		logrus.Debugf("Connecting to %s (%s) via %s as %s with key %s", host.Name, address, config.proxyJump, cc.User, config.identityFile)
+	} else {
+		logrus.Debugf("Connecting to %s (%s) as %s with key %s", host.Name, address, cc.User, config.identityFile)
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, e.connectTimeout+time.Second/2)
 	defer cancel()
@@ -130,27 +203,113 @@ func (e *Executor) connect(ctx context.Context, host *herd.Host) (*ssh.Client, e
 	ec := make(chan error)
 	go func() {
 		var err error
-		client, err = ssh.Dial("tcp", address, cc)
-		ec <- err
+		if jump == nil {
+			client, err = ssh.Dial(config.network(), address, cc)
+			ec <- err
+			return
+		}
+		conn, err := jump.Dial(config.network(), address)
+		if err != nil {
+			ec <- err
+			return
+		}
+		c, chans, reqs, err := ssh.NewClientConn(conn, address, cc)
+		if err != nil {
+			conn.Close()
+			ec <- err
+			return
+		}
+		client = ssh.NewClient(c, chans, reqs)
+		ec <- nil
 	}()
 	select {
 	case <-ctx.Done():
 		return nil, herd.TimeoutError{Message: "Timed out while connecting to server"}
 	case err := <-ec:
-		if err == nil {
-			host.Connection = client
+		if err != nil {
+			return nil, err
+		}
+		host.Connection = client
+		if config.forwardAgent {
+			if err = sshagent.ForwardToAgent(client, e.agent); err != nil {
+				logrus.Warnf("Unable to forward ssh agent to %s: %s", host.Name, err)
+			}
+		}
+		e.setupForwards(host, client, config)
+		return client, nil
+	}
+}
+
+// Jump hosts are specified as [user@]host[:port], multiple jump hosts are
+// separated by commas and are connected to in order. They use the same ssh
+// configuration as any other host, but are not looked up in the inventory.
+func (e *Executor) connectJump(ctx context.Context, host *herd.Host, spec string) (*ssh.Client, error) {
+	jump, err := jumpHostFor(host, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	e.jumpLock.Lock()
+	jh, ok := e.jumpHosts[spec]
+	if !ok {
+		jh = &jumpHost{host: jump}
+		e.jumpHosts[spec] = jh
+	}
+	e.jumpLock.Unlock()
+
+	jh.Lock()
+	defer jh.Unlock()
+	client, err := e.connect(ctx, jh.host)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to jump host %s: %s", jump.Name, err)
+	}
+	return client, nil
+}
+
+// The host to connect to for a ProxyJump spec. For a chain of jump hosts,
+// that is the last one, which is reached through the ones before it.
+func jumpHostFor(host *herd.Host, spec string) (*herd.Host, error) {
+	hops := strings.Split(spec, ",")
+	last := strings.TrimSpace(hops[len(hops)-1])
+	name, attrs := last, herd.HostAttributes{}
+	if idx := strings.LastIndex(name, "@"); idx != -1 {
+		attrs["herd_user"] = name[:idx]
+		name = name[idx+1:]
+	}
+	if h, p, err := net.SplitHostPort(name); err == nil {
+		name = h
+		attrs["herd_port"] = p
+	}
+	if name == "" || name == host.Name {
+		return nil, fmt.Errorf("Invalid jump host %s for %s", last, host.Name)
+	}
+	if len(hops) > 1 {
+		attrs["herd_jump"] = strings.Join(hops[:len(hops)-1], ",")
+	} else {
+		// Don't let a catch-all ProxyJump in the ssh config apply to the
+		// jump host itself
+		attrs["herd_jump"] = "none"
+	}
+	return herd.NewHost(name, "", attrs), nil
+}
+
+// Disconnect from all jump hosts, after all other connections have been closed
+func (e *Executor) End() {
+	e.jumpLock.Lock()
+	defer e.jumpLock.Unlock()
+	for _, jh := range e.jumpHosts {
+		if jh.host.Connection != nil {
+			logrus.Debugf("Disconnecting from jump host %s", jh.host.Name)
+			jh.host.Connection.Close()
+			jh.host.Connection = nil
 		}
-		return client, err
 	}
 }
 
 func (e *Executor) hostKeyCallback(host *herd.Host, key ssh.PublicKey, c *configBlock) error {
 	// Do we have the key?
-	bkey := key.Marshal()
-	for _, pkey := range host.PublicKeys() {
-		if bytes.Equal(bkey, pkey.Marshal()) {
-			return nil
-		}
+	if containsKey(host.PublicKeys(), key) {
+		return nil
 	}
 
 	// We don't have the key, but is it in DNS?
@@ -159,10 +318,35 @@ func (e *Executor) hostKeyCallback(host *herd.Host, key ssh.PublicKey, c *config
 		return nil
 	}
 
+	// A different key of the same type means the key has changed, which we
+	// never accept without the user's consent, unless host key checking is
+	// disabled altogether.
+	if old := keyOfType(host.PublicKeys(), key.Type()); old != nil {
+		if c.strictHostKeyChecking == no {
+			host.AddPublicKey(key)
+			return nil
+		}
+		if e.keyStore != nil {
+			if err := e.keyStore.AddPending(host, old, key); err != nil {
+				logrus.Warnf("Unable to record changed host key for %s: %s", host.Name, err)
+			}
+			return fmt.Errorf("ssh: %s host key for %s has changed from %s to %s, use herd hostkeys accept %s to accept the new key", key.Type(), host.Name, ssh.FingerprintSHA256(old), ssh.FingerprintSHA256(key), host.Name)
+		}
+		return fmt.Errorf("ssh: %s host key for %s has changed from %s to %s", key.Type(), host.Name, ssh.FingerprintSHA256(old), ssh.FingerprintSHA256(key))
+	}
+
+	// Only keys accepted on first use are trusted later on, keys accepted
+	// without checking are not.
 	switch c.strictHostKeyChecking {
 	case acceptNew:
-		logrus.Warnf("ssh: no known host key for %s, accepting new key", host.Name)
-		fallthrough
+		logrus.Warnf("ssh: no known host key for %s, accepting new key %s", host.Name, ssh.FingerprintSHA256(key))
+		host.AddPublicKey(key)
+		if e.keyStore != nil {
+			if err := e.keyStore.Add(host, key); err != nil {
+				logrus.Warnf("Unable to record host key for %s: %s", host.Name, err)
+			}
+		}
+		return nil
 	case no:
 		host.AddPublicKey(key)
 		return nil
@@ -0,0 +1,170 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// A port forward, in the same format as LocalForward and RemoteForward in the
+// openssh config: [bind_address:]port host:hostport
+type forward struct {
+	listen string
+	target string
+}
+
+func parseForward(spec string) (forward, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return forward{}, fmt.Errorf("expected [bind_address:]port host:hostport")
+	}
+	listen := fields[0]
+	if !strings.Contains(listen, ":") {
+		listen = "localhost:" + listen
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return forward{}, err
+	}
+	// Like openssh, * means all addresses
+	if host == "*" {
+		listen = net.JoinHostPort("", port)
+	}
+	if _, _, err := net.SplitHostPort(fields[1]); err != nil {
+		return forward{}, err
+	}
+	return forward{listen: listen, target: fields[1]}, nil
+}
+
+// Set up the forwards for a new connection. They are torn down again when the
+// connection is closed.
+func (e *Executor) setupForwards(host *herd.Host, client *ssh.Client, config *configBlock) {
+	listeners := []net.Listener{}
+	for _, f := range config.localForwards {
+		f := f
+		l, err := net.Listen("tcp", f.listen)
+		if err != nil {
+			logrus.Warnf("Unable to forward %s to %s on %s: %s", f.listen, f.target, host.Name, err)
+			continue
+		}
+		logrus.Debugf("Forwarding %s to %s on %s", f.listen, f.target, host.Name)
+		go serveForward(l, func() (net.Conn, error) { return client.Dial("tcp", f.target) }, host.Name)
+		listeners = append(listeners, l)
+	}
+	for _, f := range config.remoteForwards {
+		f := f
+		l, err := client.Listen("tcp", f.listen)
+		if err != nil {
+			logrus.Warnf("Unable to forward %s on %s to %s: %s", f.listen, host.Name, f.target, err)
+			continue
+		}
+		logrus.Debugf("Forwarding %s on %s to %s", f.listen, host.Name, f.target)
+		go serveForward(l, func() (net.Conn, error) { return net.Dial("tcp", f.target) }, host.Name)
+		listeners = append(listeners, l)
+	}
+	if len(listeners) > 0 {
+		go func() {
+			client.Wait()
+			for _, l := range listeners {
+				l.Close()
+			}
+		}()
+	}
+}
+
+func serveForward(l net.Listener, dial func() (net.Conn, error), name string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			target, err := dial()
+			if err != nil {
+				logrus.Warnf("Unable to forward connection via %s: %s", name, err)
+				conn.Close()
+				return
+			}
+			pipe(conn, target)
+		}()
+	}
+}
+
+func pipe(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+}
+
+// The tunnel executor does not run commands, but opens a local port for every
+// host that is forwarded to a port on that host, or to an address reachable
+// from it. The local address is stored in the herd_tunnel attribute.
+type TunnelExecutor struct {
+	executor  *Executor
+	target    string
+	lock      sync.Mutex
+	listeners []net.Listener
+}
+
+// The target is either a port, or a host:port combination
+func NewTunnelExecutor(executor *Executor, target string) *TunnelExecutor {
+	if !strings.Contains(target, ":") {
+		target = "localhost:" + target
+	}
+	return &TunnelExecutor{executor: executor, target: target}
+}
+
+func (e *TunnelExecutor) SetConnectTimeout(t time.Duration) {
+	e.executor.SetConnectTimeout(t)
+}
+
+func (e *TunnelExecutor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
+	defer func() {
+		r.EndTime = time.Now()
+		r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	}()
+
+	client, err := e.executor.connect(ctx, host)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	e.lock.Lock()
+	e.listeners = append(e.listeners, l)
+	e.lock.Unlock()
+	logrus.Debugf("Forwarding %s to %s on %s", l.Addr(), e.target, host.Name)
+	go serveForward(l, func() (net.Conn, error) { return client.Dial("tcp", e.target) }, host.Name)
+	host.Attributes["herd_tunnel"] = l.Addr().String()
+	r.ExitStatus = 0
+	return r
+}
+
+func (e *TunnelExecutor) End() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, l := range e.listeners {
+		l.Close()
+	}
+	e.executor.End()
+}
+
+var _ herd.Executor = &TunnelExecutor{}
@@ -0,0 +1,396 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/user"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
+)
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec   string
+		listen string
+		target string
+		err    bool
+	}{
+		{"8080 localhost:80", "localhost:8080", "localhost:80", false},
+		{"*:8080 web.example.com:80", ":8080", "web.example.com:80", false},
+		{"[::1]:8080 [2001:db8::1]:80", "[::1]:8080", "[2001:db8::1]:80", false},
+		{"8080", "", "", true},
+		{"8080 localhost", "", "", true},
+		{"8080 localhost:80 extra", "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			f, err := parseForward(test.spec)
+			if test.err {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if f.listen != test.listen || f.target != test.target {
+				t.Errorf("Expected %s -> %s, got %s -> %s", test.listen, test.target, f.listen, f.target)
+			}
+		})
+	}
+}
+
+// A minimal ssh server that supports what forwarding needs: exec sessions,
+// agent forwarding and local and remote port forwards.
+type testServer struct {
+	port string
+	key  ssh.PublicKey
+}
+
+type tcpipPayload struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConnection(conn, config)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return &testServer{port: port, key: signer.PublicKey()}
+}
+
+func serveTestConnection(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go handleTestForwards(sconn, reqs)
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "session":
+			go handleTestSession(sconn, nc)
+		case "direct-tcpip":
+			go handleTestDial(nc)
+		default:
+			nc.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// Remote forwards: listen on the server, and send connections to the client
+func handleTestForwards(sconn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		var p struct {
+			Host string
+			Port uint32
+		}
+		if req.Type != "tcpip-forward" || ssh.Unmarshal(req.Payload, &p) != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go func() {
+			sconn.Wait()
+			l.Close()
+		}()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(&tcpipPayload{p.Host, p.Port, "127.0.0.1", 1}))
+				if err != nil {
+					conn.Close()
+					continue
+				}
+				go ssh.DiscardRequests(reqs)
+				go func() {
+					io.Copy(conn, ch)
+					conn.Close()
+					ch.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// Local forwards: connect to the target from the server
+func handleTestDial(nc ssh.NewChannel) {
+	var p tcpipPayload
+	if err := ssh.Unmarshal(nc.ExtraData(), &p); err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))))
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	io.Copy(ch, target)
+	target.Close()
+	ch.Close()
+}
+
+// The only command is agent-keys, which shows how many keys a forwarded agent
+// has
+func handleTestSession(sconn *ssh.ServerConn, nc ssh.NewChannel) {
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	agentForwarded := false
+	for req := range reqs {
+		switch req.Type {
+		case "auth-agent-req@openssh.com":
+			agentForwarded = true
+			req.Reply(true, nil)
+		case "exec":
+			req.Reply(true, nil)
+			output := "no agent"
+			if agentForwarded {
+				output = testAgentKeys(sconn)
+			}
+			fmt.Fprintln(ch, output)
+			ch.SendRequest("exit-status", false, ssh.Marshal(&struct{ Status uint32 }{0}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func testAgentKeys(sconn *ssh.ServerConn) string {
+	ch, reqs, err := sconn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return err.Error()
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+	keys, err := sshagent.NewClient(ch).List()
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%d keys", len(keys))
+}
+
+// An executor with an in-memory agent, and no ssh config
+func newTestExecutor(t *testing.T) *Executor {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := sshagent.NewKeyring()
+	if err := keyring.Add(sshagent.AddedKey{PrivateKey: priv, Comment: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	a := &agent{sshAgent: keyring.(sshagent.ExtendedAgent)}
+	if a.signers, err = a.Signers(); err != nil {
+		t.Fatal(err)
+	}
+	return &Executor{
+		agent:          a,
+		config:         newConfig(user.User{Username: "test", HomeDir: t.TempDir()}),
+		connectTimeout: 3 * time.Second,
+		jumpHosts:      make(map[string]*jumpHost),
+	}
+}
+
+func (s *testServer) host(attrs herd.HostAttributes) *herd.Host {
+	attrs["herd_port"] = s.port
+	h := herd.NewHost("test-host", "127.0.0.1", attrs)
+	h.AddPublicKey(s.key)
+	return h
+}
+
+// A service that greets whoever connects to it
+func greeter(t *testing.T, greeting string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greeting))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func greeting(addr string) string {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return err.Error()
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	data, _ := ioutil.ReadAll(conn)
+	return string(data)
+}
+
+func unusedAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestSetupForwards(t *testing.T) {
+	s := newTestServer(t)
+	e := newTestExecutor(t)
+	one, two := greeter(t, "one"), greeter(t, "two")
+	local1, local2, remote1, remote2 := unusedAddress(t), unusedAddress(t), unusedAddress(t), unusedAddress(t)
+	host := s.host(herd.HostAttributes{
+		"herd_local_forward":  []string{local1 + " " + one, local2 + " " + two},
+		"herd_remote_forward": []interface{}{remote1 + " " + one, remote2 + " " + two},
+	})
+	e.SetForwards(true)
+	if _, err := e.connect(context.Background(), host); err != nil {
+		t.Fatalf("Unable to connect: %s", err)
+	}
+	defer host.Connection.Close()
+	for addr, expected := range map[string]string{local1: "one", local2: "two", remote1: "one", remote2: "two"} {
+		if g := greeting(addr); g != expected {
+			t.Errorf("%s should be forwarded to %s, got %s", addr, expected, g)
+		}
+	}
+}
+
+func TestConfigForwards(t *testing.T) {
+	s := newTestServer(t)
+	one := greeter(t, "one")
+	local := unusedAddress(t)
+	b := newConfigBlock([]string{"*"})
+	b.forwardAgent = true
+	b.localForwards = []forward{{listen: local, target: one}}
+
+	// Forwards from the ssh config are ignored unless asked for
+	e := newTestExecutor(t)
+	e.config.blocks = []*configBlock{b}
+	host := s.host(herd.HostAttributes{})
+	r := e.Run(context.Background(), host, "agent-keys", nil)
+	if r.Err != nil || string(r.Stdout) != "no agent\n" {
+		t.Errorf("Agent should not be forwarded: %v %q", r.Err, r.Stdout)
+	}
+	if g := greeting(local); g == "one" {
+		t.Errorf("Port should not be forwarded")
+	}
+	host.Connection.Close()
+
+	e = newTestExecutor(t)
+	e.config.blocks = []*configBlock{b}
+	e.SetForwards(true)
+	host = s.host(herd.HostAttributes{})
+	r = e.Run(context.Background(), host, "agent-keys", nil)
+	if r.Err != nil || string(r.Stdout) != "1 keys\n" {
+		t.Errorf("Agent was not forwarded: %v %q", r.Err, r.Stdout)
+	}
+	if g := greeting(local); g != "one" {
+		t.Errorf("Port was not forwarded: %s", g)
+	}
+	host.Connection.Close()
+}
+
+func TestAgentForwarding(t *testing.T) {
+	s := newTestServer(t)
+
+	// Inventories can't turn on forwarding by themselves
+	e := newTestExecutor(t)
+	host := s.host(herd.HostAttributes{"herd_forward_agent": true})
+	r := e.Run(context.Background(), host, "agent-keys", nil)
+	if r.Err != nil || string(r.Stdout) != "no agent\n" {
+		t.Errorf("Agent should not be forwarded: %v %q", r.Err, r.Stdout)
+	}
+	host.Connection.Close()
+
+	e = newTestExecutor(t)
+	e.SetForwards(true)
+	host = s.host(herd.HostAttributes{"herd_forward_agent": true})
+	r = e.Run(context.Background(), host, "agent-keys", nil)
+	if r.Err != nil || string(r.Stdout) != "1 keys\n" {
+		t.Errorf("Agent was not forwarded: %v %q", r.Err, r.Stdout)
+	}
+	host.Connection.Close()
+}
+
+func TestTunnelExecutor(t *testing.T) {
+	s := newTestServer(t)
+	one := greeter(t, "one")
+	e := NewTunnelExecutor(newTestExecutor(t), one)
+	host := s.host(herd.HostAttributes{})
+	if r := e.Run(context.Background(), host, "", nil); r.Err != nil || r.ExitStatus != 0 {
+		t.Fatalf("Unable to open tunnel: %v", r.Err)
+	}
+	defer host.Connection.Close()
+	tunnel, ok := host.Attributes["herd_tunnel"].(string)
+	if !ok {
+		t.Fatalf("No tunnel address set: %v", host.Attributes)
+	}
+	if g := greeting(tunnel); g != "one" {
+		t.Errorf("Tunnel does not reach its target: %s", g)
+	}
+	e.End()
+	if g := greeting(tunnel); g == "one" {
+		t.Errorf("Tunnel was not closed")
+	}
+}
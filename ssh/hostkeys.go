@@ -0,0 +1,224 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/cast"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	KeyMismatch = "mismatch"
+	KeyMissing  = "missing"
+	KeyStale    = "stale"
+)
+
+// A difference between the keys a host presents and the keys providers and
+// known_hosts files claim it has
+type HostKeyProblem struct {
+	Kind    string
+	Claimed ssh.PublicKey
+	Scanned ssh.PublicKey
+}
+
+func (p HostKeyProblem) String() string {
+	switch p.Kind {
+	case KeyMismatch:
+		return fmt.Sprintf("%s key mismatch, expected %s, got %s", p.Scanned.Type(), ssh.FingerprintSHA256(p.Claimed), ssh.FingerprintSHA256(p.Scanned))
+	case KeyMissing:
+		return fmt.Sprintf("%s key %s is not known", p.Scanned.Type(), ssh.FingerprintSHA256(p.Scanned))
+	default:
+		return fmt.Sprintf("%s key %s is no longer used", p.Claimed.Type(), ssh.FingerprintSHA256(p.Claimed))
+	}
+}
+
+// Compare claimed and scanned keys. Claimed keys are only considered stale
+// if their type was scanned for.
+func VerifyHostKeys(claimed, scanned []ssh.PublicKey, keyTypes []string) []HostKeyProblem {
+	problems := []HostKeyProblem{}
+	for _, s := range scanned {
+		if containsKey(claimed, s) {
+			continue
+		}
+		if c := keyOfType(claimed, s.Type()); c != nil {
+			problems = append(problems, HostKeyProblem{Kind: KeyMismatch, Claimed: c, Scanned: s})
+		} else {
+			problems = append(problems, HostKeyProblem{Kind: KeyMissing, Scanned: s})
+		}
+	}
+	scannedTypes := strings.Split(strings.Join(keyTypes, ","), ",")
+	for _, c := range claimed {
+		if containsKey(scanned, c) || keyOfType(scanned, c.Type()) != nil {
+			continue
+		}
+		for _, t := range scannedTypes {
+			if t == c.Type() {
+				problems = append(problems, HostKeyProblem{Kind: KeyStale, Claimed: c})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func keyOfType(keys []ssh.PublicKey, keyType string) ssh.PublicKey {
+	for _, k := range keys {
+		if k.Type() == keyType {
+			return k
+		}
+	}
+	return nil
+}
+
+// All names a host can be found by in a known_hosts file
+func knownHostsNames(host *herd.Host) []string {
+	names := host.Names()
+	if host.Address != "" {
+		names = append(names, host.Address)
+	}
+	if port, err := cast.ToIntE(host.Attributes["herd_port"]); err == nil && port > 0 && port != 22 {
+		for i, n := range names {
+			names[i] = net.JoinHostPort(n, strconv.Itoa(port))
+		}
+	}
+	for i, n := range names {
+		names[i] = knownhosts.Normalize(n)
+	}
+	return names
+}
+
+// Lines for a known_hosts file. Hashed lines contain a single name each, just
+// like the ones ssh-keygen -H produces.
+func KnownHostsLines(host *herd.Host, keys []ssh.PublicKey, hash bool) []string {
+	names := knownHostsNames(host)
+	lines := []string{}
+	for _, key := range keys {
+		if !hash {
+			lines = append(lines, knownhosts.Line(names, key))
+			continue
+		}
+		for _, n := range names {
+			lines = append(lines, knownhosts.Line([]string{knownhosts.HashHostname(n)}, key))
+		}
+	}
+	return lines
+}
+
+// Rewrite a known_hosts file, replacing all entries for the given hosts and
+// keeping everything else, including comments and markers.
+func UpdateKnownHosts(file string, hosts herd.Hosts, keys func(*herd.Host) []ssh.PublicKey, hash bool) error {
+	names := []string{}
+	lines := []string{}
+	for _, host := range hosts {
+		names = append(names, knownHostsNames(host)...)
+		lines = append(lines, KnownHostsLines(host, keys(host), hash)...)
+	}
+	return rewriteKnownHosts(file, func(e knownHostsEntry) bool { return e.matches(names) }, lines)
+}
+
+// Rewrite a known_hosts file, dropping the entries for which drop returns true
+// and adding new lines at the end. Lines with markers, comments and lines we
+// can't parse are always kept.
+func rewriteKnownHosts(file string, drop func(knownHostsEntry) bool, add []string) error {
+	var out bytes.Buffer
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		marker, patterns, key, comment, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil || marker != "" || !drop(knownHostsEntry{patterns: patterns, key: key, comment: comment}) {
+			out.WriteString(line)
+			out.WriteString("\n")
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	for _, line := range add {
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+
+	dir := filepath.Dir(file)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(out.Bytes()); err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+func matchHashed(pattern, name string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// SSHFP records for a host, with both SHA-1 and SHA-256 fingerprints, in the
+// same format as ssh-keygen -r
+func SSHFPRecords(host *herd.Host, keys []ssh.PublicKey) []string {
+	records := []string{}
+	for _, key := range keys {
+		algo, ok := sshfpAlgorithms[key.Type()]
+		if !ok {
+			continue
+		}
+		blob := key.Marshal()
+		records = append(records,
+			fmt.Sprintf("%s. IN SSHFP %d 1 %x", strings.TrimSuffix(host.Name, "."), algo, sha1.Sum(blob)),
+			fmt.Sprintf("%s. IN SSHFP %d 2 %x", strings.TrimSuffix(host.Name, "."), algo, sha256.Sum256(blob)))
+	}
+	return records
+}
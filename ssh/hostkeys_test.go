@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/go-test/deep"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func ed25519Key(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func rsaKey(t *testing.T) ssh.PublicKey {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyHostKeys(t *testing.T) {
+	ed1, ed2, rsa1 := ed25519Key(t), ed25519Key(t), rsaKey(t)
+	testcases := []struct {
+		name     string
+		claimed  []ssh.PublicKey
+		scanned  []ssh.PublicKey
+		keyTypes []string
+		problems []string
+	}{
+		{"ok", []ssh.PublicKey{ed1, rsa1}, []ssh.PublicKey{ed1, rsa1}, []string{"ssh-ed25519", "ssh-rsa"}, []string{}},
+		{"mismatch", []ssh.PublicKey{ed1, rsa1}, []ssh.PublicKey{ed2, rsa1}, []string{"ssh-ed25519", "ssh-rsa"}, []string{KeyMismatch}},
+		{"missing", []ssh.PublicKey{rsa1}, []ssh.PublicKey{ed1, rsa1}, []string{"ssh-ed25519", "ssh-rsa"}, []string{KeyMissing}},
+		{"stale", []ssh.PublicKey{ed1, rsa1}, []ssh.PublicKey{ed1}, []string{"ssh-ed25519", "ssh-rsa"}, []string{KeyStale}},
+		{"not scanned", []ssh.PublicKey{ed1, rsa1}, []ssh.PublicKey{ed1}, []string{"ssh-ed25519"}, []string{}},
+	}
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			problems := []string{}
+			for _, p := range VerifyHostKeys(test.claimed, test.scanned, test.keyTypes) {
+				problems = append(problems, p.Kind)
+			}
+			if diff := deep.Equal(problems, test.problems); diff != nil {
+				t.Errorf("Unexpected problems: %v", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateKnownHosts(t *testing.T) {
+	oldKey, newKey, otherKey := ed25519Key(t), ed25519Key(t), ed25519Key(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	existing := []string{
+		"# managed by herd",
+		knownhosts.Line([]string{"web-1.example.com", "10.0.0.1"}, oldKey),
+		knownhosts.Line([]string{knownhosts.HashHostname("web-1.example.com")}, oldKey),
+		knownhosts.Line([]string{"[web-2.example.com]:2222"}, oldKey),
+		knownhosts.Line([]string{"db-1.example.com"}, otherKey),
+		"@revoked web-1.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(oldKey))),
+	}
+	if err := ioutil.WriteFile(file, []byte(strings.Join(existing, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := herd.Hosts{
+		herd.NewHost("web-1.example.com", "10.0.0.1", nil),
+		herd.NewHost("web-2.example.com", "", herd.HostAttributes{"herd_port": 2222}),
+	}
+	keys := func(*herd.Host) []ssh.PublicKey { return []ssh.PublicKey{newKey} }
+	if err := UpdateKnownHosts(file, hosts, keys, false); err != nil {
+		t.Fatalf("Unable to update known_hosts: %s", err)
+	}
+	data, _ := ioutil.ReadFile(file)
+	expected := []string{
+		existing[0], existing[4], existing[5],
+		knownhosts.Line([]string{"web-1.example.com", "10.0.0.1"}, newKey),
+		knownhosts.Line([]string{"[web-2.example.com]:2222"}, newKey),
+	}
+	if diff := deep.Equal(strings.Split(strings.TrimSpace(string(data)), "\n"), expected); diff != nil {
+		t.Errorf("Unexpected known_hosts file: %v", diff)
+	}
+
+	if err := UpdateKnownHosts(file, hosts[:1], keys, true); err != nil {
+		t.Fatalf("Unable to update known_hosts: %s", err)
+	}
+	data, _ = ioutil.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[4], "|1|") || !matchHashed(strings.Fields(lines[4])[0], "web-1.example.com") || !matchHashed(strings.Fields(lines[5])[0], "10.0.0.1") {
+		t.Errorf("Unexpected hashed known_hosts file: %v", lines)
+	}
+}
+
+func TestSSHFPRecords(t *testing.T) {
+	key := ed25519Key(t)
+	records := SSHFPRecords(herd.NewHost("web-1.example.com", "", nil), []ssh.PublicKey{key})
+	if len(records) != 2 || !strings.HasPrefix(records[0], "web-1.example.com. IN SSHFP 4 1 ") || !strings.HasPrefix(records[1], "web-1.example.com. IN SSHFP 4 2 ") {
+		t.Errorf("Unexpected records: %v", records)
+	}
+}
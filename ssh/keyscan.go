@@ -7,6 +7,7 @@ import (
 	"os/user"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/seveas/herd"
@@ -18,9 +19,12 @@ type KeyScanExecutor struct {
 	keyTypes       []string
 	config         *config
 	connectTimeout time.Duration
+	verify         bool
+	scanned        map[*herd.Host][]ssh.PublicKey
+	lock           sync.Mutex
 }
 
-func NewKeyScanExecutor(keyTypes []string, user user.User) (herd.Executor, error) {
+func NewKeyScanExecutor(keyTypes []string, user user.User) (*KeyScanExecutor, error) {
 	config := newConfig(user)
 	if err := config.readOpenSSHConfig(); err != nil {
 		return nil, err
@@ -28,9 +32,33 @@ func NewKeyScanExecutor(keyTypes []string, user user.User) (herd.Executor, error
 	return &KeyScanExecutor{
 		keyTypes: keyTypes,
 		config:   config,
+		scanned:  make(map[*herd.Host][]ssh.PublicKey),
 	}, nil
 }
 
+// When verifying, all key types are scanned, even when we already know a key
+// of that type for a host. Scanned keys are not added to the host, so they
+// can be compared with the keys we know using ScannedKeys.
+func (e *KeyScanExecutor) EnableVerification() {
+	e.verify = true
+}
+
+func (e *KeyScanExecutor) ScannedKeys(host *herd.Host) []ssh.PublicKey {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.scanned[host]
+}
+
+func (e *KeyScanExecutor) addKey(host *herd.Host, key ssh.PublicKey) {
+	if !e.verify {
+		host.AddPublicKey(key)
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.scanned[host] = append(e.scanned[host], key)
+}
+
 func (e *KeyScanExecutor) SetConnectTimeout(t time.Duration) {
 	e.connectTimeout = t
 }
@@ -45,7 +73,7 @@ func (e *KeyScanExecutor) Run(ctx context.Context, host *herd.Host, cmd string,
 	config.strictHostKeyChecking = no
 	cc := config.clientConfig
 	cc.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		host.AddPublicKey(key)
+		e.addKey(host, key)
 		return hostKeyReceived
 	}
 	address = net.JoinHostPort(address, strconv.Itoa(config.port))
@@ -61,10 +89,10 @@ func (e *KeyScanExecutor) Run(ctx context.Context, host *herd.Host, cmd string,
 					break
 				}
 			}
-			if !found {
+			if !found || e.verify {
 				logrus.Debugf("Don't have an %s key for %s, checking whether the host has it", keyType, host.Name)
 				cc.HostKeyAlgorithms = strings.Split(keyType, ",")
-				_, err := ssh.Dial("tcp", address, cc)
+				_, err := ssh.Dial(config.network(), address, cc)
 				if err != nil && !strings.HasSuffix(err.Error(), "host key received") {
 					logrus.Debugf("Error checking %s key on %s: %s", keyType, host.Name, err)
 				}
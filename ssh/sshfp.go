@@ -55,6 +55,15 @@ func verifyHostKeyDns(hostname string, key ssh.PublicKey) bool {
 	if sshfpResolver == nil {
 		return false
 	}
+	rrset, err := sshfpResolver.resolve(hostname+".", dns.TypeSSHFP)
+	if err != nil {
+		return false
+	}
+	return sshfpMatches(rrset, key)
+}
+
+// Whether any of the SSHFP records is a SHA1 or SHA256 fingerprint of the key
+func sshfpMatches(rrset []dns.RR, key ssh.PublicKey) bool {
 	algo, ok := sshfpAlgorithms[key.Type()]
 	if !ok {
 		return false
@@ -63,17 +72,13 @@ func verifyHostKeyDns(hostname string, key ssh.PublicKey) bool {
 	sha1sum := fmt.Sprintf("%x", sha1.Sum(blob))
 	sha256sum := fmt.Sprintf("%x", sha256.Sum256(blob))
 
-	rrset, err := sshfpResolver.resolve(hostname+".", dns.TypeSSHFP)
-	if err != nil {
-		return false
-	}
 	for _, rr := range rrset {
 		if srr, ok := rr.(*dns.SSHFP); ok {
 			if srr.Algorithm == algo {
 				if srr.Type == dns.SHA1 && srr.FingerPrint == sha1sum {
 					return true
 				}
-				if srr.Type == dns.SHA1 && srr.FingerPrint == sha256sum {
+				if srr.Type == dns.SHA256 && srr.FingerPrint == sha256sum {
 					return true
 				}
 			}
@@ -0,0 +1,29 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHFPMatches(t *testing.T) {
+	key, other := ed25519Key(t), ed25519Key(t)
+	records := SSHFPRecords(herd.NewHost("web-1.example.com", "", nil), []ssh.PublicKey{key})
+	for i, name := range []string{"sha1", "sha256"} {
+		t.Run(name, func(t *testing.T) {
+			rr, err := dns.NewRR(records[i])
+			if err != nil {
+				t.Fatalf("Unable to parse %s: %s", records[i], err)
+			}
+			if !sshfpMatches([]dns.RR{rr}, key) {
+				t.Errorf("Key does not match %s", records[i])
+			}
+			if sshfpMatches([]dns.RR{rr}, other) {
+				t.Errorf("Other key matches %s", records[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Keys we accept on first use are recorded in a known_hosts file in herd's
+// data directory, so we notice when they change. Changed keys are never
+// accepted automatically, they are recorded as pending changes that can be
+// reviewed and accepted with herd hostkeys accept. This file is separate from
+// the known_hosts file herd hostkeys update writes, which is a host source,
+// not a record of what we trust.
+type KeyStore struct {
+	path    string
+	pending string
+	lock    sync.Mutex
+	loaded  bool
+	entries []knownHostsEntry
+}
+
+type knownHostsEntry struct {
+	patterns []string
+	key      ssh.PublicKey
+	comment  string
+}
+
+// A key that was presented by a host, but differs from the key we know for it
+type KeyChange struct {
+	Names []string
+	Old   string
+	New   ssh.PublicKey
+}
+
+func (c KeyChange) String() string {
+	return fmt.Sprintf("%s key changed from %s to %s", c.New.Type(), c.Old, ssh.FingerprintSHA256(c.New))
+}
+
+func NewKeyStore(dataDir string) *KeyStore {
+	return &KeyStore{
+		path:    filepath.Join(dataDir, "known_hosts.tofu"),
+		pending: filepath.Join(dataDir, "known_hosts.tofu.pending"),
+	}
+}
+
+func (s *KeyStore) Path() string {
+	return s.path
+}
+
+func readKnownHosts(path string) ([]knownHostsEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := []knownHostsEntry{}
+	for {
+		marker, patterns, key, comment, rest, err := ssh.ParseKnownHosts(data)
+		if err == io.EOF {
+			break
+		}
+		data = rest
+		if err != nil || marker != "" {
+			continue
+		}
+		entries = append(entries, knownHostsEntry{patterns: patterns, key: key, comment: comment})
+	}
+	return entries, nil
+}
+
+func (e knownHostsEntry) matches(names []string) bool {
+	for _, p := range e.patterns {
+		for _, n := range names {
+			if p == n || (strings.HasPrefix(p, "|1|") && matchHashed(p, n)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *KeyStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	entries, err := readKnownHosts(s.path)
+	if err != nil {
+		return err
+	}
+	s.entries = entries
+	s.loaded = true
+	return nil
+}
+
+// All keys we have accepted for a host
+func (s *KeyStore) Keys(host *herd.Host) ([]ssh.PublicKey, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	names := knownHostsNames(host)
+	keys := []ssh.PublicKey{}
+	for _, e := range s.entries {
+		if e.matches(names) && !containsKey(keys, e.key) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *KeyStore) Add(host *herd.Host, key ssh.PublicKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	names := knownHostsNames(host)
+	s.entries = append(s.entries, knownHostsEntry{patterns: names, key: key})
+	return appendLines(s.path, KnownHostsLines(host, []ssh.PublicKey{key}, false))
+}
+
+// Record a changed key, unless we already know about the change
+func (s *KeyStore) AddPending(host *herd.Host, old, new ssh.PublicKey) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entries, err := readKnownHosts(s.pending)
+	if err != nil {
+		return err
+	}
+	names := knownHostsNames(host)
+	for _, e := range entries {
+		if e.matches(names) && bytes.Equal(e.key.Marshal(), new.Marshal()) {
+			return nil
+		}
+	}
+	line := knownhosts.Line(names, new) + " " + ssh.FingerprintSHA256(old)
+	return appendLines(s.pending, []string{line})
+}
+
+func (s *KeyStore) Pending() ([]KeyChange, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entries, err := readKnownHosts(s.pending)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]KeyChange, len(entries))
+	for i, e := range entries {
+		changes[i] = KeyChange{Names: e.patterns, Old: e.comment, New: e.key}
+	}
+	return changes, nil
+}
+
+// Accept pending changes: keys of the same type for the same host are
+// replaced by the new key and the change is no longer pending
+func (s *KeyStore) Accept(changes []KeyChange) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = knownhosts.Line(c.Names, c.New)
+	}
+	replaced := func(e knownHostsEntry) bool {
+		for _, c := range changes {
+			if e.key.Type() == c.New.Type() && e.matches(c.Names) {
+				return true
+			}
+		}
+		return false
+	}
+	if err := rewriteKnownHosts(s.path, replaced, lines); err != nil {
+		return err
+	}
+	s.loaded = false
+	accepted := func(e knownHostsEntry) bool {
+		for _, c := range changes {
+			if bytes.Equal(e.key.Marshal(), c.New.Marshal()) && e.matches(c.Names) {
+				return true
+			}
+		}
+		return false
+	}
+	return rewriteKnownHosts(s.pending, accepted, nil)
+}
+
+func appendLines(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
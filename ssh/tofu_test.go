@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seveas/herd"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	e := &Executor{keyStore: NewKeyStore(dir)}
+	config := newConfigBlock(nil)
+	oldKey, newKey, rsa1 := ed25519Key(t), ed25519Key(t), rsaKey(t)
+
+	// First use: the key is accepted and recorded
+	host := herd.NewHost("web-1.example.com", "10.0.0.1", nil)
+	if err := e.hostKeyCallback(host, oldKey, config); err != nil {
+		t.Fatalf("New key was not accepted: %s", err)
+	}
+	if err := e.hostKeyCallback(host, rsa1, config); err != nil {
+		t.Fatalf("New key was not accepted: %s", err)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "known_hosts.tofu"))
+	if !strings.HasPrefix(string(data), "web-1.example.com,10.0.0.1 ssh-ed25519 ") {
+		t.Errorf("Key was not recorded: %s", data)
+	}
+
+	// Next run: the recorded keys are known, a changed key is refused
+	host = herd.NewHost("web-1.example.com", "10.0.0.1", nil)
+	keys, err := e.keyStore.Keys(host)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Unexpected keys in the store: %v %v", keys, err)
+	}
+	for _, k := range keys {
+		host.AddPublicKey(k)
+	}
+	err = e.hostKeyCallback(host, newKey, config)
+	if err == nil || !strings.Contains(err.Error(), "has changed from "+ssh.FingerprintSHA256(oldKey)+" to "+ssh.FingerprintSHA256(newKey)) {
+		t.Fatalf("Changed key was not refused: %v", err)
+	}
+	// Recording the same change twice only records it once
+	e.hostKeyCallback(host, newKey, config)
+	changes, err := e.keyStore.Pending()
+	if err != nil || len(changes) != 1 || changes[0].Old != ssh.FingerprintSHA256(oldKey) {
+		t.Fatalf("Change was not recorded correctly: %v %v", changes, err)
+	}
+
+	// Accepting the change replaces the old key, but keeps the others
+	if err = e.keyStore.Accept(changes); err != nil {
+		t.Fatalf("Unable to accept changes: %s", err)
+	}
+	keys, _ = e.keyStore.Keys(host)
+	if len(keys) != 2 || !containsKey(keys, newKey) || !containsKey(keys, rsa1) || containsKey(keys, oldKey) {
+		t.Errorf("Change was not accepted correctly: %v", keys)
+	}
+	if changes, _ = e.keyStore.Pending(); len(changes) != 0 {
+		t.Errorf("Accepted changes are still pending: %v", changes)
+	}
+}
+
+func TestKeyStoreNoChecking(t *testing.T) {
+	dir := t.TempDir()
+	e := &Executor{keyStore: NewKeyStore(dir)}
+	config := newConfigBlock(nil)
+	config.strictHostKeyChecking = no
+	key := ed25519Key(t)
+
+	// Unverified keys are accepted, but not trusted by later runs
+	host := herd.NewHost("web-1.example.com", "10.0.0.1", nil)
+	if err := e.hostKeyCallback(host, key, config); err != nil {
+		t.Fatalf("Key was not accepted: %s", err)
+	}
+	if !containsKey(host.PublicKeys(), key) {
+		t.Errorf("Key was not added to the host")
+	}
+	if keys, err := e.keyStore.Keys(host); err != nil || len(keys) != 0 {
+		t.Errorf("Unverified key was recorded: %v %v", keys, err)
+	}
+}
@@ -32,13 +32,15 @@ const (
 	OutputPerhost
 	OutputInline
 	OutputAll
+	OutputDashboard
 )
 
 var outputModeString map[OutputMode]string = map[OutputMode]string{
-	OutputTail:    "tail",
-	OutputPerhost: "per-host",
-	OutputInline:  "inline",
-	OutputAll:     "all",
+	OutputTail:      "tail",
+	OutputPerhost:   "per-host",
+	OutputInline:    "inline",
+	OutputAll:       "all",
+	OutputDashboard: "dashboard",
 }
 
 type SettingsFunc func() (string, map[string]interface{})
@@ -80,6 +82,7 @@ type SimpleUI struct {
 	pchan           chan string
 	formatter       formatter
 	outputMode      OutputMode
+	runMode         OutputMode
 	outputTimestamp bool
 	pagerEnabled    bool
 	width           int
@@ -92,6 +95,8 @@ type SimpleUI struct {
 	loadOnce        sync.Once
 	loadLock        sync.Mutex
 	loadTicker      *time.Ticker
+	dashboard       *dashboard
+	dashboardLock   sync.Mutex
 }
 
 var templateFuncs = template.FuncMap{
@@ -122,6 +127,7 @@ func NewSimpleUI() *SimpleUI {
 	ui := &SimpleUI{
 		output:       os.Stdout,
 		outputMode:   OutputAll,
+		runMode:      OutputAll,
 		atStart:      true,
 		lastProgress: "",
 		pchan:        make(chan string),
@@ -158,6 +164,7 @@ func (ui *SimpleUI) getSize() {
 
 func (ui *SimpleUI) SetOutputMode(o OutputMode) {
 	ui.outputMode = o
+	ui.runMode = o
 }
 
 func (ui *SimpleUI) SetOutputTimestamp(e bool) {
@@ -202,13 +209,26 @@ func (ui *SimpleUI) BindLogrus() {
 func (ui *SimpleUI) Write(msg []byte) (int, error) {
 	ui.lineBuf += string(msg)
 	if strings.HasSuffix(ui.lineBuf, "\n") {
-		ui.pchan <- ui.lineBuf
+		if d := ui.activeDashboard(); d != nil {
+			d.log(ui.lineBuf)
+		} else {
+			ui.pchan <- ui.lineBuf
+		}
 		ui.lineBuf = ""
 	}
 	return len(msg), nil
 }
 
+func (ui *SimpleUI) activeDashboard() *dashboard {
+	ui.dashboardLock.Lock()
+	defer ui.dashboardLock.Unlock()
+	return ui.dashboard
+}
+
 func (ui *SimpleUI) Sync() {
+	if d := ui.activeDashboard(); d != nil {
+		<-d.done
+	}
 	ui.syncCond.L.Lock()
 	ui.pchan <- "\000"
 	defer ui.syncCond.L.Unlock()
@@ -221,7 +241,8 @@ func (ui *SimpleUI) End() {
 }
 
 func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
-	if ui.outputMode != OutputAll && ui.outputMode != OutputInline {
+	mode := ui.runMode
+	if mode != OutputAll && mode != OutputInline && mode != OutputDashboard {
 		return
 	}
 	usePager := ui.pagerEnabled
@@ -239,7 +260,7 @@ func (ui *SimpleUI) PrintHistoryItem(hi *HistoryItem) {
 		if !ok {
 			continue
 		}
-		if ui.outputMode == OutputAll {
+		if mode == OutputAll {
 			txt = ui.formatter.formatResult(result, hlen)
 		} else {
 			txt = ui.formatter.formatOutput(result, hlen)
@@ -492,6 +513,10 @@ func (ui *SimpleUI) LoadingMessage(what string, done bool, err error) {
 }
 
 func (ui *SimpleUI) OutputChannel(r *Runner) chan OutputLine {
+	ui.runMode = ui.outputMode
+	if ui.outputMode == OutputDashboard {
+		return ui.dashboardOutputChannel(r)
+	}
 	if ui.outputMode != OutputTail {
 		return nil
 	}
@@ -536,6 +561,17 @@ func (ui *SimpleUI) OutputChannel(r *Runner) chan OutputLine {
 }
 
 func (ui *SimpleUI) ProgressChannel(r *Runner) chan ProgressMessage {
+	if d := ui.activeDashboard(); d != nil {
+		pc := make(chan ProgressMessage)
+		go func() {
+			for msg := range pc {
+				d.progress(msg)
+			}
+			d.end()
+		}()
+		return pc
+	}
+	mode := ui.runMode
 	pc := make(chan ProgressMessage)
 	go func() {
 		start := time.Now()
@@ -577,9 +613,9 @@ func (ui *SimpleUI) ProgressChannel(r *Runner) chan ProgressMessage {
 					default:
 						nfail++
 					}
-					if ui.outputMode == OutputPerhost {
+					if mode == OutputPerhost {
 						ui.pchan <- ui.formatter.formatResult(msg.Result, hlen)
-					} else if ui.outputMode == OutputTail {
+					} else if mode == OutputTail {
 						status := ui.formatter.formatStatus(msg.Result, hlen)
 						if ui.outputTimestamp {
 							status = msg.Result.EndTime.Format("15:04:05.000 ") + status
@@ -608,6 +644,35 @@ func (ui *SimpleUI) ProgressChannel(r *Runner) chan ProgressMessage {
 	return pc
 }
 
+// The dashboard is started when the output channel is requested, which is
+// before the progress channel is requested. If we can't start the dashboard,
+// for example because we're not on a terminal, we fall back to per-host
+// output for this run only.
+func (ui *SimpleUI) dashboardOutputChannel(r *Runner) chan OutputLine {
+	if !ui.isTerminal {
+		logrus.Warnf("Not running on a terminal, falling back to per-host output")
+		ui.runMode = OutputPerhost
+		return nil
+	}
+	ui.Sync()
+	d, err := newDashboard(ui, r)
+	if err != nil {
+		logrus.Warnf("Unable to start dashboard, falling back to per-host output: %s", err)
+		ui.runMode = OutputPerhost
+		return nil
+	}
+	ui.dashboardLock.Lock()
+	ui.dashboard = d
+	ui.dashboardLock.Unlock()
+	oc := make(chan OutputLine)
+	go func() {
+		for msg := range oc {
+			d.output(msg)
+		}
+	}()
+	return oc
+}
+
 func (ui *SimpleUI) PrintSettings(funcs ...SettingsFunc) {
 	for _, f := range funcs {
 		name, settings := f()
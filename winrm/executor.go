@@ -0,0 +1,280 @@
+package winrm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/seveas/herd"
+
+	"github.com/Azure/go-ntlmssp"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// The winrm executor runs commands as PowerShell scripts on Windows hosts
+// using WinRM, for hosts that do not run an ssh server. Hosts can override
+// the user and port with the herd_user and herd_port attributes.
+type Executor struct {
+	config struct {
+		User             string
+		Password         string
+		Auth             string
+		Port             int
+		Https            bool
+		Insecure         bool
+		CACert           string
+		OperationTimeout time.Duration
+	}
+	connectTimeout time.Duration
+	clientOnce     sync.Once
+	client         *http.Client
+	clientErr      error
+}
+
+func NewExecutor() *Executor {
+	e := &Executor{}
+	e.config.Auth = "ntlm"
+	e.config.Https = true
+	e.config.OperationTimeout = 20 * time.Second
+	return e
+}
+
+func (e *Executor) ParseViper(v *viper.Viper) error {
+	if err := v.Unmarshal(&e.config); err != nil {
+		return err
+	}
+	switch e.config.Auth {
+	case "ntlm", "basic":
+	default:
+		return fmt.Errorf("Unknown authentication method %s, expected ntlm or basic", e.config.Auth)
+	}
+	return nil
+}
+
+func (e *Executor) SetConnectTimeout(t time.Duration) {
+	e.connectTimeout = t
+}
+
+func (e *Executor) httpClient() (*http.Client, error) {
+	e.clientOnce.Do(func() {
+		tc := &tls.Config{InsecureSkipVerify: e.config.Insecure}
+		if e.config.CACert != "" {
+			data, err := ioutil.ReadFile(e.config.CACert)
+			if err != nil {
+				e.clientErr = err
+				return
+			}
+			tc.RootCAs = x509.NewCertPool()
+			if !tc.RootCAs.AppendCertsFromPEM(data) {
+				e.clientErr = fmt.Errorf("No certificates found in %s", e.config.CACert)
+				return
+			}
+		}
+		var transport http.RoundTripper = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: e.connectTimeout}).DialContext,
+			TLSClientConfig:     tc,
+			TLSHandshakeTimeout: e.connectTimeout,
+		}
+		if e.config.Auth == "ntlm" {
+			transport = ntlmssp.Negotiator{RoundTripper: transport}
+		}
+		e.client = &http.Client{Transport: transport}
+	})
+	return e.client, e.clientErr
+}
+
+func (e *Executor) clientFor(host *herd.Host) (*client, error) {
+	hc, err := e.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	c := &client{http: hc, user: e.config.User, password: e.config.Password, timeout: e.config.OperationTimeout}
+	if user, ok := host.Attributes["herd_user"].(string); ok && user != "" {
+		c.user = user
+	}
+	scheme, port := "https", 5986
+	if !e.config.Https {
+		scheme, port = "http", 5985
+	}
+	if e.config.Port > 0 {
+		port = e.config.Port
+	}
+	if p, err := cast.ToIntE(host.Attributes["herd_port"]); err == nil && p > 0 {
+		port = p
+	}
+	address := host.Address
+	if address == "" {
+		address = host.Name
+	}
+	c.endpoint = fmt.Sprintf("%s://%s/wsman", scheme, net.JoinHostPort(address, strconv.Itoa(port)))
+	return c, nil
+}
+
+func (e *Executor) Run(ctx context.Context, host *herd.Host, command string, oc chan herd.OutputLine) *herd.Result {
+	now := time.Now()
+	r := &herd.Result{Host: host, StartTime: now, EndTime: now, ElapsedTime: 0, ExitStatus: -1}
+	defer func() {
+		r.EndTime = time.Now()
+		r.ElapsedTime = r.EndTime.Sub(r.StartTime).Seconds()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	c, err := e.clientFor(host)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	logrus.Debugf("Connecting to %s (%s) as %s", host.Name, c.endpoint, c.user)
+	shellId, err := c.createShell(ctx)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), e.connectTimeout+time.Second)
+		defer cancel()
+		if err := c.deleteShell(ctx, shellId); err != nil {
+			logrus.Debugf("Unable to delete shell on %s: %s", host.Name, err)
+		}
+	}()
+	commandId, err := c.command(ctx, shellId, "powershell.exe", "-NoProfile", "-NonInteractive", "-EncodedCommand", encodeCommand(command))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	var stdout herd.ByteWriter
+	if oc != nil {
+		stdout = herd.NewLineWriterBuffer(host, false, oc)
+	} else {
+		stdout = bytes.NewBuffer([]byte{})
+	}
+	// PowerShell serializes errors on stderr, so we collect it and clean it
+	// up when the command is done
+	rawStderr := bytes.NewBuffer([]byte{})
+
+	type status struct {
+		code int
+		err  error
+	}
+	sc := make(chan status, 1)
+	go func() {
+		code, err := c.receive(ctx, shellId, commandId, stdout, rawStderr)
+		sc <- status{code, err}
+	}()
+
+	signals := herd.Signals(ctx)
+	signal := func(code string) {
+		sctx, cancel := context.WithTimeout(context.Background(), e.connectTimeout+time.Second)
+		defer cancel()
+		if err := c.signal(sctx, shellId, commandId, code); err != nil {
+			logrus.Debugf("Unable to signal command on %s: %s", host.Name, err)
+		}
+	}
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			logrus.Debugf("Sending %s to command on %s", sig, host.Name)
+			signal(signalCtrlC)
+		case <-ctx.Done():
+			signal(signalTerminate)
+			<-sc
+			r.Err = herd.TimeoutError{Message: "Timed out while executing command"}
+			break wait
+		case s := <-sc:
+			r.ExitStatus = s.code
+			r.Err = s.err
+			if s.err == nil && s.code != 0 {
+				r.Err = fmt.Errorf("Process exited with status %d", s.code)
+			}
+			break wait
+		}
+	}
+
+	var stderr herd.ByteWriter
+	if oc != nil {
+		stderr = herd.NewLineWriterBuffer(host, true, oc)
+	} else {
+		stderr = bytes.NewBuffer([]byte{})
+	}
+	stderr.Write(decodeCLIXML(rawStderr.Bytes()))
+	r.Stdout = stdout.Bytes()
+	r.Stderr = stderr.Bytes()
+	return r
+}
+
+// PowerShell accepts base64 encoded UTF-16LE scripts, which saves us from
+// having to quote anything
+func encodeCommand(command string) string {
+	command = "$ProgressPreference = 'SilentlyContinue'\r\n" + command
+	u := utf16.Encode([]rune(command))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeStream(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	ret := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(ret, data)
+	if err != nil {
+		return nil, fmt.Errorf("winrm: unable to decode output: %s", err)
+	}
+	return ret[:n], nil
+}
+
+const clixmlHeader = "#< CLIXML"
+
+var clixmlEscape = regexp.MustCompile("_x([0-9A-Fa-f]{4})_")
+
+// Turn PowerShell's serialized error records back into plain text
+func decodeCLIXML(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte(clixmlHeader)) {
+		return data
+	}
+	var objs struct {
+		Strings []struct {
+			Stream string `xml:"S,attr"`
+			Text   string `xml:",chardata"`
+		} `xml:"S"`
+	}
+	if err := xml.Unmarshal(bytes.TrimSpace(data[len(clixmlHeader):]), &objs); err != nil {
+		return data
+	}
+	var b strings.Builder
+	for _, s := range objs.Strings {
+		if s.Stream != "Error" {
+			continue
+		}
+		b.WriteString(clixmlEscape.ReplaceAllStringFunc(s.Text, func(m string) string {
+			c, _ := strconv.ParseUint(m[2:6], 16, 16)
+			return string(rune(c))
+		}))
+	}
+	return []byte(strings.ReplaceAll(b.String(), "\r\n", "\n"))
+}
+
+var _ herd.Executor = &Executor{}
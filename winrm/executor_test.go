@@ -0,0 +1,193 @@
+package winrm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/seveas/herd"
+
+	"github.com/spf13/viper"
+)
+
+// A stub WinRM server that pretends to run a few PowerShell commands
+type stubServer struct {
+	lock     sync.Mutex
+	scripts  map[string]string
+	receives map[string]int
+	deleted  []string
+	signals  []string
+}
+
+type request struct {
+	Header struct {
+		Action  string `xml:"Action"`
+		ShellId string `xml:"SelectorSet>Selector"`
+	} `xml:"Header"`
+	Body struct {
+		Arguments []string `xml:"CommandLine>Arguments"`
+		Receive   struct {
+			CommandId string `xml:"CommandId,attr"`
+		} `xml:"Receive>DesiredStream"`
+		Signal struct {
+			Code string `xml:"Code"`
+		} `xml:"Signal"`
+	} `xml:"Body"`
+}
+
+func decodeScript(arg string) string {
+	data, _ := base64.StdEncoding.DecodeString(arg)
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "hunter2" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="WSMAN"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	req := request{}
+	if err := xml.Unmarshal(data, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	switch req.Header.Action {
+	case actionCreate:
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s" xmlns:rsp="%s"><s:Body><rsp:Shell><rsp:ShellId>shell-1</rsp:ShellId></rsp:Shell></s:Body></s:Envelope>`, nsSoap, nsShell)
+	case actionCommand:
+		id := fmt.Sprintf("command-%d", len(s.scripts))
+		s.scripts[id] = decodeScript(req.Body.Arguments[len(req.Body.Arguments)-1])
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s" xmlns:rsp="%s"><s:Body><rsp:CommandResponse><rsp:CommandId>%s</rsp:CommandId></rsp:CommandResponse></s:Body></s:Envelope>`, nsSoap, nsShell, id)
+	case actionReceive:
+		id := req.Body.Receive.CommandId
+		s.receives[id]++
+		script := s.scripts[id]
+		// The first receive times out, as if the command is still running
+		if s.receives[id] == 1 || strings.Contains(script, "Start-Sleep") {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><s:Code><s:Value>s:Receiver</s:Value><s:Subcode><s:Value>w:TimedOut</s:Value></s:Subcode></s:Code><s:Reason><s:Text xml:lang="">The WS-Management service cannot complete the operation within the time specified in OperationTimeout.</s:Text></s:Reason><s:Detail><f:WSManFault xmlns:f="http://schemas.microsoft.com/wbem/wsman/1/wsmanfault" Code="2150858793" Machine="stub"/></s:Detail></s:Fault></s:Body></s:Envelope>`, nsSoap)
+			return
+		}
+		stdout, stderr, code := "", "", 0
+		if strings.Contains(script, "Write-Output") {
+			stdout = "hello\r\nworld\r\n"
+		}
+		if strings.Contains(script, "Write-Error") {
+			stderr = `#< CLIXML` + "\r\n" + `<Objs Version="1.1.0.1" xmlns="http://schemas.microsoft.com/powershell/2004/04"><S S="Error">Write-Error : oops_x000D__x000A_</S><S S="Error">    + FullyQualifiedErrorId : Microsoft.PowerShell.Commands.WriteErrorException_x000D__x000A_</S></Objs>`
+			code = 1
+		}
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s" xmlns:rsp="%s"><s:Body><rsp:ReceiveResponse>`, nsSoap, nsShell)
+		fmt.Fprintf(w, `<rsp:Stream Name="stdout" CommandId="%s">%s</rsp:Stream>`, id, base64.StdEncoding.EncodeToString([]byte(stdout)))
+		fmt.Fprintf(w, `<rsp:Stream Name="stderr" CommandId="%s">%s</rsp:Stream>`, id, base64.StdEncoding.EncodeToString([]byte(stderr)))
+		fmt.Fprintf(w, `<rsp:CommandState CommandId="%s" State="%s"><rsp:ExitCode>%d</rsp:ExitCode></rsp:CommandState>`, id, commandDone, code)
+		fmt.Fprintf(w, `</rsp:ReceiveResponse></s:Body></s:Envelope>`)
+	case actionSignal:
+		s.signals = append(s.signals, req.Body.Signal.Code)
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body/></s:Envelope>`, nsSoap)
+	case actionDelete:
+		s.deleted = append(s.deleted, req.Header.ShellId)
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body/></s:Envelope>`, nsSoap)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+	}
+}
+
+func newStub(t *testing.T, password string) (*stubServer, *Executor, *herd.Host) {
+	stub := &stubServer{scripts: make(map[string]string), receives: make(map[string]int)}
+	server := httptest.NewTLSServer(stub)
+	t.Cleanup(server.Close)
+	addr, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	v := viper.New()
+	v.Set("User", "admin")
+	v.Set("Password", password)
+	v.Set("Auth", "basic")
+	v.Set("Insecure", true)
+	e := NewExecutor()
+	if err := e.ParseViper(v); err != nil {
+		t.Fatalf("Unable to configure executor: %s", err)
+	}
+	e.SetConnectTimeout(time.Second)
+	return stub, e, herd.NewHost("win-1.example.com", addr, herd.HostAttributes{"herd_port": port})
+}
+
+func TestRun(t *testing.T) {
+	stub, e, host := newStub(t, "hunter2")
+	r := e.Run(context.Background(), host, "Write-Output 'hello', 'world'", nil)
+	if r.Err != nil || r.ExitStatus != 0 {
+		t.Fatalf("Command failed: %d %v", r.ExitStatus, r.Err)
+	}
+	if string(r.Stdout) != "hello\r\nworld\r\n" || len(r.Stderr) != 0 {
+		t.Errorf("Unexpected output: %q %q", r.Stdout, r.Stderr)
+	}
+	if script := stub.scripts["command-0"]; !strings.HasSuffix(script, "\r\nWrite-Output 'hello', 'world'") {
+		t.Errorf("Script was not sent correctly: %q", script)
+	}
+	if len(stub.deleted) != 1 || stub.deleted[0] != "shell-1" {
+		t.Errorf("Shell was not deleted: %v", stub.deleted)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	_, e, host := newStub(t, "hunter2")
+	oc := make(chan herd.OutputLine, 10)
+	r := e.Run(context.Background(), host, "Write-Error oops", oc)
+	if r.ExitStatus != 1 || r.Err == nil || r.Err.Error() != "Process exited with status 1" {
+		t.Errorf("Unexpected result: %d %v", r.ExitStatus, r.Err)
+	}
+	expected := "Write-Error : oops\n    + FullyQualifiedErrorId : Microsoft.PowerShell.Commands.WriteErrorException\n"
+	if string(r.Stderr) != expected {
+		t.Errorf("Unexpected stderr: %q", r.Stderr)
+	}
+	close(oc)
+	lines := 0
+	for l := range oc {
+		if !l.Stderr {
+			t.Errorf("Unexpected stdout line: %q", l.Data)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 lines of output, got %d", lines)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	stub, e, host := newStub(t, "hunter2")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r := e.Run(ctx, host, "Start-Sleep 60", nil)
+	if _, ok := r.Err.(herd.TimeoutError); !ok {
+		t.Errorf("Expected a timeout, got %v", r.Err)
+	}
+	if len(stub.signals) != 1 || stub.signals[0] != signalTerminate {
+		t.Errorf("Command was not terminated: %v", stub.signals)
+	}
+}
+
+func TestRunUnauthorized(t *testing.T) {
+	_, e, host := newStub(t, "wrong")
+	r := e.Run(context.Background(), host, "Write-Output 'hello'", nil)
+	if r.Err != errUnauthorized || r.ExitStatus != -1 {
+		t.Errorf("Unexpected result: %d %v", r.ExitStatus, r.Err)
+	}
+}
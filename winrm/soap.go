@@ -0,0 +1,243 @@
+package winrm
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Just enough of WS-Management to run commands in a remote shell: create a
+// shell, start a command in it, receive its output, send it signals and
+// delete the shell again.
+const (
+	nsSoap       = "http://www.w3.org/2003/05/soap-envelope"
+	nsAddressing = "http://schemas.xmlsoap.org/ws/2004/08/addressing"
+	nsWsman      = "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"
+	nsShell      = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell"
+
+	resourceCmd = nsShell + "/cmd"
+
+	actionCreate  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create"
+	actionDelete  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete"
+	actionCommand = nsShell + "/Command"
+	actionReceive = nsShell + "/Receive"
+	actionSignal  = nsShell + "/Signal"
+
+	signalTerminate = nsShell + "/signal/terminate"
+	signalCtrlC     = nsShell + "/signal/ctrl_c"
+	commandDone     = nsShell + "/CommandState/Done"
+
+	// Returned by Receive when a command produced no output for the
+	// duration of the operation timeout
+	faultTimedOut = "2150858793"
+)
+
+type client struct {
+	http     *http.Client
+	endpoint string
+	user     string
+	password string
+	timeout  time.Duration
+}
+
+type option struct {
+	name  string
+	value string
+}
+
+func (c *client) envelope(action, shellId string, options []option, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<env:Envelope xmlns:env="%s" xmlns:a="%s" xmlns:w="%s" xmlns:rsp="%s">`, nsSoap, nsAddressing, nsWsman, nsShell)
+	b.WriteString(`<env:Header>`)
+	fmt.Fprintf(&b, `<a:To>%s</a:To>`, escape(c.endpoint))
+	fmt.Fprintf(&b, `<a:ReplyTo><a:Address env:mustUnderstand="true">%s/role/anonymous</a:Address></a:ReplyTo>`, nsAddressing)
+	fmt.Fprintf(&b, `<a:Action env:mustUnderstand="true">%s</a:Action>`, action)
+	fmt.Fprintf(&b, `<a:MessageID>uuid:%s</a:MessageID>`, uuid.New().String())
+	b.WriteString(`<w:MaxEnvelopeSize env:mustUnderstand="true">153600</w:MaxEnvelopeSize>`)
+	b.WriteString(`<w:Locale xml:lang="en-US" env:mustUnderstand="false"/>`)
+	fmt.Fprintf(&b, `<w:OperationTimeout>PT%dS</w:OperationTimeout>`, int(c.timeout.Seconds()))
+	fmt.Fprintf(&b, `<w:ResourceURI env:mustUnderstand="true">%s</w:ResourceURI>`, resourceCmd)
+	if shellId != "" {
+		fmt.Fprintf(&b, `<w:SelectorSet><w:Selector Name="ShellId">%s</w:Selector></w:SelectorSet>`, escape(shellId))
+	}
+	if len(options) > 0 {
+		b.WriteString(`<w:OptionSet>`)
+		for _, o := range options {
+			fmt.Fprintf(&b, `<w:Option Name="%s">%s</w:Option>`, o.name, escape(o.value))
+		}
+		b.WriteString(`</w:OptionSet>`)
+	}
+	b.WriteString(`</env:Header><env:Body>`)
+	b.WriteString(body)
+	b.WriteString(`</env:Body></env:Envelope>`)
+	return b.Bytes()
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type response struct {
+	Body struct {
+		Fault   *fault `xml:"Fault"`
+		ShellId string `xml:"Shell>ShellId"`
+		Command struct {
+			CommandId string `xml:"CommandId"`
+		} `xml:"CommandResponse"`
+		Receive struct {
+			Streams      []stream `xml:"Stream"`
+			CommandState struct {
+				State    string `xml:"State,attr"`
+				ExitCode int    `xml:"ExitCode"`
+			} `xml:"CommandState"`
+		} `xml:"ReceiveResponse"`
+	} `xml:"Body"`
+}
+
+type stream struct {
+	Name string `xml:"Name,attr"`
+	Data []byte `xml:",chardata"`
+}
+
+type fault struct {
+	Subcode string `xml:"Code>Subcode>Value"`
+	Reason  string `xml:"Reason>Text"`
+	Detail  struct {
+		Code    string `xml:"Code,attr"`
+		Message string `xml:"Message"`
+	} `xml:"Detail>WSManFault"`
+}
+
+func (f *fault) Error() string {
+	msg := strings.TrimSpace(f.Reason)
+	if msg == "" {
+		msg = strings.TrimSpace(f.Detail.Message)
+	}
+	if f.Detail.Code != "" {
+		return fmt.Sprintf("winrm: %s (code %s)", msg, f.Detail.Code)
+	}
+	return fmt.Sprintf("winrm: %s", msg)
+}
+
+func (f *fault) timedOut() bool {
+	return f.Detail.Code == faultTimedOut || strings.HasSuffix(f.Subcode, ":TimedOut")
+}
+
+var errUnauthorized = errors.New("winrm: authentication failed")
+
+func (c *client) call(ctx context.Context, action, shellId string, options []option, body string) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(c.envelope(action, shellId, options, body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.SetBasicAuth(c.user, c.password)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
+	r := &response{}
+	if err = xml.Unmarshal(data, r); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("winrm: unexpected response: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("winrm: unable to parse response: %s", err)
+	}
+	if r.Body.Fault != nil {
+		return nil, r.Body.Fault
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("winrm: unexpected response: %s", resp.Status)
+	}
+	return r, nil
+}
+
+func (c *client) createShell(ctx context.Context) (string, error) {
+	options := []option{{"WINRS_NOPROFILE", "TRUE"}, {"WINRS_CODEPAGE", "65001"}}
+	body := `<rsp:Shell><rsp:InputStreams>stdin</rsp:InputStreams><rsp:OutputStreams>stdout stderr</rsp:OutputStreams></rsp:Shell>`
+	r, err := c.call(ctx, actionCreate, "", options, body)
+	if err != nil {
+		return "", err
+	}
+	if r.Body.ShellId == "" {
+		return "", errors.New("winrm: no shell id returned")
+	}
+	return r.Body.ShellId, nil
+}
+
+func (c *client) deleteShell(ctx context.Context, shellId string) error {
+	_, err := c.call(ctx, actionDelete, shellId, nil, "")
+	return err
+}
+
+func (c *client) command(ctx context.Context, shellId, command string, args ...string) (string, error) {
+	options := []option{{"WINRS_CONSOLEMODE_STDIN", "TRUE"}, {"WINRS_SKIP_CMD_SHELL", "FALSE"}}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<rsp:CommandLine><rsp:Command>%s</rsp:Command>`, escape(command))
+	for _, arg := range args {
+		fmt.Fprintf(&b, `<rsp:Arguments>%s</rsp:Arguments>`, escape(arg))
+	}
+	b.WriteString(`</rsp:CommandLine>`)
+	r, err := c.call(ctx, actionCommand, shellId, options, b.String())
+	if err != nil {
+		return "", err
+	}
+	if r.Body.Command.CommandId == "" {
+		return "", errors.New("winrm: no command id returned")
+	}
+	return r.Body.Command.CommandId, nil
+}
+
+// Receive output until the command is done. Returns the exit code of the
+// command.
+func (c *client) receive(ctx context.Context, shellId, commandId string, stdout, stderr io.Writer) (int, error) {
+	body := fmt.Sprintf(`<rsp:Receive><rsp:DesiredStream CommandId="%s">stdout stderr</rsp:DesiredStream></rsp:Receive>`, escape(commandId))
+	for {
+		r, err := c.call(ctx, actionReceive, shellId, []option{{"WSMAN_CMDSHELL_OPTION_KEEPALIVE", "TRUE"}}, body)
+		if f, ok := err.(*fault); ok && f.timedOut() {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		for _, s := range r.Body.Receive.Streams {
+			data, err := decodeStream(s.Data)
+			if err != nil {
+				return -1, err
+			}
+			if s.Name == "stderr" {
+				stderr.Write(data)
+			} else {
+				stdout.Write(data)
+			}
+		}
+		if r.Body.Receive.CommandState.State == commandDone {
+			return r.Body.Receive.CommandState.ExitCode, nil
+		}
+	}
+}
+
+func (c *client) signal(ctx context.Context, shellId, commandId, code string) error {
+	body := fmt.Sprintf(`<rsp:Signal CommandId="%s"><rsp:Code>%s</rsp:Code></rsp:Signal>`, escape(commandId), code)
+	_, err := c.call(ctx, actionSignal, shellId, nil, body)
+	return err
+}